@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const vegaAbciInfoUrl = "/abci_info"
+
+type VegaAbciInfo struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		Response struct {
+			Data             string `json:"data"`
+			Version          string `json:"version"`
+			AppVersion       string `json:"app_version"`
+			LastBlockHeight  string `json:"last_block_height"`
+			LastBlockAppHash string `json:"last_block_app_hash"`
+		} `json:"response"`
+	} `json:"result"`
+}
+
+var (
+	metricAbciInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "abci", "info"),
+		"Information about the ABCI application, always 1.",
+		[]string{"version", "app_version"}, nil,
+	)
+	metricAbciLastBlockHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "abci", "last_block_height"),
+		"Last block height according to the application.",
+		nil, nil,
+	)
+	metricAbciAppHashPresent = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "abci", "last_block_app_hash_present"),
+		"Whether the application reports an app hash for its last block.",
+		nil, nil,
+	)
+)
+
+// AbciInfoCollector exports what the application reports through /abci_info.
+type AbciInfoCollector struct {
+	rpc *RPCClient
+}
+
+func NewAbciInfoCollector(rpc *RPCClient) *AbciInfoCollector {
+	return &AbciInfoCollector{rpc: rpc}
+}
+
+func (c *AbciInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricAbciInfo
+	ch <- metricAbciLastBlockHeight
+	ch <- metricAbciAppHashPresent
+}
+
+func (c *AbciInfoCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var abciInfo VegaAbciInfo
+	err := c.rpc.GetJSON(ctx, vegaAbciInfoUrl, &abciInfo)
+	if err != nil {
+		return err
+	}
+	response := abciInfo.Result.Response
+
+	height, err := strconv.ParseFloat(response.LastBlockHeight, 64)
+	if err != nil {
+		return fmt.Errorf("parsing abci last block height: %v", err)
+	}
+
+	var appHashPresent float64
+	if response.LastBlockAppHash != "" {
+		appHashPresent = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		metricAbciInfo, prometheus.GaugeValue, 1, labelValue(response.Version), labelValue(response.AppVersion),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricAbciLastBlockHeight, prometheus.GaugeValue, height,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricAbciAppHashPresent, prometheus.GaugeValue, appHashPresent,
+	)
+
+	return nil
+}
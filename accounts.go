@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeAccountsUrl = "/api/v2/accounts"
+
+// Account types read by the accounts collector
+const (
+	accountTypeInsurance       = "ACCOUNT_TYPE_INSURANCE"
+	accountTypeNetworkTreasury = "ACCOUNT_TYPE_NETWORK_TREASURY"
+)
+
+type dataNodeAccount struct {
+	Owner    string `json:"owner"`
+	Balance  string `json:"balance"`
+	Asset    string `json:"asset"`
+	MarketID string `json:"marketId"`
+	Type     string `json:"type"`
+}
+
+type DataNodeAccounts struct {
+	Accounts struct {
+		Edges []struct {
+			Node dataNodeAccount `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"accounts"`
+}
+
+var (
+	metricMarketInsurancePool = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "insurance_pool"),
+		"Balance of the insurance pool of the market, in units of the asset.",
+		[]string{"market_id", "market", "asset", "asset_id"}, nil,
+	)
+	metricNetworkTreasury = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "network", "treasury"),
+		"Balance of the network treasury, in units of the asset.",
+		[]string{"asset", "asset_id"}, nil,
+	)
+)
+
+// AccountsCollector exports the balances of the market insurance pools and
+// of the network treasury, whose sudden drawdowns follow liquidations.
+type AccountsCollector struct {
+	dataNode *DataNodeClient
+}
+
+func NewAccountsCollector(dataNode *DataNodeClient) *AccountsCollector {
+	return &AccountsCollector{dataNode: dataNode}
+}
+
+func (c *AccountsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricMarketInsurancePool
+	ch <- metricNetworkTreasury
+}
+
+func (c *AccountsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	markets, err := listMarkets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing markets: %v", err)
+	}
+	marketLabels := make(map[string]string)
+	for _, market := range markets {
+		marketLabels[market.ID] = market.label()
+	}
+	assets, err := listAssets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing assets: %v", err)
+	}
+
+	accounts, err := listAccounts(ctx, c.dataNode, accountTypeInsurance, accountTypeNetworkTreasury)
+	if err != nil {
+		return fmt.Errorf("listing accounts: %v", err)
+	}
+	for _, account := range accounts {
+		asset, ok := assets[account.Asset]
+		if !ok {
+			return fmt.Errorf("account of %s: unknown asset %s", account.Owner, account.Asset)
+		}
+		balance, err := parseAmount(account.Balance, asset.decimals)
+		if err != nil {
+			return fmt.Errorf("account of %s: balance: %v", account.Owner, err)
+		}
+
+		switch account.Type {
+		case accountTypeInsurance:
+			ch <- prometheus.MustNewConstMetric(
+				metricMarketInsurancePool, prometheus.GaugeValue, balance,
+				account.MarketID, marketLabels[account.MarketID], labelValue(asset.symbol), account.Asset,
+			)
+		case accountTypeNetworkTreasury:
+			ch <- prometheus.MustNewConstMetric(
+				metricNetworkTreasury, prometheus.GaugeValue, balance, labelValue(asset.symbol), account.Asset,
+			)
+		}
+	}
+	return nil
+}
+
+// listAccounts returns the accounts of the given types.
+func listAccounts(ctx context.Context, dataNode *DataNodeClient, types ...string) ([]dataNodeAccount, error) {
+	var accounts []dataNodeAccount
+	cursor := ""
+	for {
+		var page DataNodeAccounts
+		path := dataNodePage(dataNodeAccountsUrl, cursor)
+		for _, accountType := range types {
+			path += "&filter.accountTypes=" + url.QueryEscape(accountType)
+		}
+		err := dataNode.Get(ctx, path, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range page.Accounts.Edges {
+			accounts = append(accounts, edge.Node)
+		}
+		if !page.Accounts.PageInfo.HasNextPage {
+			return accounts, nil
+		}
+		cursor = page.Accounts.PageInfo.EndCursor
+	}
+}
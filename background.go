@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collectors that aren't switched with a flag, which can still run in the
+// background
+var configuredCollectors = map[string]bool{
+	"core":           true,
+	"datanode":       true,
+	"reference":      true,
+	"staking_bridge": true,
+	"block_explorer": true,
+	"wallet":         true,
+	"faucet":         true,
+}
+
+// The Tendermint RPC parts of every collection, which can run in the
+// background like the collectors
+var partCollectors = map[string]bool{
+	"status":    true,
+	"net_info":  true,
+	"consensus": true,
+}
+
+// backgroundCollectors are the names of --background.collectors.
+var backgroundCollectors = map[string]bool{}
+
+// parseBackgroundCollectors reads the comma separated collector names of
+// --background.collectors.
+func parseBackgroundCollectors(names string) error {
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !knownCollector(name) {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+		backgroundCollectors[name] = true
+	}
+	return nil
+}
+
+// knownCollector tells whether name is a collector or a part of the
+// collection.
+func knownCollector(name string) bool {
+	return switchableCollectors[name] || configuredCollectors[name] || partCollectors[name]
+}
+
+// collectorFunc turns a part of the collection into a Collector. Its metrics
+// are described by the exporter.
+type collectorFunc func(ctx context.Context, ch chan<- prometheus.Metric) error
+
+func (f collectorFunc) Describe(ch chan<- *prometheus.Desc) {}
+
+func (f collectorFunc) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	return f(ctx, ch)
+}
+
+// reportedError is the error of a background run already returned to a
+// previous scrape. It still fails the scrapes, without being counted again.
+type reportedError struct {
+	err error
+}
+
+func (e reportedError) Error() string {
+	return e.err.Error()
+}
+
+// BackgroundCollector runs a collector on its own schedule, scrapes are
+// served the metrics of its latest run. Heavy collectors then no longer
+// slow down scrapes, whatever the performance of the endpoints they query.
+type BackgroundCollector struct {
+	// Target and name of the collector
+	node      string
+	name      string
+	collector Collector
+	interval  time.Duration
+	// Context bounded by the timeout of the collector
+	timeout func() (context.Context, context.CancelFunc)
+
+	mutex   sync.Mutex
+	metrics []prometheus.Metric
+	err     error
+	// End of the latest successful run
+	lastSuccess time.Time
+	// Time the latest run took
+	duration time.Duration
+	// Whether the error of the latest run was returned to a scrape already
+	reported bool
+	// Closed once the first run is done
+	ready chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewBackgroundCollector(node, name string, collector Collector, interval time.Duration, timeout func() (context.Context, context.CancelFunc)) *BackgroundCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &BackgroundCollector{
+		node:      node,
+		name:      name,
+		collector: collector,
+		interval:  interval,
+		timeout:   timeout,
+		ready:     make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	go c.run()
+	return c
+}
+
+func (c *BackgroundCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+}
+
+// Update sends the metrics of the latest run, waiting for the first one.
+// The error of a failed run is returned to every scrape until the next run,
+// as a reportedError after the first one so that it is counted once.
+func (c *BackgroundCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	select {
+	case <-c.ready:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the first run: %v", ctx.Err())
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// Metrics older than --background.max-age are dropped rather than
+	// served as if they were current
+	if *backgroundMaxAge <= 0 || time.Since(c.lastSuccess) <= *backgroundMaxAge {
+		for _, metric := range c.metrics {
+			ch <- metric
+		}
+	}
+	if c.err == nil {
+		return nil
+	}
+	if c.reported {
+		return reportedError{c.err}
+	}
+	c.reported = true
+	return c.err
+}
+
+// LastSuccess returns the end of the latest successful run, zero before the
+// first one.
+func (c *BackgroundCollector) LastSuccess() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lastSuccess
+}
+
+// Duration returns the time the latest run took.
+func (c *BackgroundCollector) Duration() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.duration
+}
+
+// Close stops the runs and closes the collector.
+func (c *BackgroundCollector) Close() error {
+	c.cancel()
+	if closer, ok := c.collector.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// run updates the collector every interval until it is closed.
+func (c *BackgroundCollector) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		// Followers serve the leader's runs of the leader-only collectors,
+		// or their own cached ones, there is no point in running them
+		if !leaderOnlyCollectors[c.name] || isLeader() {
+			c.update()
+		}
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update runs the collector once and keeps its metrics.
+func (c *BackgroundCollector) update() {
+	ctx, cancel := c.timeout()
+	defer cancel()
+	ctx, span := startTrace(ctx, "background "+c.name)
+	span.setAttribute("collector", c.name)
+
+	start := time.Now()
+	ch := make(chan prometheus.Metric)
+	done := make(chan error, 1)
+	go func() {
+		done <- callCollector(c.node, c.name, func() error {
+			return c.collector.Update(ctx, ch)
+		})
+		close(ch)
+	}()
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	err := <-done
+	duration := time.Since(start)
+	span.finish(err)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.duration = duration
+	// A failed run loses its metrics, as it would have during a scrape
+	if err != nil {
+		metrics = nil
+	} else {
+		c.lastSuccess = time.Now()
+	}
+	c.metrics, c.err, c.reported = metrics, err, false
+	select {
+	case <-c.ready:
+	default:
+		close(c.ready)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBackgroundCollector(t *testing.T) {
+	defer func(maxAge time.Duration) { *backgroundMaxAge = maxAge }(*backgroundMaxAge)
+	*backgroundMaxAge = 0
+
+	desc := prometheus.NewDesc("test_background", "Test.", nil, nil)
+	value := 1.0
+	var failure error
+	collector := collectorFunc(func(ctx context.Context, ch chan<- prometheus.Metric) error {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+		return failure
+	})
+	timeout := func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(context.Background(), time.Second)
+	}
+	served := func(c *BackgroundCollector) ([]float64, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		ch := make(chan prometheus.Metric, 10)
+		err := c.Update(ctx, ch)
+		close(ch)
+		var values []float64
+		for metric := range ch {
+			_, value := metricKey(t, metric)
+			values = append(values, value)
+		}
+		return values, err
+	}
+
+	t.Run("runs on its own", func(t *testing.T) {
+		c := NewBackgroundCollector("node", "test", collector, time.Hour, timeout)
+		defer c.Close()
+		values, err := served(c)
+		if err != nil || len(values) != 1 || values[0] != 1 {
+			t.Errorf("served %v, %v, want [1] once the first run is done", values, err)
+		}
+	})
+
+	// Runs are driven by hand from here
+	c := &BackgroundCollector{node: "node", name: "test", collector: collector, timeout: timeout, ready: make(chan struct{})}
+	if _, err := served(c); err == nil {
+		t.Error("no error before the first run")
+	}
+	failed := errors.New("failed")
+	steps := []struct {
+		name    string
+		value   float64
+		failure error
+		maxAge  time.Duration
+		// Scrapes served after the run
+		scrapes int
+		served  []float64
+		err     error
+	}{
+		{"successful run", 1, nil, 0, 1, []float64{1}, nil},
+		{"failed run loses its metrics", 2, failed, 0, 1, nil, failed},
+		{"failure counted once", 2, failed, 0, 2, nil, reportedError{failed}},
+		{"next run", 3, nil, 0, 1, []float64{3}, nil},
+		{"older than the max age", 4, nil, time.Nanosecond, 1, nil, nil},
+	}
+	for _, step := range steps {
+		value, failure, *backgroundMaxAge = step.value, step.failure, step.maxAge
+		c.update()
+		time.Sleep(time.Millisecond)
+		var values []float64
+		var err error
+		for i := 0; i < step.scrapes; i++ {
+			values, err = served(c)
+		}
+		if len(values) != len(step.served) || (len(values) > 0 && values[0] != step.served[0]) {
+			t.Errorf("%s: served %v, want %v", step.name, values, step.served)
+		}
+		if err != step.err {
+			t.Errorf("%s: error = %#v, want %#v", step.name, err, step.err)
+		}
+	}
+}
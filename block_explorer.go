@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const blockExplorerInfoUrl = "/rest/info"
+
+// ServiceConfig is an HTTP service of the Vega stack probed next to a node.
+type ServiceConfig struct {
+	Endpoint string            `yaml:"endpoint"`
+	Headers  map[string]string `yaml:"headers"`
+	// Health check path overriding the default of the service
+	HealthPath string `yaml:"health_path"`
+	// Optional path returning the version of the service as JSON
+	VersionPath string `yaml:"version_path"`
+}
+
+type BlockExplorerInfo struct {
+	Version    string `json:"version"`
+	CommitHash string `json:"commitHash"`
+	// Latest block indexed, whether or not it had transactions
+	Height string `json:"height"`
+}
+
+var (
+	metricBlockExplorerUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "block_explorer", "up"),
+		"Whether the block explorer API answered the last probe.",
+		nil, nil,
+	)
+	metricBlockExplorerProbeDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "block_explorer", "probe_duration_seconds"),
+		"Time the last probe of the block explorer API took.",
+		nil, nil,
+	)
+	metricBlockExplorerInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "block_explorer", "info"),
+		"Version of the block explorer, always 1.",
+		[]string{"version", "commit_hash"}, nil,
+	)
+	metricBlockExplorerIndexedHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "block_explorer", "indexed_height"),
+		"Latest block height indexed by the block explorer.",
+		nil, nil,
+	)
+	metricBlockExplorerBlocksBehind = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "block_explorer", "blocks_behind"),
+		"Number of blocks between the latest height of the node and the latest one indexed by the block explorer.",
+		nil, nil,
+	)
+)
+
+// BlockExplorerCollector probes the block explorer API of the node's
+// infrastructure and compares its indexed height with the node. The info
+// endpoint serves as health check and version unless the config overrides
+// them, and always reports the indexed height.
+type BlockExplorerCollector struct {
+	explorer    *DataNodeClient
+	rpc         *RPCClient
+	healthPath  string
+	versionPath string
+}
+
+// The block explorer follows the REST conventions of the data node
+func NewBlockExplorerCollector(config ServiceConfig, rpc *RPCClient) *BlockExplorerCollector {
+	c := &BlockExplorerCollector{
+		explorer:    NewDataNodeClient(config.Endpoint, config.Headers),
+		rpc:         rpc,
+		healthPath:  config.HealthPath,
+		versionPath: config.VersionPath,
+	}
+	if c.healthPath == "" {
+		c.healthPath = blockExplorerInfoUrl
+	}
+	if c.versionPath == "" {
+		c.versionPath = blockExplorerInfoUrl
+	}
+	return c
+}
+
+func (c *BlockExplorerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricBlockExplorerUp
+	ch <- metricBlockExplorerProbeDuration
+	ch <- metricBlockExplorerInfo
+	ch <- metricBlockExplorerIndexedHeight
+	ch <- metricBlockExplorerBlocksBehind
+}
+
+func (c *BlockExplorerCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	start := time.Now()
+	var info BlockExplorerInfo
+	var health interface{}
+	if c.healthPath == blockExplorerInfoUrl {
+		health = &info
+	}
+	err := c.explorer.Get(ctx, c.healthPath, health)
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockExplorerProbeDuration, prometheus.GaugeValue, time.Since(start).Seconds(),
+	)
+	var up float64
+	if err == nil {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockExplorerUp, prometheus.GaugeValue, up,
+	)
+	if err != nil {
+		return err
+	}
+	if c.healthPath != blockExplorerInfoUrl {
+		err = c.explorer.Get(ctx, blockExplorerInfoUrl, &info)
+		if err != nil {
+			return err
+		}
+	}
+	version := info
+	if c.versionPath != blockExplorerInfoUrl {
+		version = BlockExplorerInfo{}
+		err = c.explorer.Get(ctx, c.versionPath, &version)
+		if err != nil {
+			return err
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockExplorerInfo, prometheus.GaugeValue, 1, labelValue(version.Version), labelValue(version.CommitHash),
+	)
+
+	// Transactions don't tell the indexed height, a chain without any for a
+	// while would look behind
+	indexed, err := strconv.ParseFloat(info.Height, 64)
+	if err != nil {
+		return fmt.Errorf("parsing indexed height: %v", err)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockExplorerIndexedHeight, prometheus.GaugeValue, indexed,
+	)
+
+	var status VegaStatus
+	err = c.rpc.GetJSON(ctx, vegaStatusUrl, &status)
+	if err != nil {
+		return err
+	}
+	latest, err := strconv.ParseFloat(status.Result.SyncInfo.LatestBlockHeight, 64)
+	if err != nil {
+		return fmt.Errorf("parsing latest height: %v", err)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockExplorerBlocksBehind, prometheus.GaugeValue, latest-indexed,
+	)
+	return nil
+}
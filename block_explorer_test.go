@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestBlockExplorerCollector(t *testing.T) {
+	var mutex sync.Mutex
+	var requested []string
+	explorer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requested = append(requested, r.URL.Path)
+		mutex.Unlock()
+		switch r.URL.Path {
+		case blockExplorerInfoUrl:
+			fmt.Fprint(w, `{"version": "v1", "commitHash": "abc", "height": "95"}`)
+		case "/healthz":
+			fmt.Fprint(w, `{}`)
+		case "/version":
+			fmt.Fprint(w, `{"version": "v2"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer explorer.Close()
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc": "2.0", "id": -1, "result": {"sync_info": {"latest_block_height": "100"}}}`)
+	}))
+	defer node.Close()
+
+	tests := []struct {
+		name      string
+		config    ServiceConfig
+		requested []string
+		info      string
+	}{
+		{"defaults", ServiceConfig{}, []string{blockExplorerInfoUrl}, `vega_block_explorer_info{commit_hash="abc",version="v1"}`},
+		{"health path", ServiceConfig{HealthPath: "/healthz"}, []string{"/healthz", blockExplorerInfoUrl},
+			`vega_block_explorer_info{commit_hash="abc",version="v1"}`},
+		{"version path", ServiceConfig{VersionPath: "/version"}, []string{"/version", blockExplorerInfoUrl},
+			`vega_block_explorer_info{commit_hash="",version="v2"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requested = nil
+			test.config.Endpoint = explorer.URL
+			c := NewBlockExplorerCollector(test.config, NewRPCClient(node.URL, nil))
+			values, err := collect(t, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(requested)
+			sort.Strings(test.requested)
+			if !reflect.DeepEqual(requested, test.requested) {
+				t.Errorf("requested %q, want %q", requested, test.requested)
+			}
+			if values["vega_block_explorer_up"] != 1 || values[test.info] != 1 {
+				t.Errorf("up, %s = %v, %v, want 1, 1", test.info, values["vega_block_explorer_up"], values[test.info])
+			}
+			if values["vega_block_explorer_indexed_height"] != 95 || values["vega_block_explorer_blocks_behind"] != 5 {
+				t.Errorf("indexed height, blocks behind = %v, %v, want 95, 5",
+					values["vega_block_explorer_indexed_height"], values["vega_block_explorer_blocks_behind"])
+			}
+		})
+	}
+}
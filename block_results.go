@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const vegaBlockResultsUrl = "/block_results"
+
+type VegaEvent struct {
+	Type       string `json:"type"`
+	Attributes []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"attributes"`
+}
+
+type VegaBlockResults struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		Height     string `json:"height"`
+		TxsResults []struct {
+			Code      int         `json:"code"`
+			Log       string      `json:"log"`
+			GasWanted string      `json:"gas_wanted"`
+			GasUsed   string      `json:"gas_used"`
+			Events    []VegaEvent `json:"events"`
+			Codespace string      `json:"codespace"`
+		} `json:"txs_results"`
+		BeginBlockEvents    []VegaEvent `json:"begin_block_events"`
+		EndBlockEvents      []VegaEvent `json:"end_block_events"`
+		FinalizeBlockEvents []VegaEvent `json:"finalize_block_events"`
+	} `json:"result"`
+}
+
+var (
+	metricBlockEvents = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "block_events_total"),
+		"Number of ABCI events by type in the blocks processed by the exporter.",
+		[]string{"type"}, nil,
+	)
+	metricBlockFailedTxsTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "block_failed_txs_total"),
+		"Number of failed transactions in the blocks processed by the exporter.",
+		nil, nil,
+	)
+	metricBlockFailedTxs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "block_failed_txs"),
+		"Number of failed transactions in the latest block.",
+		nil, nil,
+	)
+	metricBlockResultsSkipped = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "block_results_skipped_total"),
+		"Number of heights skipped because the node had pruned them or the exporter fell more than --collector.block-results.max-gap behind, whose events vega_block_events_total misses.",
+		nil, nil,
+	)
+)
+
+// BlockResultsCollector counts the events and failed transactions reported by
+// /block_results for every new height.
+type BlockResultsCollector struct {
+	rpc     *RPCClient
+	catchUp *catchUp
+
+	lastHeight     int64
+	events         map[string]float64
+	failedTxsTotal float64
+	failedTxs      float64
+	skipped        float64
+}
+
+func NewBlockResultsCollector(rpc *RPCClient) *BlockResultsCollector {
+	return &BlockResultsCollector{
+		rpc:     rpc,
+		catchUp: newCatchUp("block_results"),
+		events:  make(map[string]float64),
+	}
+}
+
+func (c *BlockResultsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricBlockEvents
+	ch <- metricBlockFailedTxsTotal
+	ch <- metricBlockFailedTxs
+	ch <- metricBlockResultsSkipped
+	ch <- metricBlocksBehind
+}
+
+func (c *BlockResultsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	// Without a height /block_results returns the latest block
+	latest, err := c.fetchBlockResults(ctx, 0)
+	if err != nil {
+		return err
+	}
+	latestHeight, err := strconv.ParseInt(latest.Result.Height, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing block results height: %v", err)
+	}
+
+	// Heights missed while the node or the exporter were down are replayed
+	// a batch per scrape, as far as the timeout allows
+	from := c.lastHeight + 1
+	if c.lastHeight == 0 {
+		from = latestHeight
+	}
+	if *blockResultsMaxGap > 0 && latestHeight-int64(*blockResultsMaxGap)+1 > from {
+		from = c.skip(from, latestHeight-int64(*blockResultsMaxGap)+1)
+	}
+	to := c.catchUp.batch(from, latestHeight, *catchUpBatchSize)
+	for height := from; height <= to; height++ {
+		results := latest
+		if height < latestHeight {
+			err = c.catchUp.wait(ctx)
+			if err == nil {
+				results, err = c.fetchBlockResults(ctx, height)
+			}
+			if err != nil {
+				if c.catchUp.interrupted(ctx, err, c.lastHeight, latestHeight) {
+					break
+				}
+				earliest, earliestErr := earliestHeight(ctx, c.rpc)
+				if earliestErr != nil || height >= earliest {
+					return fmt.Errorf("reading block results at height %d: %v", height, err)
+				}
+				// Pruned since, the loop resumes at the earliest height
+				height = c.skip(height, earliest) - 1
+				c.lastHeight = height
+				continue
+			}
+		}
+		c.process(results)
+		c.lastHeight = height
+	}
+
+	for eventType, count := range c.events {
+		ch <- prometheus.MustNewConstMetric(
+			metricBlockEvents, prometheus.CounterValue, count, eventType,
+		)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockFailedTxsTotal, prometheus.CounterValue, c.failedTxsTotal,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockFailedTxs, prometheus.GaugeValue, c.failedTxs,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockResultsSkipped, prometheus.CounterValue, c.skipped,
+	)
+	c.catchUp.collect(ch)
+
+	return nil
+}
+
+// skip counts the heights from from up to to, excluded, as skipped and
+// returns to, the height to read from instead.
+func (c *BlockResultsCollector) skip(from, to int64) int64 {
+	logWarnf("Block results collector skipping heights %d to %d, their events aren't counted", from, to-1)
+	c.skipped += float64(to - from)
+	return to
+}
+
+// process adds the events and failed transactions of a block to the totals.
+func (c *BlockResultsCollector) process(results VegaBlockResults) {
+	var events []VegaEvent
+	events = append(events, results.Result.BeginBlockEvents...)
+	events = append(events, results.Result.EndBlockEvents...)
+	events = append(events, results.Result.FinalizeBlockEvents...)
+
+	c.failedTxs = 0
+	for _, tx := range results.Result.TxsResults {
+		if tx.Code != 0 {
+			c.failedTxs++
+		}
+		events = append(events, tx.Events...)
+	}
+	c.failedTxsTotal += c.failedTxs
+
+	for _, event := range events {
+		c.events[event.Type]++
+	}
+}
+
+func (c *BlockResultsCollector) fetchBlockResults(ctx context.Context, height int64) (VegaBlockResults, error) {
+	var results VegaBlockResults
+	path := vegaBlockResultsUrl
+	if height > 0 {
+		path = fmt.Sprintf("%s?height=%d", vegaBlockResultsUrl, height)
+	}
+	err := c.rpc.GetJSON(ctx, path, &results)
+	if err != nil {
+		return results, err
+	}
+	return results, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestBlockResultsSkip(t *testing.T) {
+	defer func(batch, maxGap int, rate float64) {
+		*catchUpBatchSize, *blockResultsMaxGap, *catchUpRate = batch, maxGap, rate
+	}(*catchUpBatchSize, *blockResultsMaxGap, *catchUpRate)
+	*catchUpBatchSize, *catchUpRate = 0, 0
+
+	tests := []struct {
+		name       string
+		maxGap     int
+		lastHeight int64
+		earliest   int64
+		skipped    float64
+		events     float64
+	}{
+		{"first call", 10, 0, 1, 0, 1},
+		{"short gap", 10, 95, 1, 0, 5},
+		{"pruned", 10, 95, 98, 2, 3},
+		{"longer than the max gap", 3, 90, 1, 7, 3},
+		{"without max gap", 0, 90, 1, 0, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*blockResultsMaxGap = test.maxGap
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case vegaStatusUrl:
+					fmt.Fprintf(w, `{"result": {"sync_info": {"earliest_block_height": "%d"}}}`, test.earliest)
+				case vegaBlockResultsUrl:
+					height := int64(100)
+					if h := r.URL.Query().Get("height"); h != "" {
+						height, _ = strconv.ParseInt(h, 10, 64)
+					}
+					if height < test.earliest {
+						http.Error(w, "height not available", http.StatusInternalServerError)
+						return
+					}
+					fmt.Fprintf(w, `{"result": {"height": "%d", "begin_block_events": [{"type": "transfer"}]}}`, height)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+			c := NewBlockResultsCollector(NewRPCClient(server.URL, nil))
+			c.lastHeight = test.lastHeight
+
+			values, err := collect(t, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.lastHeight != 100 {
+				t.Errorf("last height = %d, want 100", c.lastHeight)
+			}
+			if skipped := values["vega_block_results_skipped_total"]; skipped != test.skipped {
+				t.Errorf("skipped = %v, want %v", skipped, test.skipped)
+			}
+			if events := values[`vega_block_events_total{type="transfer"}`]; events != test.events {
+				t.Errorf("events = %v, want %v", events, test.events)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const vegaBlockchainUrl = "/blockchain"
+
+// Tendermint returns at most 20 block metas per /blockchain call
+const blockchainPageSize = 20
+
+type VegaBlockchain struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		LastHeight string `json:"last_height"`
+		BlockMetas []struct {
+			BlockID struct {
+				Hash string `json:"hash"`
+			} `json:"block_id"`
+			BlockSize string `json:"block_size"`
+			Header    struct {
+				ChainID         string    `json:"chain_id"`
+				Height          string    `json:"height"`
+				Time            time.Time `json:"time"`
+				AppHash         string    `json:"app_hash"`
+				ProposerAddress string    `json:"proposer_address"`
+			} `json:"header"`
+			NumTxs string `json:"num_txs"`
+		} `json:"block_metas"`
+	} `json:"result"`
+}
+
+var (
+	metricBlockTxs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "block_txs"),
+		"Number of transactions in the latest block.",
+		nil, nil,
+	)
+	metricBlockSizeBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "block_size_bytes"),
+		"Size of the latest block in bytes.",
+		nil, nil,
+	)
+	metricBlockTxsWindow = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "block_txs_window"),
+		"Distribution of transactions per block over the recent block window.",
+		nil, nil,
+	)
+	metricBlockSizeBytesWindow = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "block_size_bytes_window"),
+		"Distribution of block sizes in bytes over the recent block window.",
+		nil, nil,
+	)
+	metricTxsTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "txs_total"),
+		"Number of transactions in the blocks processed by the exporter.",
+		nil, nil,
+	)
+	metricBlocksSkipped = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "blocks_skipped_total"),
+		"Number of blocks skipped because the exporter fell more than the window behind, whose transactions vega_txs_total misses.",
+		nil, nil,
+	)
+
+	blockTxsBuckets  = prometheus.ExponentialBuckets(1, 2, 12)
+	blockSizeBuckets = prometheus.ExponentialBuckets(1024, 2, 12)
+)
+
+type blockMeta struct {
+	height int64
+	size   float64
+	txs    float64
+}
+
+// BlockCollector follows the chain through /blockchain and keeps the metas of
+// the most recent blocks.
+type BlockCollector struct {
+	rpc        *RPCClient
+	windowSize int
+	catchUp    *catchUp
+
+	lastHeight int64
+	window     []blockMeta
+	txsTotal   float64
+	skipped    float64
+}
+
+func NewBlockCollector(rpc *RPCClient, windowSize int) *BlockCollector {
+	return &BlockCollector{
+		rpc:        rpc,
+		windowSize: windowSize,
+		catchUp:    newCatchUp("blocks"),
+	}
+}
+
+func (c *BlockCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricBlockTxs
+	ch <- metricBlockSizeBytes
+	ch <- metricBlockTxsWindow
+	ch <- metricBlockSizeBytesWindow
+	ch <- metricTxsTotal
+	ch <- metricBlocksSkipped
+	ch <- metricBlocksBehind
+}
+
+func (c *BlockCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	err := c.follow(ctx)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricTxsTotal, prometheus.CounterValue, c.txsTotal,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricBlocksSkipped, prometheus.CounterValue, c.skipped,
+	)
+	c.catchUp.collect(ch)
+	if len(c.window) == 0 {
+		return nil
+	}
+
+	latest := c.window[len(c.window)-1]
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockTxs, prometheus.GaugeValue, latest.txs,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockSizeBytes, prometheus.GaugeValue, latest.size,
+	)
+
+	txs := make([]float64, len(c.window))
+	sizes := make([]float64, len(c.window))
+	for i, meta := range c.window {
+		txs[i] = meta.txs
+		sizes[i] = meta.size
+	}
+	ch <- windowHistogram(metricBlockTxsWindow, blockTxsBuckets, txs)
+	ch <- windowHistogram(metricBlockSizeBytesWindow, blockSizeBuckets, sizes)
+
+	return nil
+}
+
+// follow fetches the metas of the blocks produced since the previous call,
+// limited to the window size and to a catch-up batch.
+func (c *BlockCollector) follow(ctx context.Context) error {
+	latest, err := c.fetchBlockchain(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+	lastHeight, err := strconv.ParseInt(latest.Result.LastHeight, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing last height: %v", err)
+	}
+
+	from := c.lastHeight + 1
+	if lastHeight-int64(c.windowSize)+1 > from {
+		from = lastHeight - int64(c.windowSize) + 1
+		// Blocks before the first call aren't missed, they were never
+		// meant to be counted
+		if c.lastHeight > 0 {
+			logDebugf("Blocks collector skipping heights %d to %d", c.lastHeight+1, from-1)
+			c.skipped += float64(from - c.lastHeight - 1)
+			c.lastHeight = from - 1
+		}
+	}
+	if from < 1 {
+		from = 1
+	}
+
+	// Each page is kept as soon as it is read, so that a batch cut short by
+	// the timeout isn't read again
+	to := c.catchUp.batch(from, lastHeight, *catchUpBatchSize)
+	for min := from; min <= to; min += blockchainPageSize {
+		max := min + blockchainPageSize - 1
+		if max > to {
+			max = to
+		}
+		err := c.catchUp.wait(ctx)
+		var page VegaBlockchain
+		if err == nil {
+			page, err = c.fetchBlockchain(ctx, min, max)
+		}
+		if err != nil {
+			if c.catchUp.interrupted(ctx, err, c.lastHeight, lastHeight) {
+				break
+			}
+			return err
+		}
+		var metas []blockMeta
+		for _, m := range page.Result.BlockMetas {
+			var meta blockMeta
+			meta.height, err = strconv.ParseInt(m.Header.Height, 10, 64)
+			if err != nil {
+				return fmt.Errorf("parsing block height: %v", err)
+			}
+			size, err := strconv.ParseFloat(m.BlockSize, 64)
+			if err != nil {
+				return fmt.Errorf("parsing block size: %v", err)
+			}
+			txs, err := strconv.ParseFloat(m.NumTxs, 64)
+			if err != nil {
+				return fmt.Errorf("parsing block txs: %v", err)
+			}
+			meta.size = size
+			meta.txs = txs
+			metas = append(metas, meta)
+		}
+
+		// Each height is only fetched once, so summing here keeps the
+		// counter monotonic across calls.
+		for _, meta := range metas {
+			c.txsTotal += meta.txs
+		}
+
+		// Metas come newest first
+		sort.Slice(metas, func(i, j int) bool { return metas[i].height < metas[j].height })
+		c.window = append(c.window, metas...)
+		c.lastHeight = max
+	}
+
+	// The window spans heights rather than blocks, so that blocks from before
+	// a gap don't linger
+	start := c.lastHeight - int64(c.windowSize) + 1
+	i := 0
+	for i < len(c.window) && c.window[i].height < start {
+		i++
+	}
+	c.window = c.window[i:]
+	return nil
+}
+
+// fetchBlockchain loads block metas between min and max, or the latest ones
+// when both are zero.
+func (c *BlockCollector) fetchBlockchain(ctx context.Context, min, max int64) (VegaBlockchain, error) {
+	var blockchain VegaBlockchain
+	path := vegaBlockchainUrl
+	if min > 0 {
+		path = fmt.Sprintf("%s?minHeight=%d&maxHeight=%d", vegaBlockchainUrl, min, max)
+	}
+	err := c.rpc.GetJSON(ctx, path, &blockchain)
+	if err != nil {
+		return blockchain, err
+	}
+	return blockchain, nil
+}
+
+// windowHistogram builds a histogram out of the given observations.
+func windowHistogram(desc *prometheus.Desc, buckets []float64, values []float64) prometheus.Metric {
+	counts := make(map[float64]uint64)
+	var sum float64
+	for _, value := range values {
+		sum += value
+		for _, bound := range buckets {
+			if value <= bound {
+				counts[bound]++
+			}
+		}
+	}
+	return prometheus.MustNewConstHistogram(desc, uint64(len(values)), sum, counts)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// blockchainServer serves /blockchain up to *height, each block holding a
+// single transaction.
+func blockchainServer(height *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		min, _ := strconv.ParseInt(r.URL.Query().Get("minHeight"), 10, 64)
+		max, _ := strconv.ParseInt(r.URL.Query().Get("maxHeight"), 10, 64)
+		var metas []interface{}
+		for h := max; h >= min && min > 0; h-- {
+			metas = append(metas, map[string]interface{}{
+				"block_size": "100", "num_txs": "1",
+				"header": map[string]interface{}{"height": strconv.FormatInt(h, 10)},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{"last_height": strconv.FormatInt(*height, 10), "block_metas": metas},
+		})
+	}))
+}
+
+func TestBlockCollectorGaps(t *testing.T) {
+	var height int64
+	server := blockchainServer(&height)
+	defer server.Close()
+	c := NewBlockCollector(NewRPCClient(server.URL, nil), 5)
+
+	steps := []struct {
+		height  int64
+		txs     float64
+		skipped float64
+	}{
+		// The first call reads the window only
+		{10, 5, 0},
+		{12, 7, 0},
+		// 13 to 24 fall out of the window
+		{29, 12, 12},
+	}
+	for i, step := range steps {
+		height = step.height
+		values, err := collect(t, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if values["vega_txs_total"] != step.txs || values["vega_blocks_skipped_total"] != step.skipped {
+			t.Errorf("step %d: txs, skipped = %v, %v, want %v, %v", i,
+				values["vega_txs_total"], values["vega_blocks_skipped_total"], step.txs, step.skipped)
+		}
+	}
+}
+
+func TestBlockCollectorOutOfTime(t *testing.T) {
+	defer func(batch int, rate float64) {
+		*catchUpBatchSize, *catchUpRate = batch, rate
+	}(*catchUpBatchSize, *catchUpRate)
+	*catchUpBatchSize, *catchUpRate = 100, 1
+
+	height := int64(100)
+	server := blockchainServer(&height)
+	defer server.Close()
+	c := NewBlockCollector(NewRPCClient(server.URL, nil), 100)
+	// A single request before the rate applies: the second page can't be
+	// read within the timeout
+	c.catchUp.bucket.tokens = 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	ch := make(chan prometheus.Metric, 100)
+	err := c.Update(ctx, ch)
+	close(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for metric := range ch {
+		key, value := metricKey(t, metric)
+		values[key] = value
+	}
+	if c.lastHeight != blockchainPageSize {
+		t.Errorf("last height = %d, want the first page kept", c.lastHeight)
+	}
+	if values["vega_txs_total"] != blockchainPageSize {
+		t.Errorf("txs = %v, want %d", values["vega_txs_total"], blockchainPageSize)
+	}
+	if behind, ok := values[`vega_exporter_blocks_behind{collector="blocks"}`]; !ok || behind != 100-blockchainPageSize {
+		t.Errorf("blocks behind = %v (sent: %v), want %d", behind, ok, 100-blockchainPageSize)
+	}
+}
+
+func TestBlockCollectorWindowAfterGap(t *testing.T) {
+	defer func(batch int) { *catchUpBatchSize = batch }(*catchUpBatchSize)
+	*catchUpBatchSize = 2
+
+	height := int64(10)
+	server := blockchainServer(&height)
+	defer server.Close()
+	c := NewBlockCollector(NewRPCClient(server.URL, nil), 5)
+	for c.lastHeight < height {
+		if _, err := collect(t, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The gap skips to 25, the batch only reads 25 and 26: blocks 6 to 10
+	// are out of the window of 22 to 26
+	height = 29
+	values, err := collect(t, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks := values["vega_block_txs_window"]; blocks != 2 {
+		t.Errorf("window blocks = %v, want 2", blocks)
+	}
+	for _, meta := range c.window {
+		if meta.height < 22 {
+			t.Errorf("height %d left in the window after the gap", meta.height)
+		}
+	}
+}
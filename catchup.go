@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Requests sent without waiting before the --catchup.rate applies, about a
+// scrape's worth of blocks.
+const catchUpBurst = 20
+
+// errCatchUpDeadline stops a batch whose next request couldn't be sent before
+// the timeout of the collector.
+var errCatchUpDeadline = errors.New("catch-up batch out of time")
+
+var metricBlocksBehind = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "exporter", "blocks_behind"),
+	"Number of heights a block following collector still has to replay to catch up with the node.",
+	[]string{"collector"}, nil,
+)
+
+// catchUp bounds the heights a block following collector replays per scrape
+// after falling behind, and paces its requests so that catching up doesn't
+// flood the node.
+type catchUp struct {
+	collector string
+	bucket    tokenBucket
+	behind    int64
+}
+
+func newCatchUp(collector string) *catchUp {
+	return &catchUp{
+		collector: collector,
+		bucket:    tokenBucket{tokens: catchUpBurst, last: time.Now()},
+	}
+}
+
+// batch returns the last height to process, at most size heights from the
+// next one expected up to latest. A size of 0 doesn't limit the batch.
+func (c *catchUp) batch(from, latest int64, size int) int64 {
+	to := latest
+	if size > 0 && to-from+1 > int64(size) {
+		to = from + int64(size) - 1
+	}
+	c.behind = latest - to
+	if to < from {
+		// Nothing new, the node may even be behind the last height seen
+		to = from - 1
+		c.behind = 0
+	}
+	return to
+}
+
+// wait blocks until the next request may be sent.
+func (c *catchUp) wait(ctx context.Context) error {
+	if *catchUpRate <= 0 {
+		return nil
+	}
+	now := time.Now()
+	c.bucket.tokens += now.Sub(c.bucket.last).Seconds() * *catchUpRate
+	if c.bucket.tokens > catchUpBurst {
+		c.bucket.tokens = catchUpBurst
+	}
+	c.bucket.last = now
+
+	if c.bucket.tokens < 1 {
+		delay := time.Duration((1 - c.bucket.tokens) / *catchUpRate * float64(time.Second))
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return errCatchUpDeadline
+		}
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		c.bucket.tokens = 1
+		c.bucket.last = time.Now()
+	}
+	c.bucket.tokens--
+	return nil
+}
+
+// interrupted tells whether err is the batch running out of time rather than a
+// failure of the node. The batch then stops at last, the heights read are kept
+// and the others are still behind latest.
+func (c *catchUp) interrupted(ctx context.Context, err error, last, latest int64) bool {
+	if err != errCatchUpDeadline && ctx.Err() == nil {
+		return false
+	}
+	logDebugf("Collector %s out of time at height %d, resuming on the next run", c.collector, last)
+	c.behind = latest - last
+	return true
+}
+
+func (c *catchUp) collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(
+		metricBlocksBehind, prometheus.GaugeValue, float64(c.behind), c.collector,
+	)
+}
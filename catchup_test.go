@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestCatchUpBatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   int64
+		latest int64
+		size   int
+		to     int64
+		behind int64
+	}{
+		{"within the batch", 11, 15, 100, 15, 0},
+		{"exactly the batch", 11, 20, 10, 20, 0},
+		{"behind", 11, 100, 10, 20, 80},
+		{"unlimited", 11, 100, 0, 100, 0},
+		{"nothing new", 11, 10, 10, 10, 0},
+		{"node behind the last height", 11, 5, 10, 10, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newCatchUp("test")
+			to := c.batch(test.from, test.latest, test.size)
+			if to != test.to || c.behind != test.behind {
+				t.Errorf("batch(%d, %d, %d) = %d with %d behind, want %d with %d behind",
+					test.from, test.latest, test.size, to, c.behind, test.to, test.behind)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Seconds between the NTP epoch (1900) and the unix epoch
+const ntpEpochOffset = 2208988800
+
+// NTP servers ask clients not to poll more often than this
+const ntpMinInterval = time.Minute
+
+var (
+	metricNodeClockDrift = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "clock_drift_seconds"),
+		"Difference between the node clock (from the RPC Date header, 1s resolution) and the reference time.",
+		nil, nil,
+	)
+	metricLatestBlockAge = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "latest_block_age_seconds"),
+		"Time elapsed since the latest block time according to the reference time.",
+		nil, nil,
+	)
+	metricNTPOffset = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "ntp_offset_seconds"),
+		"Offset of the NTP server clock relative to the exporter clock.",
+		nil, nil,
+	)
+)
+
+// ClockCollector compares the node clock and the latest block time with the
+// exporter clock, corrected by an NTP server when one is configured.
+type ClockCollector struct {
+	rpc *RPCClient
+	ntp *ntpClock
+}
+
+func NewClockCollector(rpc *RPCClient, ntp *ntpClock) *ClockCollector {
+	return &ClockCollector{rpc: rpc, ntp: ntp}
+}
+
+func (c *ClockCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricNodeClockDrift
+	ch <- metricLatestBlockAge
+	ch <- metricNTPOffset
+}
+
+func (c *ClockCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var offset time.Duration
+	if c.ntp != nil {
+		var err error
+		offset, err = c.ntp.Offset()
+		if err != nil {
+			return fmt.Errorf("ntp: %v", err)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricNTPOffset, prometheus.GaugeValue, offset.Seconds(),
+		)
+	}
+
+	start := time.Now()
+	body, header, err := c.rpc.GetWithHeader(ctx, vegaStatusUrl)
+	if err != nil {
+		return err
+	}
+	end := time.Now()
+	reference := start.Add(end.Sub(start) / 2).Add(offset)
+
+	var vegaStatus VegaStatus
+	err = c.rpc.decode(vegaStatusUrl, body, &vegaStatus)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricLatestBlockAge, prometheus.GaugeValue,
+		reference.Sub(vegaStatus.Result.SyncInfo.LatestBlockTime).Seconds(),
+	)
+
+	nodeTime, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return fmt.Errorf("parsing node Date header: %v", err)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricNodeClockDrift, prometheus.GaugeValue, nodeTime.Sub(reference).Seconds(),
+	)
+
+	return nil
+}
+
+// ntpClock queries an NTP server for the offset of the local clock, caching
+// the result to stay within the polling limits of public servers.
+type ntpClock struct {
+	server string
+
+	mutex     sync.Mutex
+	offset    time.Duration
+	lastQuery time.Time
+}
+
+func newNTPClock(server string) *ntpClock {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	return &ntpClock{server: server}
+}
+
+// Offset returns the time to add to the local clock to get the NTP time.
+func (n *ntpClock) Offset() (time.Duration, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if !n.lastQuery.IsZero() && time.Since(n.lastQuery) < ntpMinInterval {
+		return n.offset, nil
+	}
+
+	offset, err := n.query()
+	if err != nil {
+		return 0, err
+	}
+	n.offset = offset
+	n.lastQuery = time.Now()
+	return offset, nil
+}
+
+// query performs a single SNTP (RFC 4330) exchange.
+func (n *ntpClock) query() (time.Duration, error) {
+	conn, err := net.DialTimeout("udp", n.server, 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// LI 0, version 4, mode 3 (client)
+	request := make([]byte, 48)
+	request[0] = 0x23
+
+	sent := time.Now()
+	_, err = conn.Write(request)
+	if err != nil {
+		return 0, err
+	}
+	response := make([]byte, 48)
+	_, err = conn.Read(response)
+	if err != nil {
+		return 0, err
+	}
+	received := time.Now()
+
+	serverReceived := ntpTime(response[32:40])
+	serverSent := ntpTime(response[40:48])
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+// ntpTime decodes a 64 bit NTP timestamp.
+func ntpTime(b []byte) time.Time {
+	seconds := binary.BigEndian.Uint32(b[0:4])
+	fraction := binary.BigEndian.Uint32(b[4:8])
+	nanoseconds := (int64(fraction) * 1e9) >> 32
+	return time.Unix(int64(seconds)-ntpEpochOffset, nanoseconds)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is an optional source of metrics run on every scrape next to the
+// Tendermint RPC metrics of an Exporter.
+type Collector interface {
+	Describe(ch chan<- *prometheus.Desc)
+	// Update sends the current metrics of the collector to ch. It must give
+	// up once ctx is done.
+	Update(ctx context.Context, ch chan<- prometheus.Metric) error
+}
+
+// blockMetric stamps a metric derived from a block with the block time when
+// --metrics.block-timestamps is set, so that replayed blocks land at their
+// own time on graphs. Prometheus drops series whose latest sample is older
+// than its lookback delta, 5 minutes by default: blocks older than
+// --metrics.block-timestamps.max-age, like the last one of a halted chain,
+// keep the scrape time.
+func blockMetric(metric prometheus.Metric, blockTime time.Time) prometheus.Metric {
+	if !*blockTimestamps || blockTime.IsZero() {
+		return metric
+	}
+	if *blockTimestampsMaxAge > 0 && time.Since(blockTime) > *blockTimestampsMaxAge {
+		return metric
+	}
+	return prometheus.NewMetricWithTimestamp(blockTime, metric)
+}
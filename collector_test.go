@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var fqNamePattern = regexp.MustCompile(`fqName: "([^"]+)"`)
+
+// metricKey returns a metric as name{label="value",...} with its value.
+func metricKey(t *testing.T, metric prometheus.Metric) (string, float64) {
+	t.Helper()
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	name := fqNamePattern.FindStringSubmatch(metric.Desc().String())[1]
+	var labels []string
+	for _, label := range m.Label {
+		labels = append(labels, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+	}
+	if len(labels) > 0 {
+		name += "{" + strings.Join(labels, ",") + "}"
+	}
+	switch {
+	case m.Gauge != nil:
+		return name, m.Gauge.GetValue()
+	case m.Counter != nil:
+		return name, m.Counter.GetValue()
+	case m.Histogram != nil:
+		return name, float64(m.Histogram.GetSampleCount())
+	}
+	return name, m.Untyped.GetValue()
+}
+
+// collect runs an update of c and returns its metrics by metricKey.
+func collect(t *testing.T, c Collector) (map[string]float64, error) {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 1000)
+	err := c.Update(context.Background(), ch)
+	close(ch)
+	values := make(map[string]float64)
+	for metric := range ch {
+		key, value := metricKey(t, metric)
+		values[key] = value
+	}
+	return values, err
+}
+
+func TestBlockMetric(t *testing.T) {
+	defer func(enabled bool, maxAge time.Duration) {
+		*blockTimestamps, *blockTimestampsMaxAge = enabled, maxAge
+	}(*blockTimestamps, *blockTimestampsMaxAge)
+
+	desc := prometheus.NewDesc("test_block_metric", "Test.", nil, nil)
+	recent := time.Now().Add(-time.Second)
+	halted := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		enabled   bool
+		maxAge    time.Duration
+		blockTime time.Time
+		stamped   bool
+	}{
+		{"disabled", false, 4 * time.Minute, recent, false},
+		{"recent block", true, 4 * time.Minute, recent, true},
+		{"no block time", true, 4 * time.Minute, time.Time{}, false},
+		{"halted chain", true, 4 * time.Minute, halted, false},
+		{"without max age", true, 0, halted, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*blockTimestamps, *blockTimestampsMaxAge = test.enabled, test.maxAge
+			metric := blockMetric(prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1), test.blockTime)
+			var m dto.Metric
+			if err := metric.Write(&m); err != nil {
+				t.Fatal(err)
+			}
+			if stamped := m.TimestampMs != nil; stamped != test.stamped {
+				t.Fatalf("stamped = %v, want %v", stamped, test.stamped)
+			}
+			if test.stamped && m.GetTimestampMs() != test.blockTime.UnixNano()/int64(time.Millisecond) {
+				t.Errorf("timestamp = %d, want the block time %v", m.GetTimestampMs(), test.blockTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Set at build time with -ldflags "-X main.version=... -X main.revision=..."
+var (
+	version  = "dev"
+	revision = "unknown"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [command] [flags]
+
+Commands:
+  serve    expose the metrics over HTTP (default)
+  check    validate the configuration and reach every target, exit 1 on failure
+  check-config
+           same as check
+  once     collect once, print the metrics to stdout and exit, 1 if a target is down
+  mock     serve a fake Tendermint RPC for dashboard and alert development
+  version  print the version and exit
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func printVersion() {
+	fmt.Printf("vega-prometheus-exporter %s (revision %s, %s)\n", version, revision, runtime.Version())
+}
+
+// check validates every target, resolves its endpoints and queries /status.
+// It returns the process exit code.
+func check() int {
+	ctx, cancel := context.WithTimeout(context.Background(), *rpcTimeout)
+	targets, err := loadTargets().targets(ctx)
+	cancel()
+	if err != nil {
+		fmt.Printf("FAILED: %v\n", err)
+		return 1
+	}
+
+	code := 0
+	for _, target := range targets {
+		exporter, err := NewExporter(target)
+		if err != nil {
+			fmt.Printf("%s: FAILED: %v\n", targetName(target), err)
+			code = 1
+			continue
+		}
+		exporter.Close()
+		status, err := checkTarget(target)
+		if err != nil {
+			fmt.Printf("%s: FAILED: %v\n", targetName(target), err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: OK: network %s, height %s, catching up %t\n", targetName(target),
+			status.Result.NodeInfo.Network,
+			status.Result.SyncInfo.LatestBlockHeight,
+			status.Result.SyncInfo.CatchingUp)
+	}
+	return code
+}
+
+// checkTarget makes sure the RPC endpoints of a target are valid and answer,
+// and returns the status of the node.
+func checkTarget(target TargetConfig) (VegaStatus, error) {
+	err := validateEndpoint(target.Endpoint)
+	if err != nil {
+		return VegaStatus{}, err
+	}
+	// Only the RPC client is needed, collectors are left alone
+	exporter := &Exporter{
+		rpc:      NewRPCClient(target.Endpoint, target.Headers),
+		timeouts: target.Timeouts,
+	}
+
+	ctx, cancel := exporter.timeoutContext("status")
+	defer cancel()
+	err = resolveEndpoint(ctx, target.Endpoint)
+	if err != nil {
+		return VegaStatus{}, err
+	}
+	if target.Reference != nil && target.Reference.Endpoint != "" {
+		err = validateEndpoint(target.Reference.Endpoint)
+		if err == nil {
+			err = resolveEndpoint(ctx, target.Reference.Endpoint)
+		}
+		if err != nil {
+			return VegaStatus{}, fmt.Errorf("reference: %v", err)
+		}
+	}
+
+	// LoadVegaStatus sends a handful of metrics, they are dropped
+	status, err := exporter.LoadVegaStatus(ctx, make(chan prometheus.Metric, 16))
+	if err != nil {
+		return status, fmt.Errorf("querying %s: %v", vegaStatusUrl, err)
+	}
+	return status, nil
+}
+
+func targetName(target TargetConfig) string {
+	if target.Name != "" {
+		return target.Name
+	}
+	if target.Endpoint != "" {
+		return target.Endpoint
+	}
+	return "VEGA_ENDPOINT"
+}
+
+// once runs a single collection of every target and prints it in the text
+// exposition format. It returns the process exit code.
+func once() int {
+	ctx, cancel := context.WithTimeout(context.Background(), *rpcTimeout)
+	targets, err := loadTargets().targets(ctx)
+	cancel()
+	if err != nil {
+		logErrorf("%v", err)
+		return 1
+	}
+	set := newTargetSet()
+	err = set.update(targets)
+	if err != nil {
+		logErrorf("%v", err)
+		return 1
+	}
+
+	families, err := set.Gather()
+	code := 0
+	if err != nil {
+		logErrorf("%v", err)
+		code = 1
+	}
+
+	encoder := expfmt.NewEncoder(os.Stdout, expfmt.FmtText)
+	for _, family := range families {
+		err := encoder.Encode(family)
+		if err != nil {
+			logErrorf("%v", err)
+			return 1
+		}
+
+		if family.GetName() == prometheus.BuildFQName(namespace, "", "up") {
+			for _, metric := range family.GetMetric() {
+				if metric.GetGauge().GetValue() == 0 {
+					code = 1
+				}
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// Collectors that can be turned on or off per network or target, overriding
+// their --collector flag.
+var switchableCollectors = map[string]bool{
+	"blocks":          true,
+	"abci_info":       true,
+	"clock":           true,
+	"block_results":   true,
+	"snapshots":       true,
+	"signing":         true,
+	"websocket":       true,
+	"genesis":         true,
+	"key_rotations":   true,
+	"withdrawals":     true,
+	"network_history": true,
+	"liquidity":       true,
+	"trades":          true,
+	"proposals":       true,
+	"accounts":        true,
+	"fees":            true,
+	"oracles":         true,
+	"market_events":   true,
+	"markets":         true,
+	"staking":         true,
+	"epochs":          true,
+	"rewards":         true,
+	"delegations":     true,
+	"validator_power": true,
+}
+
+// Config is the optional YAML configuration file passed with --config.file.
+type Config struct {
+	Targets []TargetConfig `yaml:"targets"`
+	// Networks group targets of the same chain, their metrics carry a
+	// network label.
+	Networks []NetworkConfig `yaml:"networks"`
+	// Timeouts per collector name, with a "default" entry for the others.
+	// Targets inherit the entries they don't set themselves.
+	Timeouts map[string]time.Duration `yaml:"timeouts"`
+	// Time between two runs of the collectors that run in the background
+	// instead of on every scrape, per collector name. Targets inherit them
+	// likewise.
+	Intervals map[string]time.Duration `yaml:"intervals"`
+}
+
+// NetworkConfig holds the targets of a network and the settings they
+// inherit.
+type NetworkConfig struct {
+	Name             string                   `yaml:"name"`
+	Targets          []TargetConfig           `yaml:"targets"`
+	Timeouts         map[string]time.Duration `yaml:"timeouts"`
+	Intervals        map[string]time.Duration `yaml:"intervals"`
+	Collectors       map[string]bool          `yaml:"collectors"`
+	ValidatorAliases map[string]string        `yaml:"validator_aliases"`
+}
+
+// TargetConfig describes a single RPC endpoint to scrape.
+type TargetConfig struct {
+	Name     string `yaml:"name"`
+	Endpoint string `yaml:"endpoint"`
+	// Extra labels added to every metric of the target
+	Labels map[string]string `yaml:"labels"`
+	// Extra request headers sent with every RPC request. A "Host" entry
+	// overrides the Host header and the TLS server name.
+	Headers map[string]string `yaml:"headers"`
+	// Optional Vega core gRPC API of the same node
+	CoreGRPC *CoreGRPCConfig `yaml:"core_grpc"`
+	// Optional data node queried for configurable metrics
+	DataNode *DataNodeConfig `yaml:"datanode"`
+	// Optional Ethereum node the Vega bridge contracts are read from
+	Ethereum *EthereumConfig `yaml:"ethereum"`
+	// Optional block explorer API probed next to the node
+	BlockExplorer *ServiceConfig `yaml:"block_explorer"`
+	// Optional wallet service probed next to the node
+	Wallet *ServiceConfig `yaml:"wallet"`
+	// Optional testnet faucet probed next to the node
+	Faucet *ServiceConfig `yaml:"faucet"`
+	// Optional trusted node the block and app hashes are compared with
+	Reference *TargetConfig `yaml:"reference"`
+	// Timeouts per collector name
+	Timeouts map[string]time.Duration `yaml:"timeouts"`
+	// Background intervals per collector name
+	Intervals map[string]time.Duration `yaml:"intervals"`
+	// Collectors turned on or off for this target
+	Collectors map[string]bool `yaml:"collectors"`
+	// Names used in the validator label instead of the peer monikers, by
+	// node ID or moniker
+	ValidatorAliases map[string]string `yaml:"validator_aliases"`
+	// Node IDs of the peers the node should always be connected to, like
+	// the sentries of a validator
+	ExpectedPeers []string `yaml:"expected_peers"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	var config Config
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = yaml.UnmarshalStrict(content, &config)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	for _, network := range config.Networks {
+		if network.Name == "" {
+			return nil, fmt.Errorf("network without a name")
+		}
+		for _, target := range network.Targets {
+			if target.Labels == nil {
+				target.Labels = make(map[string]string)
+			}
+			target.Labels["network"] = network.Name
+			target.Timeouts = inheritTimeouts(target.Timeouts, network.Timeouts)
+			target.Intervals = inheritTimeouts(target.Intervals, network.Intervals)
+			target.Collectors = inheritCollectors(target.Collectors, network.Collectors)
+			target.ValidatorAliases = inheritAliases(target.ValidatorAliases, network.ValidatorAliases)
+			config.Targets = append(config.Targets, target)
+		}
+	}
+
+	// Discovered targets inherit the intervals and timeouts too
+	err = validateIntervals(config.Intervals)
+	if err != nil {
+		return nil, err
+	}
+	err = validateTimeouts(config.Timeouts)
+	if err != nil {
+		return nil, err
+	}
+	for i, target := range config.Targets {
+		if target.Endpoint == "" {
+			return nil, fmt.Errorf("target %d has no endpoint", i)
+		}
+		config.Targets[i].normalizeEndpoints()
+		if target.Name == "" {
+			config.Targets[i].Name = target.Endpoint
+		}
+		labels := make(map[string]string)
+		for name, value := range target.Labels {
+			if name != "network" {
+				labels[name] = value
+			}
+		}
+		err = validateLabels(labels)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %v", config.Targets[i].Name, err)
+		}
+		for name := range target.Collectors {
+			if !switchableCollectors[name] {
+				return nil, fmt.Errorf("target %s: unknown collector %q", config.Targets[i].Name, name)
+			}
+		}
+		if target.DataNode != nil {
+			_, err = dataNodeMetrics(target.DataNode.Queries)
+			if err != nil {
+				return nil, fmt.Errorf("target %s: %v", config.Targets[i].Name, err)
+			}
+		}
+		config.Targets[i].Timeouts = inheritTimeouts(target.Timeouts, config.Timeouts)
+		config.Targets[i].Intervals = inheritTimeouts(target.Intervals, config.Intervals)
+		err = validateIntervals(config.Targets[i].Intervals)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %v", config.Targets[i].Name, err)
+		}
+		err = validateTimeouts(config.Targets[i].Timeouts)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %v", config.Targets[i].Name, err)
+		}
+	}
+
+	return &config, nil
+}
+
+// normalizeEndpoints prepends a scheme to the bare host:port endpoints of the
+// target and of the services next to it.
+func (t *TargetConfig) normalizeEndpoints() {
+	t.Endpoint = normalizeEndpoint(t.Endpoint)
+	if t.DataNode != nil {
+		t.DataNode.Endpoint = normalizeEndpoint(t.DataNode.Endpoint)
+	}
+	if t.Ethereum != nil {
+		t.Ethereum.Endpoint = normalizeEndpoint(t.Ethereum.Endpoint)
+	}
+	for _, service := range []*ServiceConfig{t.BlockExplorer, t.Wallet, t.Faucet} {
+		if service != nil {
+			service.Endpoint = normalizeEndpoint(service.Endpoint)
+		}
+	}
+	if t.Reference != nil {
+		t.Reference.normalizeEndpoints()
+	}
+}
+
+// validateIntervals makes sure the intervals are of known collectors and
+// positive.
+func validateIntervals(intervals map[string]time.Duration) error {
+	for name, interval := range intervals {
+		if !knownCollector(name) {
+			return fmt.Errorf("interval of unknown collector %q", name)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("interval of %s must be positive", name)
+		}
+	}
+	return nil
+}
+
+// validateTimeouts makes sure the timeouts are of known collectors, of the
+// consistency check or the default, and positive.
+func validateTimeouts(timeouts map[string]time.Duration) error {
+	for name, timeout := range timeouts {
+		if name != "default" && name != "consistency" && !knownCollector(name) {
+			return fmt.Errorf("timeout of unknown collector %q", name)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("timeout of %s must be positive", name)
+		}
+	}
+	return nil
+}
+
+// inheritTimeouts returns the timeouts, or intervals, of own completed with
+// the defaults it doesn't set, and likewise for inheritCollectors and
+// inheritAliases.
+func inheritTimeouts(own, defaults map[string]time.Duration) map[string]time.Duration {
+	merged := make(map[string]time.Duration)
+	for name, value := range defaults {
+		merged[name] = value
+	}
+	for name, value := range own {
+		merged[name] = value
+	}
+	return merged
+}
+
+func inheritCollectors(own, defaults map[string]bool) map[string]bool {
+	merged := make(map[string]bool)
+	for name, value := range defaults {
+		merged[name] = value
+	}
+	for name, value := range own {
+		merged[name] = value
+	}
+	return merged
+}
+
+func inheritAliases(own, defaults map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for name, value := range defaults {
+		merged[name] = value
+	}
+	for name, value := range own {
+		merged[name] = value
+	}
+	return merged
+}
+
+// fileSDGroup is a target group of the Prometheus file_sd format.
+type fileSDGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// LoadTargetsFile reads targets from a JSON or YAML file in the Prometheus
+// file_sd format. Targets are host:port, or endpoints as in the config file,
+// and are named after the "node" label of their group when set, their address
+// otherwise. Names must be unique, so several targets of a group can't share a
+// "node" label. Labels starting with "__" are dropped, except "__scheme__"
+// which selects http or https.
+func LoadTargetsFile(path string, timeouts map[string]time.Duration) ([]TargetConfig, error) {
+	var groups []fileSDGroup
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is valid YAML
+	err = yaml.UnmarshalStrict(content, &groups)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	var targets []TargetConfig
+	names := make(map[string]bool)
+	for _, group := range groups {
+		scheme := "http"
+		labels := make(map[string]string)
+		for name, value := range group.Labels {
+			switch {
+			case name == "__scheme__":
+				scheme = value
+			case name == "node" || strings.HasPrefix(name, "__"):
+			default:
+				labels[name] = value
+			}
+		}
+		err = validateLabels(labels)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+
+		for _, address := range group.Targets {
+			target := TargetConfig{
+				Name:     group.Labels["node"],
+				Endpoint: address,
+				Labels:   labels,
+				Timeouts: timeouts,
+			}
+			if !strings.Contains(address, "://") && !strings.HasPrefix(address, srvEndpointPrefix) {
+				target.Endpoint = scheme + "://" + address
+			}
+			if target.Name == "" {
+				target.Name = address
+			}
+			if names[target.Name] {
+				return nil, fmt.Errorf("parsing %s: several targets named %s, list them in groups with their own node label", path, target.Name)
+			}
+			names[target.Name] = true
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+// validateLabels checks extra target labels, which can't replace the ones set
+// by the exporter.
+func validateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if name == "node" {
+			return fmt.Errorf("label %q is set by the exporter", name)
+		}
+	}
+	return nil
+}
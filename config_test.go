@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts map[string]time.Duration
+		err      bool
+	}{
+		{"none", nil, false},
+		{"known collectors", map[string]time.Duration{"default": time.Second, "status": time.Second, "datanode": time.Second}, false},
+		{"consistency check", map[string]time.Duration{"consistency": time.Second}, false},
+		{"unknown collector", map[string]time.Duration{"datanod": time.Second}, true},
+		{"zero", map[string]time.Duration{"status": 0}, true},
+		{"negative", map[string]time.Duration{"default": -time.Second}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateTimeouts(test.timeouts)
+			if (err != nil) != test.err {
+				t.Errorf("error = %v, want an error: %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestLoadTargetsFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		names []string
+		err   bool
+	}{
+		{"named targets", `[{"targets": ["a:1"], "labels": {"node": "alpha"}}, {"targets": ["b:1"], "labels": {"node": "beta"}}]`,
+			[]string{"alpha", "beta"}, false},
+		{"unnamed targets", `[{"targets": ["a:1", "b:1"]}]`, []string{"a:1", "b:1"}, false},
+		{"node label of several targets", `[{"targets": ["a:1", "b:1"], "labels": {"node": "alpha"}}]`, nil, true},
+		{"node label of two groups", `[{"targets": ["a:1"], "labels": {"node": "alpha"}}, {"targets": ["b:1"], "labels": {"node": "alpha"}}]`,
+			nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "targets.json")
+			if err := ioutil.WriteFile(path, []byte(test.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+			targets, err := LoadTargetsFile(path, nil)
+			if (err != nil) != test.err {
+				t.Fatalf("error = %v, want an error: %v", err, test.err)
+			}
+			var names []string
+			for _, target := range targets {
+				names = append(names, target.Name)
+			}
+			if !reflect.DeepEqual(names, test.names) {
+				t.Errorf("names = %q, want %q", names, test.names)
+			}
+		})
+	}
+}
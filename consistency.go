@@ -0,0 +1,247 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricEndpointConsistency = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "consistency"),
+		"Whether the block hash of the endpoint at the compared height is the one most endpoints of the chain report.",
+		[]string{"chain_id", "network", "node"}, nil,
+	)
+	metricEndpointHeightSpread = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "max_height_spread"),
+		"Difference between the highest and the lowest latest block height of the endpoints of the chain.",
+		[]string{"chain_id"}, nil,
+	)
+	metricEndpointComparedHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "endpoint", "compared_height"),
+		"Height at which the block hashes of the endpoints of the chain were last compared, --collector.consistency.depth blocks below their lowest latest height.",
+		[]string{"chain_id"}, nil,
+	)
+	metricForkDetected = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "fork", "detected"),
+		"Whether the endpoints of the chain report different block hashes at the compared height.",
+		[]string{"chain_id"}, nil,
+	)
+	metricForkBlockHashes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "fork", "block_hashes"),
+		"Number of distinct block hashes the endpoints of the chain report at the compared height.",
+		[]string{"chain_id"}, nil,
+	)
+)
+
+// consistencyChecker compares the endpoints of each chain on every scrape,
+// when several of them are configured: their latest heights, and their block
+// hashes at a recent height all of them have, which tell forks apart.
+// Endpoints are grouped by the chain ID of /status, whatever network they are
+// configured in.
+//
+// The chain and height of each endpoint are those of the last /status its
+// exporter read, so they follow its intervals. Block hashes are read within
+// the consistency timeout of the target.
+type consistencyChecker struct {
+	set *targetSet
+
+	mutex sync.Mutex
+	// Block hash of each endpoint at the height it was last compared at, by
+	// targetKey as names are only unique within a network
+	hashes map[string]endpointHash
+	// Endpoints and chains last reported inconsistent or forked, logged
+	// when that changes only
+	inconsistent map[string]bool
+	forked       map[string]bool
+}
+
+func newConsistencyChecker(set *targetSet) *consistencyChecker {
+	return &consistencyChecker{
+		set:          set,
+		hashes:       make(map[string]endpointHash),
+		inconsistent: make(map[string]bool),
+		forked:       make(map[string]bool),
+	}
+}
+
+type endpointHash struct {
+	height int64
+	hash   string
+}
+
+// endpointHead is the chain and latest height of an endpoint, and its block
+// hash at the compared height.
+type endpointHead struct {
+	exporter *Exporter
+	chainID  string
+	height   int64
+	hash     string
+	err      error
+}
+
+func (c *consistencyChecker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricEndpointConsistency
+	ch <- metricEndpointHeightSpread
+	ch <- metricEndpointComparedHeight
+	ch <- metricForkDetected
+	ch <- metricForkBlockHashes
+}
+
+func (c *consistencyChecker) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Unreachable endpoints are left out, vega_up reports them
+	chains := make(map[string][]*endpointHead)
+	for _, exporter := range c.set.list() {
+		chainID, height := exporter.head()
+		if chainID == "" {
+			continue
+		}
+		chains[chainID] = append(chains[chainID], &endpointHead{exporter: exporter, chainID: chainID, height: height})
+	}
+	for chainID, heads := range chains {
+		if len(heads) > 1 {
+			c.compare(ch, chainID, heads)
+		}
+	}
+}
+
+// compare exports the height spread of the endpoints of a chain, whether
+// their block hashes differ at the compared height, and whether each of them
+// agrees with the majority.
+func (c *consistencyChecker) compare(ch chan<- prometheus.Metric, chainID string, heads []*endpointHead) {
+	lowest, highest := heads[0].height, heads[0].height
+	for _, head := range heads {
+		if head.height < lowest {
+			lowest = head.height
+		}
+		if head.height > highest {
+			highest = head.height
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricEndpointHeightSpread, prometheus.GaugeValue, float64(highest-lowest), chainID,
+	)
+
+	// Below the tips, the hashes don't depend on which endpoint committed the
+	// latest block first
+	height := lowest - int64(*consistencyDepth)
+	if height < 1 {
+		height = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricEndpointComparedHeight, prometheus.GaugeValue, float64(height), chainID,
+	)
+
+	// Block hashes don't change, an endpoint is only asked again once the
+	// compared height moved
+	forEachHead(heads, func(head *endpointHead) {
+		if known, ok := c.hashes[head.exporter.key()]; ok && known.height == height {
+			head.hash = known.hash
+			return
+		}
+		ctx, cancel := head.exporter.timeoutContext("consistency")
+		defer cancel()
+		head.hash, _, head.err = blockHashes(ctx, head.exporter.rpc, height)
+	})
+	for _, head := range heads {
+		if head.err == nil {
+			c.hashes[head.exporter.key()] = endpointHash{height: height, hash: head.hash}
+		}
+	}
+	votes := make(map[string]int)
+	answered := 0
+	for _, head := range heads {
+		if head.err == nil {
+			votes[head.hash]++
+			answered++
+		}
+	}
+	if answered > 1 {
+		var forked float64
+		if len(votes) > 1 {
+			forked = 1
+			if !c.forked[chainID] {
+				logErrorf("Fork of %s at height %d: the endpoints report %d block hashes", chainID, height, len(votes))
+			}
+		}
+		c.forked[chainID] = forked == 1
+		ch <- prometheus.MustNewConstMetric(
+			metricForkDetected, prometheus.GaugeValue, forked, chainID,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricForkBlockHashes, prometheus.GaugeValue, float64(len(votes)), chainID,
+		)
+	}
+	// Without a strict majority, like two endpoints that disagree, none of
+	// them can be trusted
+	var majority string
+	for hash, count := range votes {
+		if count*2 > len(heads) {
+			majority = hash
+		}
+	}
+
+	for _, head := range heads {
+		name, key := head.exporter.name, head.exporter.key()
+		if head.err != nil {
+			logDebugf("Consistency check of %s at height %d: %v", name, height, head.err)
+			continue
+		}
+		var consistent float64
+		if majority != "" && head.hash == majority {
+			consistent = 1
+		} else if !c.inconsistent[key] {
+			logWarnf("%s has block hash %s at height %d of %s, the majority has %q", name, head.hash, height, chainID, majority)
+		}
+		c.inconsistent[key] = consistent == 0
+		ch <- prometheus.MustNewConstMetric(
+			metricEndpointConsistency, prometheus.GaugeValue, consistent, chainID, head.exporter.network, name,
+		)
+	}
+}
+
+// key is the targetKey of the target of the exporter.
+func (e *Exporter) key() string {
+	return targetKey(TargetConfig{Name: e.name, Labels: map[string]string{"network": e.network}})
+}
+
+// head returns the chain ID and latest height of the last /status of the
+// exporter, an empty chain ID when it failed or wasn't read yet.
+func (e *Exporter) head() (string, int64) {
+	e.headMutex.Lock()
+	defer e.headMutex.Unlock()
+	return e.headChainID, e.headHeight
+}
+
+// recordHead keeps the chain ID and latest height of a /status.
+func (e *Exporter) recordHead(status VegaStatus, err error) {
+	var chainID string
+	var height int64
+	if err == nil {
+		chainID = status.Result.NodeInfo.Network
+		height, err = strconv.ParseInt(status.Result.SyncInfo.LatestBlockHeight, 10, 64)
+		if err != nil {
+			chainID = ""
+		}
+	}
+	e.headMutex.Lock()
+	defer e.headMutex.Unlock()
+	e.headChainID, e.headHeight = chainID, height
+}
+
+// forEachHead calls f for every endpoint concurrently.
+func forEachHead(heads []*endpointHead, f func(*endpointHead)) {
+	var wg sync.WaitGroup
+	for _, head := range heads {
+		wg.Add(1)
+		go func(head *endpointHead) {
+			defer wg.Done()
+			f(head)
+		}(head)
+	}
+	wg.Wait()
+}
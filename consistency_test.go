@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestConsistencyChecker(t *testing.T) {
+	hashes := []string{"AA", "AA", "BB"}
+	set := newTargetSet()
+	var requests int64
+	for i, hash := range hashes {
+		hash := hash
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&requests, 1)
+			fmt.Fprintf(w, `{"result": {"block_metas": [{"block_id": {"hash": %q}}]}}`, hash)
+		}))
+		defer server.Close()
+		e := &Exporter{name: fmt.Sprintf("node-%d", i), rpc: NewRPCClient(server.URL, nil)}
+		e.headChainID, e.headHeight = "chain", int64(10+i)
+		set.exporters[e.name] = e
+	}
+	// Without /status, an endpoint is left out
+	set.exporters["down"] = &Exporter{name: "down"}
+	c := newConsistencyChecker(set)
+
+	for scrape := 0; scrape < 2; scrape++ {
+		ch := make(chan prometheus.Metric, 100)
+		c.Collect(ch)
+		close(ch)
+		values := make(map[string]float64)
+		for metric := range ch {
+			key, value := metricKey(t, metric)
+			values[key] = value
+		}
+		want := map[string]float64{
+			`vega_endpoint_max_height_spread{chain_id="chain"}`:                    2,
+			`vega_endpoint_compared_height{chain_id="chain"}`:                      10,
+			`vega_fork_detected{chain_id="chain"}`:                                 1,
+			`vega_fork_block_hashes{chain_id="chain"}`:                             2,
+			`vega_endpoint_consistency{chain_id="chain",network="",node="node-0"}`: 1,
+			`vega_endpoint_consistency{chain_id="chain",network="",node="node-1"}`: 1,
+			`vega_endpoint_consistency{chain_id="chain",network="",node="node-2"}`: 0,
+		}
+		if len(values) != len(want) {
+			t.Errorf("scrape %d: got %v, want %v", scrape, values, want)
+		}
+		for key, value := range want {
+			if got, ok := values[key]; !ok || got != value {
+				t.Errorf("scrape %d: %s = %v, want %v", scrape, key, got, value)
+			}
+		}
+	}
+	// The hashes at the compared height are read once
+	if requests != int64(len(hashes)) {
+		t.Errorf("%d requests, want %d", requests, len(hashes))
+	}
+}
+
+func TestConsistencyCheckerSameNames(t *testing.T) {
+	// Both networks name their targets alike, their chains share the
+	// compared height
+	networks := []struct {
+		network, chainID, hash string
+		nodes                  []string
+	}{
+		{"mainnet", "chain-a", "AA", []string{"node-0", "node-1"}},
+		{"testnet", "chain-b", "BB", []string{"node-0", "node-1", "node-2"}},
+	}
+	set := newTargetSet()
+	var requests int64
+	for _, network := range networks {
+		hash := network.hash
+		for _, name := range network.nodes {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt64(&requests, 1)
+				fmt.Fprintf(w, `{"result": {"block_metas": [{"block_id": {"hash": %q}}]}}`, hash)
+			}))
+			defer server.Close()
+			e := &Exporter{name: name, network: network.network, rpc: NewRPCClient(server.URL, nil)}
+			e.headChainID, e.headHeight = network.chainID, 10
+			set.exporters[e.key()] = e
+		}
+	}
+	c := newConsistencyChecker(set)
+
+	for scrape := 0; scrape < 2; scrape++ {
+		ch := make(chan prometheus.Metric, 100)
+		c.Collect(ch)
+		close(ch)
+		values := make(map[string]float64)
+		for metric := range ch {
+			key, value := metricKey(t, metric)
+			values[key] = value
+		}
+		for _, network := range networks {
+			key := fmt.Sprintf(`vega_fork_detected{chain_id=%q}`, network.chainID)
+			if values[key] != 0 {
+				t.Errorf("scrape %d: %s = %v, want 0", scrape, key, values[key])
+			}
+			for _, name := range network.nodes {
+				key := fmt.Sprintf(`vega_endpoint_consistency{chain_id=%q,network=%q,node=%q}`, network.chainID, network.network, name)
+				if values[key] != 1 {
+					t.Errorf("scrape %d: %s = %v, want 1", scrape, key, values[key])
+				}
+			}
+		}
+	}
+	// Each endpoint is asked once for its own hash
+	if requests != 5 {
+		t.Errorf("%d requests, want 5", requests)
+	}
+}
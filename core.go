@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Vega core gRPC methods. The exporter doesn't depend on the Vega protobuf
+// packages: requests are empty messages and the few fields we need are read
+// straight from the wire format.
+const coreStatisticsMethod = "/vega.api.v1.CoreService/Statistics"
+const coreVegaTimeMethod = "/vega.api.v1.CoreService/GetVegaTime"
+
+// Field numbers of vega.api.v1.Statistics. Neither Statistics nor the other
+// CoreService methods report the state of the event forwarder.
+const (
+	coreStatBlockHeight    = 1
+	coreStatBacklogLength  = 2
+	coreStatTotalPeers     = 3
+	coreStatVegaTime       = 6
+	coreStatStatus         = 7
+	coreStatTxPerBlock     = 8
+	coreStatAverageTxBytes = 9
+	coreStatTotalMarkets   = 13
+)
+
+var (
+	metricCoreUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "core", "up"),
+		"Was the last Vega core gRPC query successful.",
+		nil, nil,
+	)
+	metricCoreBlockHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "core", "block_height"),
+		"Block height according to Vega core.",
+		nil, nil,
+	)
+	metricCoreBacklogLength = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "core", "backlog_length"),
+		"Number of transactions waiting in the Vega core backlog.",
+		nil, nil,
+	)
+	metricCoreTotalPeers = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "core", "total_peers"),
+		"Number of peers reported by Vega core.",
+		nil, nil,
+	)
+	metricCoreChainStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "core", "chain_status"),
+		"Chain status reported by Vega core (0 unspecified, 1 disconnected, 2 replaying, 3 connected).",
+		nil, nil,
+	)
+	metricCoreTxPerBlock = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "core", "tx_per_block"),
+		"Average number of transactions per block.",
+		nil, nil,
+	)
+	metricCoreAverageTxBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "core", "average_tx_bytes"),
+		"Average transaction size in bytes.",
+		nil, nil,
+	)
+	metricCoreTotalMarkets = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "core", "total_markets"),
+		"Number of markets known to Vega core.",
+		nil, nil,
+	)
+	metricCoreVegaTime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "core", "vega_time_seconds"),
+		"Internal Vega time as a unix timestamp.",
+		nil, nil,
+	)
+	metricCoreVegaTimeDrift = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "core", "vega_time_drift_seconds"),
+		"Difference between the exporter clock and the internal Vega time.",
+		nil, nil,
+	)
+)
+
+// CoreGRPCConfig configures the optional Vega core gRPC collector.
+type CoreGRPCConfig struct {
+	Address            string        `yaml:"address"`
+	TLS                bool          `yaml:"tls"`
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"`
+	Timeout            time.Duration `yaml:"timeout"`
+}
+
+// rawCodec passes already encoded protobuf messages through to gRPC. It
+// registers under the "proto" name so the server sees a regular request.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *(v.(*[]byte)), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]byte)) = data
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+type CoreCollector struct {
+	config CoreGRPCConfig
+	conn   *grpc.ClientConn
+}
+
+func NewCoreCollector(config CoreGRPCConfig) (*CoreCollector, error) {
+	transportCredentials := grpc.WithInsecure()
+	if config.TLS {
+		transportCredentials = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			InsecureSkipVerify: config.InsecureSkipVerify,
+		}))
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	// Dialing is non-blocking, connection errors surface on the first call.
+	conn, err := grpc.Dial(config.Address, transportCredentials, grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+		return dialContext(ctx, "tcp", address)
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CoreCollector{config: config, conn: conn}, nil
+}
+
+func (c *CoreCollector) Close() error {
+	return c.conn.Close()
+}
+
+func (c *CoreCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricCoreUp
+	ch <- metricCoreBlockHeight
+	ch <- metricCoreBacklogLength
+	ch <- metricCoreTotalPeers
+	ch <- metricCoreChainStatus
+	ch <- metricCoreTxPerBlock
+	ch <- metricCoreAverageTxBytes
+	ch <- metricCoreTotalMarkets
+	ch <- metricCoreVegaTime
+	ch <- metricCoreVegaTimeDrift
+}
+
+func (c *CoreCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	err := c.update(ctx, ch)
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(
+			metricCoreUp, prometheus.GaugeValue, 0,
+		)
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricCoreUp, prometheus.GaugeValue, 1,
+	)
+	return nil
+}
+
+func (c *CoreCollector) update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	statistics, err := c.invoke(ctx, coreStatisticsMethod)
+	if err != nil {
+		return fmt.Errorf("core statistics: %v", err)
+	}
+	// StatisticsResponse wraps the Statistics message in field 1.
+	fields, err := parseProtoFields(statistics)
+	if err != nil {
+		return fmt.Errorf("core statistics: %v", err)
+	}
+	fields, err = parseProtoFields(fields[1].bytes)
+	if err != nil {
+		return fmt.Errorf("core statistics: %v", err)
+	}
+
+	gauges := []struct {
+		desc  *prometheus.Desc
+		field protowire.Number
+	}{
+		{metricCoreBlockHeight, coreStatBlockHeight},
+		{metricCoreBacklogLength, coreStatBacklogLength},
+		{metricCoreTotalPeers, coreStatTotalPeers},
+		{metricCoreChainStatus, coreStatStatus},
+		{metricCoreTxPerBlock, coreStatTxPerBlock},
+		{metricCoreAverageTxBytes, coreStatAverageTxBytes},
+		{metricCoreTotalMarkets, coreStatTotalMarkets},
+	}
+	for _, gauge := range gauges {
+		ch <- prometheus.MustNewConstMetric(
+			gauge.desc, prometheus.GaugeValue, float64(fields[gauge.field].varint),
+		)
+	}
+
+	// GetVegaTimeResponse holds the time in nanoseconds in field 1. Older
+	// cores only report it as an RFC3339 string in the statistics.
+	var vegaTime time.Time
+	timeResponse, err := c.invoke(ctx, coreVegaTimeMethod)
+	if err == nil {
+		timeFields, err := parseProtoFields(timeResponse)
+		if err != nil {
+			return fmt.Errorf("core vega time: %v", err)
+		}
+		vegaTime = time.Unix(0, int64(timeFields[1].varint))
+	} else {
+		vegaTime, err = time.Parse(time.RFC3339Nano, string(fields[coreStatVegaTime].bytes))
+		if err != nil {
+			return fmt.Errorf("core vega time: %v", err)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		metricCoreVegaTime, prometheus.GaugeValue, float64(vegaTime.UnixNano())/1e9,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricCoreVegaTimeDrift, prometheus.GaugeValue, time.Since(vegaTime).Seconds(),
+	)
+
+	return nil
+}
+
+// invoke calls a core method with an empty request and returns the raw
+// response message.
+func (c *CoreCollector) invoke(ctx context.Context, method string) ([]byte, error) {
+	request := []byte{}
+	var response []byte
+	err := c.conn.Invoke(ctx, method, &request, &response, grpc.ForceCodec(rawCodec{}))
+	return response, err
+}
+
+// protoField holds the last value seen for a protobuf field number.
+type protoField struct {
+	varint uint64
+	bytes  []byte
+}
+
+// parseProtoFields decodes the top level fields of a protobuf message. Only
+// varint and length-delimited fields are kept, which covers every field the
+// core collector reads.
+func parseProtoFields(message []byte) (map[protowire.Number]protoField, error) {
+	fields := make(map[protowire.Number]protoField)
+	for len(message) > 0 {
+		number, wireType, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		var field protoField
+		switch wireType {
+		case protowire.VarintType:
+			field.varint, n = protowire.ConsumeVarint(message)
+		case protowire.BytesType:
+			field.bytes, n = protowire.ConsumeBytes(message)
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, message)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		if wireType == protowire.VarintType || wireType == protowire.BytesType {
+			fields[number] = field
+		}
+	}
+	return fields, nil
+}
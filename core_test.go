@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestParseProtoFields(t *testing.T) {
+	varint := func(number protowire.Number, value uint64) []byte {
+		b := protowire.AppendTag(nil, number, protowire.VarintType)
+		return protowire.AppendVarint(b, value)
+	}
+	bytesField := func(number protowire.Number, value []byte) []byte {
+		b := protowire.AppendTag(nil, number, protowire.BytesType)
+		return protowire.AppendBytes(b, value)
+	}
+	fixed := func(number protowire.Number, value uint64) []byte {
+		b := protowire.AppendTag(nil, number, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, value)
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	tests := []struct {
+		name    string
+		message []byte
+		varints map[protowire.Number]uint64
+		bytes   map[protowire.Number]string
+		err     bool
+	}{
+		{"empty", nil, nil, nil, false},
+		{"varint and bytes", join(varint(coreStatBlockHeight, 1234), bytesField(coreStatVegaTime, []byte("2023-01-01T00:00:00Z"))),
+			map[protowire.Number]uint64{coreStatBlockHeight: 1234}, map[protowire.Number]string{coreStatVegaTime: "2023-01-01T00:00:00Z"}, false},
+		{"other wire types are skipped", join(fixed(2, 7), varint(3, 8)), map[protowire.Number]uint64{3: 8}, nil, false},
+		{"last value wins", join(varint(1, 1), varint(1, 2)), map[protowire.Number]uint64{1: 2}, nil, false},
+		{"nested message", bytesField(1, varint(2, 3)), nil, map[protowire.Number]string{1: string(varint(2, 3))}, false},
+		{"truncated varint", []byte{0x08, 0x80}, nil, nil, true},
+		{"truncated bytes", join(protowire.AppendTag(nil, 1, protowire.BytesType), []byte{5, 'a'}), nil, nil, true},
+		{"invalid tag", []byte{0x00}, nil, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, err := parseProtoFields(test.message)
+			if (err != nil) != test.err {
+				t.Fatalf("error = %v, want an error: %v", err, test.err)
+			}
+			if test.err {
+				return
+			}
+			if len(fields) != len(test.varints)+len(test.bytes) {
+				t.Errorf("fields = %v, want %v and %v", fields, test.varints, test.bytes)
+			}
+			for number, value := range test.varints {
+				if fields[number].varint != value {
+					t.Errorf("field %d = %d, want %d", number, fields[number].varint, value)
+				}
+			}
+			for number, value := range test.bytes {
+				if string(fields[number].bytes) != value {
+					t.Errorf("field %d = %q, want %q", number, fields[number].bytes, value)
+				}
+			}
+		})
+	}
+}
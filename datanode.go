@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+var (
+	metricDataNodeQueryUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datanode", "query_up"),
+		"Was the last data-node query successful (per query).",
+		[]string{"query"}, nil,
+	)
+	metricDataNodeQueryErrors = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datanode", "query_errors_total"),
+		"Number of failed data-node queries (per query).",
+		[]string{"query"}, nil,
+	)
+	metricDataNodeQueryDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datanode", "query_duration_seconds"),
+		"Duration of the last data-node query (per query).",
+		[]string{"query"}, nil,
+	)
+)
+
+// Names of the built-in vega_datanode_* metrics, which query metrics can't
+// take
+var dataNodeReservedMetrics = map[string]bool{
+	"query_up":                true,
+	"query_errors_total":      true,
+	"query_duration_seconds":  true,
+	"events_up":               true,
+	"events_reconnects_total": true,
+}
+
+// DataNodeConfig configures the data-node collector of a target.
+type DataNodeConfig struct {
+	Endpoint string            `yaml:"endpoint"`
+	Headers  map[string]string `yaml:"headers"`
+	// Default timeout of queries that don't set their own
+	Timeout time.Duration   `yaml:"timeout"`
+	Queries []DataNodeQuery `yaml:"queries"`
+	// Vega public key of the validator, whose votes on the open proposals
+	// and fee rewards are reported
+	Party string `yaml:"party"`
+}
+
+// DataNodeQuery is a single REST or GraphQL request and the metrics read from
+// its JSON response.
+type DataNodeQuery struct {
+	Name string `yaml:"name"`
+	// REST path, or the GraphQL endpoint path when GraphQL is set
+	Path    string           `yaml:"path"`
+	GraphQL string           `yaml:"graphql"`
+	Timeout time.Duration    `yaml:"timeout"`
+	Metrics []DataNodeMetric `yaml:"metrics"`
+}
+
+// DataNodeMetric maps a part of a query response to a metric. Paths are dot
+// separated keys (or array indexes) into the JSON response and label paths
+// are resolved from the response root. When Each is set, Path must select an
+// array and a sample is exported per element, with Each and the label paths
+// relative to the element.
+type DataNodeMetric struct {
+	Name   string            `yaml:"name"`
+	Help   string            `yaml:"help"`
+	Type   string            `yaml:"type"`
+	Path   string            `yaml:"path"`
+	Each   string            `yaml:"each"`
+	Count  bool              `yaml:"count"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+type dataNodeMetric struct {
+	config     DataNodeMetric
+	desc       *prometheus.Desc
+	valueType  prometheus.ValueType
+	labelNames []string
+}
+
+type DataNodeCollector struct {
+	client  *DataNodeClient
+	config  DataNodeConfig
+	metrics map[string][]dataNodeMetric
+
+	mutex  sync.Mutex
+	errors map[string]float64
+}
+
+func NewDataNodeCollector(client *DataNodeClient, config DataNodeConfig) (*DataNodeCollector, error) {
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	metrics, err := dataNodeMetrics(config.Queries)
+	if err != nil {
+		return nil, err
+	}
+	return &DataNodeCollector{
+		client:  client,
+		config:  config,
+		metrics: metrics,
+		errors:  make(map[string]float64),
+	}, nil
+}
+
+// dataNodeMetrics returns the metrics of each query, or why the queries are
+// invalid.
+func dataNodeMetrics(queries []DataNodeQuery) (map[string][]dataNodeMetric, error) {
+	byQuery := make(map[string][]dataNodeMetric)
+	// Query of each metric name, the registry would reject the collector
+	// otherwise
+	names := make(map[string]string)
+	for _, query := range queries {
+		if query.Name == "" {
+			return nil, fmt.Errorf("data-node query without name")
+		}
+		if _, ok := byQuery[query.Name]; ok {
+			return nil, fmt.Errorf("duplicate data-node query %s", query.Name)
+		}
+		if query.Path == "" && query.GraphQL == "" {
+			return nil, fmt.Errorf("data-node query %s has neither path nor graphql", query.Name)
+		}
+
+		metrics := []dataNodeMetric{}
+		for _, metric := range query.Metrics {
+			if other, ok := names[metric.Name]; ok {
+				return nil, fmt.Errorf("data-node metric %s of query %s is already exported by query %s", metric.Name, query.Name, other)
+			}
+			names[metric.Name] = query.Name
+			fqName := prometheus.BuildFQName(namespace, "datanode", metric.Name)
+			if !model.IsValidMetricName(model.LabelValue(fqName)) {
+				return nil, fmt.Errorf("data-node metric %q of query %s: invalid metric name %s", metric.Name, query.Name, fqName)
+			}
+			if dataNodeReservedMetrics[metric.Name] {
+				return nil, fmt.Errorf("data-node metric %s of query %s: %s is a built-in metric", metric.Name, query.Name, fqName)
+			}
+			valueType := prometheus.GaugeValue
+			switch metric.Type {
+			case "", "gauge":
+			case "counter":
+				valueType = prometheus.CounterValue
+			default:
+				return nil, fmt.Errorf("data-node metric %s: unknown type %q", metric.Name, metric.Type)
+			}
+
+			var labelNames []string
+			for name := range metric.Labels {
+				if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+					return nil, fmt.Errorf("data-node metric %s: invalid label name %q", metric.Name, name)
+				}
+				labelNames = append(labelNames, name)
+			}
+			sort.Strings(labelNames)
+
+			help := metric.Help
+			if help == "" {
+				help = fmt.Sprintf("Value of %s from data-node query %s.", metric.Path, query.Name)
+			}
+			metrics = append(metrics, dataNodeMetric{
+				config:     metric,
+				desc:       prometheus.NewDesc(fqName, help, labelNames, nil),
+				valueType:  valueType,
+				labelNames: labelNames,
+			})
+		}
+		byQuery[query.Name] = metrics
+	}
+	return byQuery, nil
+}
+
+func (c *DataNodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricDataNodeQueryUp
+	ch <- metricDataNodeQueryErrors
+	ch <- metricDataNodeQueryDuration
+	for _, metrics := range c.metrics {
+		for _, metric := range metrics {
+			ch <- metric.desc
+		}
+	}
+}
+
+// Update runs all queries concurrently. A failing query is reported through
+// the query metrics and doesn't prevent the others from being exported.
+func (c *DataNodeCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var wg sync.WaitGroup
+	var failed []string
+	var failedMutex sync.Mutex
+
+	for _, query := range c.config.Queries {
+		wg.Add(1)
+		go func(query DataNodeQuery) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := c.runQuery(ctx, query, ch)
+			duration := time.Since(start).Seconds()
+
+			up := 1.0
+			c.mutex.Lock()
+			if err != nil {
+				up = 0
+				c.errors[query.Name]++
+				failedMutex.Lock()
+				failed = append(failed, fmt.Sprintf("%s: %v", query.Name, err))
+				failedMutex.Unlock()
+			}
+			errors := c.errors[query.Name]
+			c.mutex.Unlock()
+
+			ch <- prometheus.MustNewConstMetric(
+				metricDataNodeQueryUp, prometheus.GaugeValue, up, query.Name,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				metricDataNodeQueryErrors, prometheus.CounterValue, errors, query.Name,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				metricDataNodeQueryDuration, prometheus.GaugeValue, duration, query.Name,
+			)
+		}(query)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("data-node queries failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// queryTimeout returns the timeout of a query, the default of the collector
+// when it doesn't set one.
+func (c *DataNodeCollector) queryTimeout(query DataNodeQuery) time.Duration {
+	if query.Timeout == 0 {
+		return c.config.Timeout
+	}
+	return query.Timeout
+}
+
+func (c *DataNodeCollector) runQuery(ctx context.Context, query DataNodeQuery, ch chan<- prometheus.Metric) error {
+	ctx, cancel := context.WithTimeout(ctx, c.queryTimeout(query))
+	defer cancel()
+
+	var response interface{}
+	var err error
+	if query.GraphQL != "" {
+		path := query.Path
+		if path == "" {
+			path = "/graphql"
+		}
+		response, err = c.client.GraphQL(ctx, path, query.GraphQL)
+	} else {
+		err = c.client.Get(ctx, query.Path, &response)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Samples are only sent once the whole response was mapped, so a query
+	// never exports half of its metrics.
+	var samples []prometheus.Metric
+	for _, metric := range c.metrics[query.Name] {
+		metricSamples, err := metric.samples(response)
+		if err != nil {
+			return fmt.Errorf("metric %s: %v", metric.config.Name, err)
+		}
+		samples = append(samples, metricSamples...)
+	}
+	for _, sample := range samples {
+		ch <- sample
+	}
+
+	return nil
+}
+
+// samples maps a query response to the samples of the metric.
+func (m dataNodeMetric) samples(response interface{}) ([]prometheus.Metric, error) {
+	selected, err := jsonLookup(response, m.config.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.config.Each == "" {
+		sample, err := m.sample(response, selected, m.config.Count)
+		if err != nil {
+			return nil, err
+		}
+		return []prometheus.Metric{sample}, nil
+	}
+
+	elements, ok := selected.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not an array", m.config.Path)
+	}
+	var samples []prometheus.Metric
+	for _, element := range elements {
+		value, err := jsonLookup(element, m.config.Each)
+		if err != nil {
+			return nil, err
+		}
+		sample, err := m.sample(element, value, m.config.Count)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// sample builds a single sample, resolving label paths relative to base.
+func (m dataNodeMetric) sample(base interface{}, value interface{}, count bool) (prometheus.Metric, error) {
+	var number float64
+	var err error
+	if count {
+		switch v := value.(type) {
+		case []interface{}:
+			number = float64(len(v))
+		case map[string]interface{}:
+			number = float64(len(v))
+		default:
+			return nil, fmt.Errorf("cannot count %T", value)
+		}
+	} else {
+		number, err = jsonNumber(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var labelValues []string
+	for _, name := range m.labelNames {
+		value, err := jsonLookup(base, m.config.Labels[name])
+		if err != nil {
+			return nil, err
+		}
+		labelValues = append(labelValues, labelValue(fmt.Sprintf("%v", value)))
+	}
+
+	return prometheus.NewConstMetric(m.desc, m.valueType, number, labelValues...)
+}
+
+// jsonLookup follows a dot separated path of object keys and array indexes.
+// An empty path selects the value itself.
+func jsonLookup(value interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return value, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found in %s", key, path)
+			}
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("invalid index %q in %s", key, path)
+			}
+			value = v[index]
+		default:
+			return nil, fmt.Errorf("cannot select %q from %T in %s", key, value, path)
+		}
+	}
+	return value, nil
+}
+
+// jsonNumber converts a JSON value to a sample value. Vega encodes large
+// numbers as strings and timestamps as RFC3339 strings, both are accepted.
+func jsonNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+		if err == nil {
+			return number, nil
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, v)
+		if err == nil {
+			return float64(timestamp.UnixNano()) / 1e9, nil
+		}
+		return 0, fmt.Errorf("cannot convert %q to a number", v)
+	default:
+		return 0, fmt.Errorf("cannot convert %T to a number", value)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// DataNodeClient performs REST and GraphQL requests against a Vega data node.
+type DataNodeClient struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func NewDataNodeClient(endpoint string, headers map[string]string) *DataNodeClient {
+	return &DataNodeClient{
+		endpoint: endpoint,
+		headers:  headers,
+		client:   hostClient(headers),
+	}
+}
+
+// Get performs a REST query and decodes the JSON response into v, unless v
+// is nil.
+func (c *DataNodeClient) Get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, v)
+}
+
+// GraphQL posts a GraphQL query and checks the response for errors.
+func (c *DataNodeClient) GraphQL(ctx context.Context, path string, query string) (interface{}, error) {
+	payload, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var response interface{}
+	err = c.do(req, &response)
+	if err != nil {
+		return nil, err
+	}
+	if object, ok := response.(map[string]interface{}); ok {
+		if errors, ok := object["errors"].([]interface{}); ok && len(errors) > 0 {
+			return nil, fmt.Errorf("graphql errors: %v", errors)
+		}
+	}
+	return response, nil
+}
+
+func (c *DataNodeClient) do(req *http.Request, v interface{}) (err error) {
+	_, span := startSpan(req.Context(), req.Method+" "+req.URL.Path, spanKindClient)
+	span.setAttribute("http.url", endpointLabel(req.URL.String()))
+	defer func() { span.finish(err) }()
+
+	setHeaders(req, c.headers)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	body, err := readBody(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
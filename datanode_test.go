@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDataNodeMetrics(t *testing.T) {
+	metric := func(name string) DataNodeMetric {
+		return DataNodeMetric{Name: name, Path: "a"}
+	}
+	tests := []struct {
+		name    string
+		queries []DataNodeQuery
+		err     bool
+	}{
+		{"valid", []DataNodeQuery{
+			{Name: "a", Path: "/a", Metrics: []DataNodeMetric{metric("x"), metric("y")}},
+			{Name: "b", GraphQL: "{ b }", Metrics: []DataNodeMetric{metric("z")}},
+		}, false},
+		{"query without name", []DataNodeQuery{{Path: "/a"}}, true},
+		{"duplicate query", []DataNodeQuery{{Name: "a", Path: "/a"}, {Name: "a", Path: "/b"}}, true},
+		{"query without path", []DataNodeQuery{{Name: "a"}}, true},
+		{"unknown type", []DataNodeQuery{{Name: "a", Path: "/a", Metrics: []DataNodeMetric{{Name: "x", Type: "summary"}}}}, true},
+		{"duplicate metric in a query", []DataNodeQuery{
+			{Name: "a", Path: "/a", Metrics: []DataNodeMetric{metric("x"), metric("x")}},
+		}, true},
+		{"duplicate metric across queries", []DataNodeQuery{
+			{Name: "a", Path: "/a", Metrics: []DataNodeMetric{metric("x")}},
+			{Name: "b", Path: "/b", Metrics: []DataNodeMetric{metric("x")}},
+		}, true},
+		{"metric without name", []DataNodeQuery{{Name: "a", Path: "/a", Metrics: []DataNodeMetric{metric("")}}}, true},
+		{"invalid metric name", []DataNodeQuery{{Name: "a", Path: "/a", Metrics: []DataNodeMetric{metric("open-markets")}}}, true},
+		{"built-in metric name", []DataNodeQuery{{Name: "a", Path: "/a", Metrics: []DataNodeMetric{metric("query_up")}}}, true},
+		{"built-in events metric name", []DataNodeQuery{{Name: "a", Path: "/a", Metrics: []DataNodeMetric{metric("events_reconnects_total")}}}, true},
+		{"invalid label name", []DataNodeQuery{{Name: "a", Path: "/a", Metrics: []DataNodeMetric{
+			{Name: "x", Path: "a", Labels: map[string]string{"market-id": "id"}},
+		}}}, true},
+		{"reserved label name", []DataNodeQuery{{Name: "a", Path: "/a", Metrics: []DataNodeMetric{
+			{Name: "x", Path: "a", Labels: map[string]string{"__name__": "id"}},
+		}}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := dataNodeMetrics(test.queries)
+			if (err != nil) != test.err {
+				t.Errorf("error = %v, want an error: %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestJSONLookup(t *testing.T) {
+	var document interface{}
+	err := json.Unmarshal([]byte(`{"markets": {"edges": [{"node": {"id": "m1"}}, {"node": {"id": "m2"}}]}, "count": 2}`), &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want interface{}
+		err  bool
+	}{
+		{"count", 2.0, false},
+		{"markets.edges.1.node.id", "m2", false},
+		{"markets.edges.0.node", map[string]interface{}{"id": "m1"}, false},
+		{"", document, false},
+		{"missing", nil, true},
+		{"markets.edges.2", nil, true},
+		{"markets.edges.-1", nil, true},
+		{"markets.edges.first", nil, true},
+		{"count.value", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			got, err := jsonLookup(document, test.path)
+			if (err != nil) != test.err {
+				t.Fatalf("error = %v, want an error: %v", err, test.err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("jsonLookup = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestJSONNumber(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  float64
+		err   bool
+	}{
+		{"number", 1.5, 1.5, false},
+		{"true", true, 1, false},
+		{"false", false, 0, false},
+		{"string number", "123456789012345678901234", 123456789012345678901234, false},
+		{"timestamp", "2023-01-01T00:00:01.5Z", 1672531201.5, false},
+		{"text", "active", 0, true},
+		{"object", map[string]interface{}{}, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := jsonNumber(test.value)
+			if (err != nil) != test.err {
+				t.Fatalf("error = %v, want an error: %v", err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("jsonNumber = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const decodeSamplesPath = "/debug/decode-errors"
+
+// Bytes of an offending payload kept by --debug.decode-samples
+const decodeSampleMaxBytes = 4096
+
+var metricRPCDecodeErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "decode_errors_total",
+		Help:      "Number of RPC responses that couldn't be decoded, by RPC path.",
+	},
+	[]string{"endpoint", "path"},
+)
+
+var metricRPCUnknownFields = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "unknown_fields_total",
+		Help:      "Number of RPC responses with a field the exporter doesn't know, checked with --rpc.strict-decoding, by RPC path and field path.",
+	},
+	[]string{"endpoint", "path", "field"},
+)
+
+// unknownFields returns the paths of the keys of a JSON response that no
+// field of v declares, like result.validators.pub_key.type. Keys of maps are
+// data rather than fields, they don't show up in the paths.
+func unknownFields(body []byte, v interface{}) []string {
+	var document interface{}
+	if json.Unmarshal(body, &document) != nil {
+		return nil
+	}
+	found := make(map[string]bool)
+	walkUnknownFields(document, reflect.TypeOf(v), "", found)
+	fields := make([]string, 0, len(found))
+	for field := range found {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func walkUnknownFields(value interface{}, t reflect.Type, path string, found map[string]bool) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Map:
+			for _, item := range value {
+				walkUnknownFields(item, t.Elem(), path, found)
+			}
+		case reflect.Struct:
+			for key, item := range value {
+				fieldPath := key
+				if path != "" {
+					fieldPath = path + "." + key
+				}
+				field, ok := jsonField(t, key)
+				if !ok {
+					found[fieldPath] = true
+					continue
+				}
+				walkUnknownFields(item, field.Type, fieldPath, found)
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, item := range value {
+				walkUnknownFields(item, t.Elem(), path, found)
+			}
+		}
+	}
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// jsonField returns the field of a struct encoding/json decodes a key into:
+// the one named by its tag or its name, matched case-insensitively, fields of
+// embedded structs included.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" && tag == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if inner, ok := jsonField(embedded, key); ok {
+					return inner, true
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// decodeSample is the last payload of an RPC path that couldn't be decoded.
+type decodeSample struct {
+	Endpoint  string    `json:"endpoint"`
+	Path      string    `json:"path"`
+	Time      time.Time `json:"time"`
+	Error     string    `json:"error"`
+	Payload   string    `json:"payload"`
+	Truncated bool      `json:"truncated"`
+}
+
+var decodeSamples = struct {
+	sync.Mutex
+	samples map[string]decodeSample
+}{samples: make(map[string]decodeSample)}
+
+// recordDecodeError counts a decode failure and, with
+// --debug.decode-samples, keeps the start of the payload for
+// /debug/decode-errors.
+func recordDecodeError(endpoint, path string, body []byte, err error) {
+	metricRPCDecodeErrors.WithLabelValues(endpoint, path).Inc()
+	if !*debugDecodeSamples {
+		return
+	}
+
+	sample := decodeSample{
+		Endpoint: endpoint,
+		Path:     path,
+		Time:     time.Now(),
+		Error:    err.Error(),
+		Payload:  string(body),
+	}
+	if len(body) > decodeSampleMaxBytes {
+		sample.Payload = string(body[:decodeSampleMaxBytes])
+		sample.Truncated = true
+	}
+	decodeSamples.Lock()
+	decodeSamples.samples[endpoint+path] = sample
+	decodeSamples.Unlock()
+}
+
+// decodeSamplesHandler serves the last payload that failed to decode for each
+// endpoint and path.
+func decodeSamplesHandler(w http.ResponseWriter, r *http.Request) {
+	decodeSamples.Lock()
+	samples := []decodeSample{}
+	for _, sample := range decodeSamples.samples {
+		samples = append(samples, sample)
+	}
+	decodeSamples.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Time.After(samples[j].Time) })
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(samples)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUnknownFields(t *testing.T) {
+	type embedded struct {
+		Inner string `json:"inner"`
+	}
+	type document struct {
+		embedded
+		Name    string            `json:"name"`
+		Renamed string            `json:"renamed,omitempty"`
+		Time    time.Time         `json:"time"`
+		Labels  map[string]string `json:"labels"`
+		Items   []struct {
+			Value string `json:"value"`
+		} `json:"items"`
+		Pointer *struct {
+			Value string `json:"value"`
+		} `json:"pointer"`
+		Untagged string
+		Skipped  string `json:"-"`
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"known", `{"name": "a", "NAME": "b", "inner": "c", "untagged": "d", "time": "2023-01-01T00:00:00Z"}`, []string{}},
+		{"top level", `{"name": "a", "extra": 1}`, []string{"extra"}},
+		{"nested in lists", `{"items": [{"value": "a", "type": "b"}, {"type": "c"}]}`, []string{"items.type"}},
+		{"pointer", `{"pointer": {"value": "a", "other": true}}`, []string{"pointer.other"}},
+		{"map keys are data", `{"labels": {"any": "a"}}`, []string{}},
+		{"skipped field", `{"Skipped": "a"}`, []string{"Skipped"}},
+		{"unknown objects aren't walked", `{"extra": {"a": 1}}`, []string{"extra"}},
+		{"not JSON", `{`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := unknownFields([]byte(test.body), &document{})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("unknownFields = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	defer func(strict bool) { *rpcStrictDecoding = strict }(*rpcStrictDecoding)
+	*rpcStrictDecoding = true
+
+	// /validators of Tendermint, with fields VegaValidators doesn't declare
+	body := []byte(`{"jsonrpc": "2.0", "id": -1, "result": {"block_height": "10", "count": "1", "total": "1",
+		"validators": [{"address": "A0", "pub_key": {"type": "tendermint/PubKeyEd25519", "value": "a="},
+		"voting_power": "10", "proposer_priority": "-5"}]}}`)
+	c := &RPCClient{label: "http://strict-decoding"}
+	var validators VegaValidators
+	err := c.decode(vegaValidatorsUrl+"?height=10", body, &validators)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if validators.Result.Validators[0].VotingPower != "10" {
+		t.Errorf("voting power = %q, want 10", validators.Result.Validators[0].VotingPower)
+	}
+	for _, field := range []string{"result.count", "result.validators.pub_key.type", "result.validators.proposer_priority"} {
+		counter := metricRPCUnknownFields.WithLabelValues(c.label, vegaValidatorsUrl, field)
+		if value := testutil.ToFloat64(counter); value != 1 {
+			t.Errorf("unknown field %s counted %v times, want 1", field, value)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeDelegationsUrl = "/api/v2/delegations"
+
+type DataNodeDelegations struct {
+	Delegations struct {
+		Edges []struct {
+			Node struct {
+				Party    string `json:"party"`
+				NodeID   string `json:"nodeId"`
+				Amount   string `json:"amount"`
+				EpochSeq string `json:"epochSeq"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"delegations"`
+}
+
+var (
+	metricValidatorStake = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "validator", "stake_tokens"),
+		"VEGA tokens staked on the validator in the current epoch.",
+		[]string{"vega_id", "validator"}, nil,
+	)
+	metricValidatorStakeNominated = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "validator", "stake_nominated_tokens"),
+		"VEGA tokens nominated to the validator that take effect next epoch.",
+		[]string{"vega_id", "validator"}, nil,
+	)
+	metricValidatorStakeDenominated = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "validator", "stake_denominated_tokens"),
+		"VEGA tokens undelegated from the validator that take effect next epoch.",
+		[]string{"vega_id", "validator"}, nil,
+	)
+)
+
+// DelegationsCollector compares the delegations of the current epoch with
+// the ones recorded for the next epoch, so that operators see the stake
+// coming and going before it changes the voting power.
+type DelegationsCollector struct {
+	dataNode *DataNodeClient
+}
+
+func NewDelegationsCollector(dataNode *DataNodeClient) *DelegationsCollector {
+	return &DelegationsCollector{dataNode: dataNode}
+}
+
+func (c *DelegationsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricValidatorStake
+	ch <- metricValidatorStakeNominated
+	ch <- metricValidatorStakeDenominated
+}
+
+func (c *DelegationsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var nodes DataNodeNodes
+	err := c.dataNode.Get(ctx, dataNodeNodesUrl, &nodes)
+	if err != nil {
+		return fmt.Errorf("listing nodes: %v", err)
+	}
+	current, err := getEpoch(ctx, c.dataNode, 0)
+	if err != nil {
+		return fmt.Errorf("reading epoch: %v", err)
+	}
+	seq, err := current.number()
+	if err != nil {
+		return err
+	}
+	delegated, err := c.delegations(ctx, seq)
+	if err != nil {
+		return fmt.Errorf("listing delegations of epoch %d: %v", seq, err)
+	}
+	pending, err := c.delegations(ctx, seq+1)
+	if err != nil {
+		return fmt.Errorf("listing delegations of epoch %d: %v", seq+1, err)
+	}
+
+	for _, edge := range nodes.Nodes.Edges {
+		node := edge.Node
+		stake, ok := new(big.Int).SetString(node.StakedTotal, 10)
+		if !ok {
+			return fmt.Errorf("node %s: invalid stake %q", node.ID, node.StakedTotal)
+		}
+		nominated, denominated := stakeChanges(delegated[node.ID], pending[node.ID])
+
+		name := labelValue(node.Name)
+		ch <- prometheus.MustNewConstMetric(
+			metricValidatorStake, prometheus.GaugeValue, tokenAmount(stake), node.ID, name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricValidatorStakeNominated, prometheus.GaugeValue, tokenAmount(nominated), node.ID, name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricValidatorStakeDenominated, prometheus.GaugeValue, tokenAmount(denominated), node.ID, name,
+		)
+	}
+	return nil
+}
+
+// delegations returns the delegations of an epoch by node ID and party.
+func (c *DelegationsCollector) delegations(ctx context.Context, epoch uint64) (map[string]map[string]*big.Int, error) {
+	delegations := make(map[string]map[string]*big.Int)
+	cursor := ""
+	for {
+		var page DataNodeDelegations
+		path := dataNodePage(dataNodeDelegationsUrl, cursor) + "&epochId=" + strconv.FormatUint(epoch, 10)
+		err := c.dataNode.Get(ctx, path, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range page.Delegations.Edges {
+			delegation := edge.Node
+			amount, ok := new(big.Int).SetString(delegation.Amount, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid amount %q", delegation.Amount)
+			}
+			if delegations[delegation.NodeID] == nil {
+				delegations[delegation.NodeID] = make(map[string]*big.Int)
+			}
+			delegations[delegation.NodeID][delegation.Party] = amount
+		}
+		if !page.Delegations.PageInfo.HasNextPage {
+			return delegations, nil
+		}
+		cursor = page.Delegations.PageInfo.EndCursor
+	}
+}
+
+// stakeChanges returns the stake parties add to a validator and the stake
+// they remove, from their delegations of the current epoch and those
+// recorded for the next one. Parties without a delegation recorded for the
+// next epoch keep their stake, an undelegation is recorded as a lower
+// amount.
+func stakeChanges(delegated, pending map[string]*big.Int) (*big.Int, *big.Int) {
+	nominated, denominated := new(big.Int), new(big.Int)
+	for party, next := range pending {
+		change := new(big.Int).Set(next)
+		if amount, ok := delegated[party]; ok {
+			change.Sub(change, amount)
+		}
+		if change.Sign() > 0 {
+			nominated.Add(nominated, change)
+		} else {
+			denominated.Sub(denominated, change)
+		}
+	}
+	return nominated, denominated
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestStakeChanges(t *testing.T) {
+	stakes := func(amounts map[string]int64) map[string]*big.Int {
+		if amounts == nil {
+			return nil
+		}
+		stakes := make(map[string]*big.Int)
+		for party, amount := range amounts {
+			stakes[party] = big.NewInt(amount)
+		}
+		return stakes
+	}
+	tests := []struct {
+		name        string
+		delegated   map[string]int64
+		pending     map[string]int64
+		nominated   int64
+		denominated int64
+	}{
+		{"nothing recorded for the next epoch", map[string]int64{"a": 10, "b": 5}, nil, 0, 0},
+		{"parties missing from the next epoch are unchanged", map[string]int64{"a": 10, "b": 5}, map[string]int64{"a": 12}, 2, 0},
+		{"new party", map[string]int64{"a": 10}, map[string]int64{"b": 3}, 3, 0},
+		{"partial undelegation", map[string]int64{"a": 10}, map[string]int64{"a": 4}, 0, 6},
+		{"full undelegation", map[string]int64{"a": 10, "b": 5}, map[string]int64{"a": 0, "b": 8}, 3, 10},
+		{"no validator stake", nil, map[string]int64{"a": 1}, 1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nominated, denominated := stakeChanges(stakes(test.delegated), stakes(test.pending))
+			if nominated.Int64() != test.nominated || denominated.Int64() != test.denominated {
+				t.Errorf("stakeChanges = %v, %v, want %v, %v", nominated, denominated, test.nominated, test.denominated)
+			}
+		})
+	}
+}
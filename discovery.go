@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Endpoints like srv+_rpc._tcp.vega.example.com stand for every target of the
+// DNS SRV record. srv+https://_rpc._tcp.vega.example.com uses HTTPS.
+const srvEndpointPrefix = "srv+"
+
+// targetSet keeps an exporter for every current target, so that discovered
+// targets can come and go while serving. Each exporter has a registry of its
+// own: targets don't need to share the same label names. Another one holds
+// what the leader shares of the target with the followers.
+type targetSet struct {
+	mutex      sync.Mutex
+	targets    map[string]TargetConfig
+	exporters  map[string]*Exporter
+	registries map[string]*prometheus.Registry
+	shared     map[string]*prometheus.Registry
+}
+
+func newTargetSet() *targetSet {
+	return &targetSet{
+		targets:    make(map[string]TargetConfig),
+		exporters:  make(map[string]*Exporter),
+		registries: make(map[string]*prometheus.Registry),
+		shared:     make(map[string]*prometheus.Registry),
+	}
+}
+
+// targetKey identifies a target, names are only unique within a network.
+func targetKey(target TargetConfig) string {
+	return target.Labels["network"] + "/" + target.Name
+}
+
+// update creates exporters for new or changed targets and drops the ones of
+// targets that are gone. Named targets are told apart by a node label next to
+// their own labels.
+func (s *targetSet) update(targets []TargetConfig) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// A broken target doesn't prevent the others from being updated
+	var firstErr error
+	current := make(map[string]bool)
+	for _, target := range targets {
+		key := targetKey(target)
+		current[key] = true
+		previous, ok := s.targets[key]
+		if ok && reflect.DeepEqual(previous, target) {
+			continue
+		}
+		if ok {
+			s.remove(key)
+		}
+
+		registry := prometheus.NewRegistry()
+		shared := prometheus.NewRegistry()
+		exporter, err := NewExporter(target)
+		if err == nil {
+			err = wrapTarget(registry, target).Register(exporter)
+			if err == nil {
+				err = wrapTarget(shared, target).Register(leaderShare{exporter})
+			}
+			if err != nil {
+				exporter.Close()
+			}
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %v", targetName(target), err)
+			}
+			continue
+		}
+		s.targets[key] = target
+		s.exporters[key] = exporter
+		s.registries[key] = registry
+		s.shared[key] = shared
+	}
+
+	for key := range s.targets {
+		if !current[key] {
+			s.remove(key)
+		}
+	}
+	return firstErr
+}
+
+func (s *targetSet) remove(key string) {
+	s.exporters[key].Close()
+	delete(s.targets, key)
+	delete(s.exporters, key)
+	delete(s.registries, key)
+	delete(s.shared, key)
+}
+
+func wrapTarget(registerer prometheus.Registerer, target TargetConfig) prometheus.Registerer {
+	if target.Name == "" && len(target.Labels) == 0 {
+		return registerer
+	}
+	labels := prometheus.Labels{"node": target.Name}
+	for name, value := range target.Labels {
+		labels[name] = value
+	}
+	return prometheus.WrapRegistererWith(labels, registerer)
+}
+
+// list returns the exporters of the current targets.
+func (s *targetSet) list() []*Exporter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var exporters []*Exporter
+	for _, exporter := range s.exporters {
+		exporters = append(exporters, exporter)
+	}
+	return exporters
+}
+
+// Gather collects every target concurrently and merges their metrics.
+func (s *targetSet) Gather() ([]*dto.MetricFamily, error) {
+	s.mutex.Lock()
+	var registries []*prometheus.Registry
+	for _, registry := range s.registries {
+		registries = append(registries, registry)
+	}
+	s.mutex.Unlock()
+
+	gathered := make(prometheus.Gatherers, len(registries))
+	var wg sync.WaitGroup
+	for i, registry := range registries {
+		wg.Add(1)
+		go func(i int, registry *prometheus.Registry) {
+			defer wg.Done()
+			families, err := registry.Gather()
+			gathered[i] = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+				return families, err
+			})
+		}(i, registry)
+	}
+	wg.Wait()
+	return gathered.Gather()
+}
+
+// Close releases the connections held by the collectors of the exporter.
+func (e *Exporter) Close() {
+	collectors := []Collector{e.status, e.netInfo, e.consensus}
+	for _, c := range e.collectors {
+		collectors = append(collectors, c)
+	}
+	for _, c := range collectors {
+		if closer, ok := c.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
+// discoverTargets replaces the targets with a SRV endpoint by a target per
+// host of the record, named after its host and port.
+func discoverTargets(ctx context.Context, targets []TargetConfig) ([]TargetConfig, error) {
+	var discovered []TargetConfig
+	for _, target := range targets {
+		if !strings.HasPrefix(target.Endpoint, srvEndpointPrefix) {
+			discovered = append(discovered, target)
+			continue
+		}
+
+		scheme := "http"
+		name := strings.TrimPrefix(target.Endpoint, srvEndpointPrefix)
+		if i := strings.Index(name, "://"); i >= 0 {
+			scheme, name = name[:i], name[i+3:]
+		}
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %v", target.Endpoint, err)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("resolving %s: no SRV record", target.Endpoint)
+		}
+
+		// Keep the node labels stable whatever the order of the answer
+		sort.Slice(records, func(i, j int) bool {
+			return records[i].Target < records[j].Target ||
+				records[i].Target == records[j].Target && records[i].Port < records[j].Port
+		})
+		for _, record := range records {
+			host := net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+			node := target
+			node.Name = host
+			node.Endpoint = scheme + "://" + host
+			discovered = append(discovered, node)
+		}
+	}
+	return discovered, nil
+}
+
+// How often the targets file is checked for changes
+const targetsFilePollInterval = 5 * time.Second
+
+// targetSource lists the targets to scrape: the configured ones, those of the
+// targets file, the pods found in Kubernetes and the hosts of SRV records.
+type targetSource struct {
+	configured []TargetConfig
+	// Timeouts and intervals inherited by the targets of the targets file
+	// and Kubernetes
+	timeouts  map[string]time.Duration
+	intervals map[string]time.Duration
+
+	fileModTime time.Time
+}
+
+func (t *targetSource) targets(ctx context.Context) ([]TargetConfig, error) {
+	targets := append([]TargetConfig{}, t.configured...)
+	if *targetsFile != "" {
+		info, err := os.Stat(*targetsFile)
+		if err != nil {
+			return nil, err
+		}
+		t.fileModTime = info.ModTime()
+
+		fileTargets, err := LoadTargetsFile(*targetsFile, t.timeouts)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, fileTargets...)
+	}
+	if *kubernetesSelector != "" {
+		podTargets, err := kubernetesTargets(ctx, t.timeouts)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes discovery: %v", err)
+		}
+		targets = append(targets, podTargets...)
+	}
+	for i := len(t.configured); i < len(targets); i++ {
+		targets[i].Intervals = t.intervals
+	}
+	return discoverTargets(ctx, targets)
+}
+
+// dynamic tells whether the targets may change while serving.
+func (t *targetSource) dynamic() bool {
+	if *targetsFile != "" || *kubernetesSelector != "" {
+		return true
+	}
+	for _, target := range t.configured {
+		if strings.HasPrefix(target.Endpoint, srvEndpointPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch updates the target set when the targets file changes and every
+// --discovery.refresh-interval for SRV records and Kubernetes pods. On failure the previous
+// targets are kept.
+func (t *targetSource) watch(set *targetSet) {
+	if !t.dynamic() {
+		return
+	}
+	refresh := time.NewTicker(*discoveryRefreshInterval)
+	poll := time.NewTicker(targetsFilePollInterval)
+	for {
+		select {
+		case <-refresh.C:
+		case <-poll.C:
+			if *targetsFile == "" {
+				continue
+			}
+			info, err := os.Stat(*targetsFile)
+			if err != nil || info.ModTime().Equal(t.fileModTime) {
+				continue
+			}
+			logInfof("Reloading targets from %s", *targetsFile)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), *discoveryRefreshInterval)
+		targets, err := t.targets(ctx)
+		cancel()
+		if err != nil {
+			logErrorf("Error refreshing targets: %v", err)
+			continue
+		}
+		err = set.update(targets)
+		if err != nil {
+			logErrorf("Error updating targets: %v", err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricDNSChanges = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "dns_changes_total",
+		Help:      "Number of times a host name stopped resolving to the address of open connections, which were left for new ones.",
+	},
+	[]string{"host"},
+)
+
+// Time given to the resolver to look a host name up again. It doesn't follow
+// --rpc.dial-timeout, which can be 0
+const dnsLookupTimeout = 10 * time.Second
+
+// errStaleConn refuses a new request on a connection whose address moved. The
+// transport retries requests that failed before anything was written on a new
+// connection.
+var errStaleConn = errors.New("host name no longer resolves to the address of the connection")
+
+// resolvedConns are the open connections dialed to a host name, checked
+// against the addresses of the name every --rpc.dns-ttl. Keep-alive
+// connections otherwise stick to the address they were dialed to, long after
+// a load balancer or failover record moved.
+var resolvedConns = newConnTracker(net.DefaultResolver.LookupHost)
+
+type connTracker struct {
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mutex sync.Mutex
+	conns map[*resolvedConn]bool
+}
+
+func newConnTracker(lookupHost func(ctx context.Context, host string) ([]string, error)) *connTracker {
+	return &connTracker{lookupHost: lookupHost, conns: make(map[*resolvedConn]bool)}
+}
+
+// track wraps a connection dialed to host.
+func (t *connTracker) track(conn net.Conn, host string) *resolvedConn {
+	tracked := &resolvedConn{Conn: conn, host: host, tracker: t}
+	t.mutex.Lock()
+	t.conns[tracked] = true
+	t.mutex.Unlock()
+	return tracked
+}
+
+// resolvedConn is a connection with the host name it was dialed to. Once its
+// address is stale, the request in flight completes but the connection
+// refuses the next one.
+type resolvedConn struct {
+	net.Conn
+	host    string
+	tracker *connTracker
+
+	mutex sync.Mutex
+	stale bool
+	// Whether a response was read since the last write: the next write
+	// starts another request
+	read bool
+}
+
+func (c *resolvedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.mutex.Lock()
+		c.read = true
+		c.mutex.Unlock()
+	}
+	return n, err
+}
+
+func (c *resolvedConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	if c.stale && c.read {
+		c.mutex.Unlock()
+		return 0, errStaleConn
+	}
+	c.read = false
+	c.mutex.Unlock()
+	return c.Conn.Write(b)
+}
+
+func (c *resolvedConn) markStale() {
+	c.mutex.Lock()
+	c.stale = true
+	c.mutex.Unlock()
+}
+
+func (c *resolvedConn) Close() error {
+	c.tracker.mutex.Lock()
+	delete(c.tracker.conns, c)
+	c.tracker.mutex.Unlock()
+	return c.Conn.Close()
+}
+
+// dialContext dials like a net.Dialer with --rpc.dial-timeout, and tracks
+// the connections to host names when --rpc.dns-ttl is set. Onion services are
+// dialed through Tor.
+func dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if host, _, err := net.SplitHostPort(address); err == nil && isOnion(host) {
+		return dialOnion(ctx, network, address)
+	}
+	dialer := net.Dialer{Timeout: *rpcDialTimeout, KeepAlive: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil || *rpcDNSTTL <= 0 {
+		return conn, err
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return conn, nil
+	}
+	return resolvedConns.track(conn, host), nil
+}
+
+// run resolves the host names of the open connections every ttl, and marks
+// stale the connections whose address is no longer among those of their
+// name. The next request dials the name again.
+func (t *connTracker) run(ttl time.Duration) {
+	for range time.Tick(ttl) {
+		t.check()
+	}
+}
+
+func (t *connTracker) check() {
+	t.mutex.Lock()
+	hosts := make(map[string][]*resolvedConn)
+	for conn := range t.conns {
+		hosts[conn.host] = append(hosts[conn.host], conn)
+	}
+	t.mutex.Unlock()
+
+	for host, conns := range hosts {
+		ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+		addresses, err := t.lookupHost(ctx, host)
+		cancel()
+		// The name may be briefly unresolvable, the connections are kept
+		// until it resolves again
+		if err != nil {
+			logDebugf("Resolving %s: %v", host, err)
+			continue
+		}
+		current := make(map[string]bool)
+		for _, address := range addresses {
+			current[address] = true
+		}
+
+		changed := false
+		for _, conn := range conns {
+			address, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+			if err != nil || current[address] {
+				continue
+			}
+			logDebugf("%s no longer resolves to %s, retiring the connection", host, address)
+			conn.markStale()
+			changed = true
+		}
+		if changed {
+			logInfof("Address of %s changed to %v, reconnecting", host, addresses)
+			metricDNSChanges.WithLabelValues(host).Inc()
+		}
+	}
+}
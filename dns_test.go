@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestConnTrackerCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// Echo, so that each write is answered like a request
+			go func() {
+				buf := make([]byte, 64)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						conn.Close()
+						return
+					}
+					conn.Write(buf[:n])
+				}
+			}()
+		}
+	}()
+
+	addresses := []string{"127.0.0.1"}
+	tracker := newConnTracker(func(ctx context.Context, host string) ([]string, error) {
+		return addresses, nil
+	})
+	dial := func() *resolvedConn {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tracker.track(conn, "rpc.example")
+	}
+	request := func(conn *resolvedConn) error {
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			return err
+		}
+		_, err := conn.Read(make([]byte, 4))
+		return err
+	}
+
+	idle, busy := dial(), dial()
+	defer idle.Close()
+	defer busy.Close()
+	for _, conn := range []*resolvedConn{idle, busy} {
+		if err := request(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The name still resolves to the address: nothing changes
+	tracker.check()
+	if err := request(idle); err != nil {
+		t.Fatalf("request on a current connection: %v", err)
+	}
+
+	// The name moves while a request is in flight on busy
+	if _, err := busy.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	addresses = []string{"127.0.0.2"}
+	tracker.check()
+	if _, err := busy.Read(make([]byte, 4)); err != nil {
+		t.Errorf("response of the request in flight: %v", err)
+	}
+	for name, conn := range map[string]*resolvedConn{"idle": idle, "busy": busy} {
+		if err := request(conn); err != errStaleConn {
+			t.Errorf("next request on the %s connection: error = %v, want %v", name, err, errStaleConn)
+		}
+	}
+
+	idle.Close()
+	busy.Close()
+	if len(tracker.conns) != 0 {
+		t.Errorf("%d connections still tracked after closing", len(tracker.conns))
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeEpochUrl = "/api/v2/epoch"
+
+// DataNodeEpoch is an epoch of the data node.
+type DataNodeEpoch struct {
+	Seq        string `json:"seq"`
+	Timestamps struct {
+		StartTime  string `json:"startTime"`
+		ExpiryTime string `json:"expiryTime"`
+		EndTime    string `json:"endTime"`
+		FirstBlock string `json:"firstBlock"`
+		LastBlock  string `json:"lastBlock"`
+	} `json:"timestamps"`
+}
+
+// getEpoch returns an epoch of the data node, the current one when seq is 0.
+func getEpoch(ctx context.Context, dataNode *DataNodeClient, seq uint64) (DataNodeEpoch, error) {
+	var response struct {
+		Epoch DataNodeEpoch `json:"epoch"`
+	}
+	path := dataNodeEpochUrl
+	if seq != 0 {
+		path += "?id=" + strconv.FormatUint(seq, 10)
+	}
+	err := dataNode.Get(ctx, path, &response)
+	if err != nil {
+		return DataNodeEpoch{}, err
+	}
+	return response.Epoch, nil
+}
+
+// number returns the sequence number of the epoch.
+func (e DataNodeEpoch) number() (uint64, error) {
+	seq, err := strconv.ParseUint(e.Seq, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid epoch %q", e.Seq)
+	}
+	return seq, nil
+}
+
+var (
+	metricEpoch = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "epoch", "current"),
+		"Sequence number of the current epoch.",
+		nil, nil,
+	)
+	metricEpochExpiry = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "epoch", "expiry_timestamp_seconds"),
+		"Time the current epoch is expected to end.",
+		nil, nil,
+	)
+	metricEpochRolloverDeviation = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "epoch", "rollover_deviation_seconds"),
+		"Time between the expected end of the last completed epoch and the block that ended it, positive when late.",
+		nil, nil,
+	)
+)
+
+// EpochsCollector exports the current epoch and how late the last one rolled
+// over, which grows when the chain slows down and delays reward payouts.
+type EpochsCollector struct {
+	dataNode *DataNodeClient
+}
+
+func NewEpochsCollector(dataNode *DataNodeClient) *EpochsCollector {
+	return &EpochsCollector{dataNode: dataNode}
+}
+
+func (c *EpochsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricEpoch
+	ch <- metricEpochExpiry
+	ch <- metricEpochRolloverDeviation
+}
+
+func (c *EpochsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	current, err := getEpoch(ctx, c.dataNode, 0)
+	if err != nil {
+		return fmt.Errorf("reading epoch: %v", err)
+	}
+	seq, err := current.number()
+	if err != nil {
+		return err
+	}
+	expiry, err := parseUnixNano(current.Timestamps.ExpiryTime)
+	if err != nil {
+		return fmt.Errorf("epoch %d expiry: %v", seq, err)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricEpoch, prometheus.GaugeValue, float64(seq),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricEpochExpiry, prometheus.GaugeValue, float64(expiry.UnixNano())/float64(time.Second),
+	)
+	if seq < 2 {
+		return nil
+	}
+
+	last, err := getEpoch(ctx, c.dataNode, seq-1)
+	if err != nil {
+		return fmt.Errorf("reading epoch %d: %v", seq-1, err)
+	}
+	lastExpiry, err := parseUnixNano(last.Timestamps.ExpiryTime)
+	if err != nil {
+		return fmt.Errorf("epoch %d expiry: %v", seq-1, err)
+	}
+	lastEnd, err := parseUnixNano(last.Timestamps.EndTime)
+	if err != nil {
+		return fmt.Errorf("epoch %d end: %v", seq-1, err)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricEpochRolloverDeviation, prometheus.GaugeValue, lastEnd.Sub(lastExpiry).Seconds(),
+	)
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// EthereumConfig configures the Ethereum JSON-RPC endpoint of a target, used
+// to read the Vega bridge contracts.
+type EthereumConfig struct {
+	Endpoint string            `yaml:"endpoint"`
+	Headers  map[string]string `yaml:"headers"`
+	// Address of the staking bridge contract
+	StakingBridge string `yaml:"staking_bridge"`
+	// Number of recent Ethereum blocks the stake events are counted over
+	EventBlocks int64 `yaml:"event_blocks"`
+}
+
+// EthereumClient performs JSON-RPC calls against an Ethereum node.
+type EthereumClient struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func NewEthereumClient(endpoint string, headers map[string]string) *EthereumClient {
+	return &EthereumClient{
+		endpoint: endpoint,
+		headers:  headers,
+		client:   hostClient(headers),
+	}
+}
+
+// EthereumLog is an event log returned by eth_getLogs.
+type EthereumLog struct {
+	BlockNumber string   `json:"blockNumber"`
+	Topics      []string `json:"topics"`
+	Data        string   `json:"data"`
+	Removed     bool     `json:"removed"`
+}
+
+// Call sends a JSON-RPC request and decodes its result into v.
+func (c *EthereumClient) Call(ctx context.Context, method string, v interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setHeaders(req, c.headers)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := readBody(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", method, resp.Status)
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s: %s", method, response.Error.Message)
+	}
+	return json.Unmarshal(response.Result, v)
+}
+
+// BlockNumber returns the number of the latest Ethereum block.
+func (c *EthereumClient) BlockNumber(ctx context.Context) (int64, error) {
+	var number string
+	err := c.Call(ctx, "eth_blockNumber", &number)
+	if err != nil {
+		return 0, err
+	}
+	return parseQuantity(number)
+}
+
+// CallUint256 calls a view function without arguments returning a uint256
+// on the latest block.
+func (c *EthereumClient) CallUint256(ctx context.Context, contract string, selector string) (*big.Int, error) {
+	var result string
+	err := c.Call(ctx, "eth_call", &result, map[string]string{"to": contract, "data": selector}, "latest")
+	if err != nil {
+		return nil, err
+	}
+	return parseUint256(result)
+}
+
+// Logs returns the logs of a contract between two blocks, inclusive, with
+// one of the given first topics.
+func (c *EthereumClient) Logs(ctx context.Context, contract string, from, to int64, topics []string) ([]EthereumLog, error) {
+	var logs []EthereumLog
+	err := c.Call(ctx, "eth_getLogs", &logs, map[string]interface{}{
+		"address":   contract,
+		"fromBlock": "0x" + strconv.FormatInt(from, 16),
+		"toBlock":   "0x" + strconv.FormatInt(to, 16),
+		"topics":    []interface{}{topics},
+	})
+	return logs, err
+}
+
+// parseQuantity parses a hex encoded quantity like 0x1b4.
+func parseQuantity(value string) (int64, error) {
+	return strconv.ParseInt(strings.TrimPrefix(value, "0x"), 16, 64)
+}
+
+// parseUint256 parses a hex encoded ABI word.
+func parseUint256(value string) (*big.Int, error) {
+	number, ok := new(big.Int).SetString(strings.TrimPrefix(value, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid uint256 %q", value)
+	}
+	return number, nil
+}
+
+// tokenAmount converts an amount in the smallest unit of an 18 decimals
+// token like VEGA to tokens.
+func tokenAmount(amount *big.Int) float64 {
+	tokens, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), big.NewFloat(1e18)).Float64()
+	return tokens
+}
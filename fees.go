@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeEpochRewardSummariesUrl = "/api/v2/rewards/epochsummaries"
+const dataNodeRewardsUrl = "/api/v2/rewards"
+
+// Reward type of the infrastructure fees paid to the validators
+const rewardTypeInfrastructureFees = "ACCOUNT_TYPE_FEES_INFRASTRUCTURE"
+
+type DataNodeEpochRewardSummaries struct {
+	Summaries struct {
+		Edges []struct {
+			Node struct {
+				Epoch      string `json:"epoch"`
+				AssetID    string `json:"assetId"`
+				MarketID   string `json:"marketId"`
+				RewardType string `json:"rewardType"`
+				Amount     string `json:"amount"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"summaries"`
+}
+
+type DataNodeRewards struct {
+	Rewards struct {
+		Edges []struct {
+			Node struct {
+				Epoch      string `json:"epoch"`
+				AssetID    string `json:"assetId"`
+				PartyID    string `json:"partyId"`
+				RewardType string `json:"rewardType"`
+				Amount     string `json:"amount"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"rewards"`
+}
+
+var (
+	metricInfrastructureFeesEpoch = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "infrastructure_fees", "epoch"),
+		"Last completed epoch, the infrastructure fee metrics are the ones paid for it.",
+		nil, nil,
+	)
+	metricInfrastructureFees = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "infrastructure_fees", "paid"),
+		"Infrastructure fees paid to the validators for the last completed epoch, in units of the asset.",
+		[]string{"asset", "asset_id"}, nil,
+	)
+	metricInfrastructureFeesMarket = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "infrastructure_fees", "paid_by_market"),
+		"Infrastructure fees paid to the validators for the last completed epoch by market they were collected in, with an empty market for the fees the data node doesn't attribute to one, in units of the asset.",
+		[]string{"asset", "asset_id", "market_id", "market"}, nil,
+	)
+	metricInfrastructureFeesReceived = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "infrastructure_fees", "received"),
+		"Infrastructure fees received by the party of the data-node configuration for the last completed epoch, in units of the asset.",
+		[]string{"asset", "asset_id", "party"}, nil,
+	)
+)
+
+// FeesCollector exports the infrastructure fees paid for the last completed
+// epoch, in total and by market, and the share of the configured party, so
+// that operators can reconcile the fee rewards they expect with the ones they
+// receive.
+type FeesCollector struct {
+	dataNode *DataNodeClient
+	party    string
+}
+
+func NewFeesCollector(dataNode *DataNodeClient, party string) *FeesCollector {
+	return &FeesCollector{dataNode: dataNode, party: party}
+}
+
+func (c *FeesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricInfrastructureFeesEpoch
+	ch <- metricInfrastructureFees
+	ch <- metricInfrastructureFeesMarket
+	ch <- metricInfrastructureFeesReceived
+}
+
+func (c *FeesCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	current, err := getEpoch(ctx, c.dataNode, 0)
+	if err != nil {
+		return fmt.Errorf("reading epoch: %v", err)
+	}
+	seq, err := current.number()
+	if err != nil {
+		return err
+	}
+	if seq < 2 {
+		// No epoch completed yet
+		return nil
+	}
+	epoch := strconv.FormatUint(seq-1, 10)
+	assets, err := listAssets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing assets: %v", err)
+	}
+
+	summaries, err := listEpochRewards(ctx, c.dataNode, epoch)
+	if err != nil {
+		return fmt.Errorf("reading reward summaries: %v", err)
+	}
+	// Totals by asset, and by asset and market
+	paid := make(map[string]*big.Int)
+	byMarket := make(map[epochReward]*big.Int)
+	for reward, amount := range summaries {
+		if reward.rewardType != rewardTypeInfrastructureFees {
+			continue
+		}
+		addTotal(paid, reward.asset, amount)
+		byMarket[reward] = amount
+	}
+	markets := make(map[string]string)
+	for reward := range byMarket {
+		if reward.market != "" {
+			markets, err = marketLabels(ctx, c.dataNode)
+			if err != nil {
+				return fmt.Errorf("listing markets: %v", err)
+			}
+			break
+		}
+	}
+	var received map[string]*big.Int
+	if c.party != "" {
+		received, err = c.rewards(ctx, epoch)
+		if err != nil {
+			return fmt.Errorf("reading rewards of %s: %v", c.party, err)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		metricInfrastructureFeesEpoch, prometheus.GaugeValue, float64(seq-1),
+	)
+	for id, asset := range assets {
+		amount, ok := paid[id]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricInfrastructureFees, prometheus.GaugeValue, assetAmount(amount, asset.decimals), labelValue(asset.symbol), id,
+		)
+		for reward, amount := range byMarket {
+			if reward.asset != id {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				metricInfrastructureFeesMarket, prometheus.GaugeValue, assetAmount(amount, asset.decimals),
+				labelValue(asset.symbol), id, reward.market, markets[reward.market],
+			)
+		}
+		if received != nil {
+			share, ok := received[id]
+			if !ok {
+				share = new(big.Int)
+			}
+			ch <- prometheus.MustNewConstMetric(
+				metricInfrastructureFeesReceived, prometheus.GaugeValue, assetAmount(share, asset.decimals), labelValue(asset.symbol), id, c.party,
+			)
+		}
+	}
+	return nil
+}
+
+// epochReward is a reward type paid in an asset for a market, empty for the
+// rewards that aren't tied to one.
+type epochReward struct {
+	rewardType string
+	asset      string
+	market     string
+}
+
+// listEpochRewards returns the rewards paid for an epoch by reward type,
+// asset and market.
+func listEpochRewards(ctx context.Context, dataNode *DataNodeClient, epoch string) (map[epochReward]*big.Int, error) {
+	paid := make(map[epochReward]*big.Int)
+	cursor := ""
+	for {
+		var page DataNodeEpochRewardSummaries
+		path := dataNodePage(dataNodeEpochRewardSummariesUrl, cursor) +
+			"&filter.fromEpoch=" + epoch + "&filter.toEpoch=" + epoch
+		err := dataNode.Get(ctx, path, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range page.Summaries.Edges {
+			summary := edge.Node
+			if summary.Epoch != epoch {
+				continue
+			}
+			amount, ok := new(big.Int).SetString(summary.Amount, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid amount %q", summary.Amount)
+			}
+			reward := epochReward{rewardType: summary.RewardType, asset: summary.AssetID, market: summary.MarketID}
+			if total, ok := paid[reward]; ok {
+				total.Add(total, amount)
+			} else {
+				paid[reward] = amount
+			}
+		}
+		if !page.Summaries.PageInfo.HasNextPage {
+			return paid, nil
+		}
+		cursor = page.Summaries.PageInfo.EndCursor
+	}
+}
+
+// rewards returns the infrastructure fees received by the party for an
+// epoch by asset.
+func (c *FeesCollector) rewards(ctx context.Context, epoch string) (map[string]*big.Int, error) {
+	received := make(map[string]*big.Int)
+	cursor := ""
+	for {
+		var page DataNodeRewards
+		path := dataNodePage(dataNodeRewardsUrl, cursor) +
+			"&partyId=" + url.QueryEscape(c.party) + "&fromEpoch=" + epoch + "&toEpoch=" + epoch
+		err := c.dataNode.Get(ctx, path, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range page.Rewards.Edges {
+			reward := edge.Node
+			if reward.Epoch != epoch || reward.PartyID != c.party || reward.RewardType != rewardTypeInfrastructureFees {
+				continue
+			}
+			err := addAmount(received, reward.AssetID, reward.Amount)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !page.Rewards.PageInfo.HasNextPage {
+			return received, nil
+		}
+		cursor = page.Rewards.PageInfo.EndCursor
+	}
+}
+
+// marketLabels returns the market label of every market by market ID.
+func marketLabels(ctx context.Context, dataNode *DataNodeClient) (map[string]string, error) {
+	markets, err := listMarkets(ctx, dataNode)
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string)
+	for _, market := range markets {
+		labels[market.ID] = market.label()
+	}
+	return labels, nil
+}
+
+// addAmount adds an amount of the data node to the total of an asset.
+func addAmount(totals map[string]*big.Int, asset string, value string) error {
+	amount, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return fmt.Errorf("invalid amount %q", value)
+	}
+	addTotal(totals, asset, amount)
+	return nil
+}
+
+// addTotal adds an amount to the total of an asset.
+func addTotal(totals map[string]*big.Int, asset string, amount *big.Int) {
+	if total, ok := totals[asset]; ok {
+		total.Add(total, amount)
+	} else {
+		totals[asset] = new(big.Int).Set(amount)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFeesCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case dataNodeEpochUrl:
+			fmt.Fprint(w, `{"epoch": {"seq": "5"}}`)
+		case dataNodeAssetsUrl:
+			fmt.Fprint(w, `{"assets": {"edges": [{"node": {"id": "usdt", "details": {"symbol": "USDT", "decimals": "2"}}}]}}`)
+		case dataNodeMarketsUrl:
+			fmt.Fprint(w, `{"markets": {"edges": [{"node": {"id": "m1", "tradableInstrument": {"instrument": {"code": "BTCUSDT.PERP"}}}}]}}`)
+		case dataNodeEpochRewardSummariesUrl:
+			// Fees of the market, in two summaries, and fees of no market
+			fmt.Fprint(w, `{"summaries": {"edges": [
+				{"node": {"epoch": "4", "assetId": "usdt", "marketId": "m1", "rewardType": "ACCOUNT_TYPE_FEES_INFRASTRUCTURE", "amount": "1000"}},
+				{"node": {"epoch": "4", "assetId": "usdt", "marketId": "m1", "rewardType": "ACCOUNT_TYPE_FEES_INFRASTRUCTURE", "amount": "500"}},
+				{"node": {"epoch": "4", "assetId": "usdt", "rewardType": "ACCOUNT_TYPE_FEES_INFRASTRUCTURE", "amount": "300"}},
+				{"node": {"epoch": "4", "assetId": "usdt", "marketId": "m1", "rewardType": "ACCOUNT_TYPE_GLOBAL_REWARD", "amount": "7000"}}
+			]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	values, err := collect(t, NewFeesCollector(NewDataNodeClient(server.URL, nil), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		`vega_infrastructure_fees_epoch`:                                                                             4,
+		`vega_infrastructure_fees_paid{asset="USDT",asset_id="usdt"}`:                                                18,
+		`vega_infrastructure_fees_paid_by_market{asset="USDT",asset_id="usdt",market="BTCUSDT.PERP",market_id="m1"}`: 15,
+		`vega_infrastructure_fees_paid_by_market{asset="USDT",asset_id="usdt",market="",market_id=""}`:               3,
+	}
+	if len(values) != len(want) {
+		t.Errorf("metrics = %v, want %v", values, want)
+	}
+	for key, value := range want {
+		if values[key] != value {
+			t.Errorf("%s = %v, want %v", key, values[key], value)
+		}
+	}
+}
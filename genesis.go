@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const vegaGenesisChunkedUrl = "/genesis_chunked"
+
+// VegaGenesisDoc is the part of the genesis document read by the exporter.
+type VegaGenesisDoc struct {
+	ChainID  string `json:"chain_id"`
+	AppState struct {
+		// Keyed by Tendermint public key
+		Validators map[string]VegaGenesisValidator `json:"validators"`
+	} `json:"app_state"`
+}
+
+type VegaGenesisValidator struct {
+	ID              string `json:"id"`
+	VegaPubKey      string `json:"vega_pub_key"`
+	VegaPubKeyIndex int    `json:"vega_pub_key_index"`
+	EthereumAddress string `json:"ethereum_address"`
+	TmPubKey        string `json:"tm_pub_key"`
+	Name            string `json:"name"`
+}
+
+type VegaGenesis struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		Genesis VegaGenesisDoc `json:"genesis"`
+	} `json:"result"`
+}
+
+type VegaGenesisChunk struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		Chunk string `json:"chunk"`
+		Total string `json:"total"`
+		Data  string `json:"data"`
+	} `json:"result"`
+}
+
+var metricValidatorGenesisInfo = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "validator_genesis_info"),
+	"Vega identity of each validator of the genesis app state, always 1. address and pub_key match vega_validator_info.",
+	[]string{"address", "pub_key", "vega_id", "vega_pub_key", "ethereum_address", "name"}, nil,
+)
+
+// GenesisCollector links the consensus keys of the genesis validators with
+// their Vega public keys and Ethereum addresses. The genesis doesn't change,
+// it is read once.
+type GenesisCollector struct {
+	rpc *RPCClient
+
+	mutex      sync.Mutex
+	validators []VegaGenesisValidator
+}
+
+func NewGenesisCollector(rpc *RPCClient) *GenesisCollector {
+	return &GenesisCollector{rpc: rpc}
+}
+
+func (c *GenesisCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricValidatorGenesisInfo
+}
+
+func (c *GenesisCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.validators == nil {
+		genesis, err := fetchGenesis(ctx, c.rpc)
+		if err != nil {
+			return err
+		}
+		validators := []VegaGenesisValidator{}
+		for pubKey, validator := range genesis.AppState.Validators {
+			if validator.TmPubKey == "" {
+				validator.TmPubKey = pubKey
+			}
+			validators = append(validators, validator)
+		}
+		c.validators = validators
+	}
+
+	for _, validator := range c.validators {
+		ch <- prometheus.MustNewConstMetric(
+			metricValidatorGenesisInfo, prometheus.GaugeValue, 1,
+			consensusAddress(validator.TmPubKey),
+			validator.TmPubKey,
+			validator.ID,
+			validator.VegaPubKey,
+			validator.EthereumAddress,
+			labelValue(validator.Name),
+		)
+	}
+	return nil
+}
+
+// fetchGenesis reads the genesis document, in chunks when the node finds it
+// too large for /genesis.
+func fetchGenesis(ctx context.Context, rpc *RPCClient) (VegaGenesisDoc, error) {
+	var genesis VegaGenesis
+	err := rpc.GetJSON(ctx, vegaGenesisUrl, &genesis)
+	if err == nil {
+		return genesis.Result.Genesis, nil
+	}
+	if !strings.Contains(err.Error(), "genesis_chunked") {
+		return VegaGenesisDoc{}, err
+	}
+
+	var doc []byte
+	for i := 0; ; i++ {
+		var chunk VegaGenesisChunk
+		err := rpc.GetJSON(ctx, fmt.Sprintf("%s?chunk=%d", vegaGenesisChunkedUrl, i), &chunk)
+		if err != nil {
+			return VegaGenesisDoc{}, err
+		}
+		data, err := base64.StdEncoding.DecodeString(chunk.Result.Data)
+		if err != nil {
+			return VegaGenesisDoc{}, fmt.Errorf("decoding genesis chunk %d: %v", i, err)
+		}
+		doc = append(doc, data...)
+		total, err := strconv.Atoi(chunk.Result.Total)
+		if err != nil {
+			return VegaGenesisDoc{}, fmt.Errorf("parsing genesis chunk total: %v", err)
+		}
+		if i+1 >= total {
+			break
+		}
+	}
+
+	var genesisDoc VegaGenesisDoc
+	err = rpc.decode(vegaGenesisChunkedUrl, doc, &genesisDoc)
+	return genesisDoc, err
+}
+
+// consensusAddress derives the Tendermint address of an ed25519 public key:
+// the first 20 bytes of its SHA-256, in upper case hex.
+func consensusAddress(pubKey string) string {
+	key, err := base64.StdEncoding.DecodeString(pubKey)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(key)
+	return strings.ToUpper(hex.EncodeToString(sum[:20]))
+}
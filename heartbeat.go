@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricHeartbeat = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "exporter",
+	Name:      "heartbeat_total",
+	Help:      "Number of successful collections, alert when it stops increasing.",
+})
+
+var metricPanics = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "panics_total",
+		Help:      "Number of panics of the collectors, recovered from, by collector.",
+	},
+	[]string{"collector"},
+)
+
+var heartbeatPing = struct {
+	sync.Mutex
+	last     time.Time
+	inFlight bool
+}{}
+
+// heartbeat records a successful collection and pings --heartbeat.url, at
+// most once per --heartbeat.min-interval. With leader election only the
+// leader pings.
+func heartbeat() {
+	metricHeartbeat.Inc()
+	if *heartbeatURL == "" || !isLeader() {
+		return
+	}
+
+	heartbeatPing.Lock()
+	defer heartbeatPing.Unlock()
+	if heartbeatPing.inFlight || time.Since(heartbeatPing.last) < *heartbeatMinInterval {
+		return
+	}
+	heartbeatPing.inFlight = true
+	go func() {
+		err := ping(*heartbeatURL)
+		if err != nil {
+			logWarnf("Error sending heartbeat: %v", err)
+		}
+		heartbeatPing.Lock()
+		heartbeatPing.inFlight = false
+		if err == nil {
+			heartbeatPing.last = time.Now()
+		}
+		heartbeatPing.Unlock()
+	}()
+}
+
+// ping sends a GET request, as expected by healthchecks.io and PagerDuty
+// heartbeat URLs.
+func ping(url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
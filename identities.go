@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// The data node is asked again after this for the validators, to follow
+// renames and key rotations
+const identitiesRefreshInterval = 5 * time.Minute
+
+// validatorIdentity is the Vega side of a consensus public key.
+type validatorIdentity struct {
+	vegaID string
+	name   string
+}
+
+// validatorIdentities maps the consensus public keys of the validators to
+// their Vega identity. The data node lists the current validators, without
+// one the genesis app state gives those the chain started with. The p2p ID
+// of a peer is the hash of its node key, not of its validator key: it can't
+// tell which validator the peer is.
+type validatorIdentities struct {
+	mutex    sync.Mutex
+	byPubKey map[string]validatorIdentity
+	// Last attempt, successful or not, so that a failing source isn't asked
+	// on each scrape
+	fetched time.Time
+	// The genesis doesn't change, it is read until it succeeds once
+	fromGenesis bool
+}
+
+// identities returns the Vega identity of the validators by consensus public
+// key. It is a best effort: on failure the previous ones, if any, are kept
+// and validators are reported without identity.
+func (e *Exporter) identities(ctx context.Context) map[string]validatorIdentity {
+	ids := &e.validatorIdentities
+	ids.mutex.Lock()
+	defer ids.mutex.Unlock()
+
+	if ids.fromGenesis || time.Since(ids.fetched) < identitiesRefreshInterval {
+		return ids.byPubKey
+	}
+	ids.fetched = time.Now()
+
+	byPubKey := make(map[string]validatorIdentity)
+	if e.dataNode != nil {
+		var nodes DataNodeNodes
+		err := e.dataNode.Get(ctx, dataNodeNodesUrl, &nodes)
+		if err != nil {
+			logDebugf("Listing the validators of %s: %v", e.name, err)
+			return ids.byPubKey
+		}
+		for _, edge := range nodes.Nodes.Edges {
+			byPubKey[edge.Node.TmPubKey] = validatorIdentity{vegaID: edge.Node.ID, name: edge.Node.Name}
+		}
+	} else {
+		genesis, err := fetchGenesis(ctx, e.rpc)
+		if err != nil {
+			logDebugf("Reading the genesis validators of %s: %v", e.name, err)
+			return ids.byPubKey
+		}
+		for pubKey, validator := range genesis.AppState.Validators {
+			if validator.TmPubKey != "" {
+				pubKey = validator.TmPubKey
+			}
+			byPubKey[pubKey] = validatorIdentity{vegaID: validator.ID, name: validator.Name}
+		}
+		ids.fromGenesis = true
+	}
+	ids.byPubKey = byPubKey
+	return byPubKey
+}
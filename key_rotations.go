@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeNodesUrl = "/api/v2/nodes"
+
+type DataNodeNodes struct {
+	Nodes struct {
+		Edges []struct {
+			Node struct {
+				ID              string `json:"id"`
+				PubKey          string `json:"pubKey"`
+				TmPubKey        string `json:"tmPubKey"`
+				EthereumAddress string `json:"ethereumAddress"`
+				Name            string `json:"name"`
+				StakedTotal     string `json:"stakedTotal"`
+				RankingScore    struct {
+					VotingPower int64 `json:"votingPower"`
+				} `json:"rankingScore"`
+			} `json:"node"`
+		} `json:"edges"`
+	} `json:"nodes"`
+}
+
+const dataNodeKeyRotationsUrl = "/api/v2/vega/keys/rotations"
+const dataNodeEthereumKeyRotationsUrl = "/api/v2/vega/keys/ethereum/rotations"
+
+type DataNodeKeyRotations struct {
+	Rotations struct {
+		Edges []struct {
+			Node struct {
+				NodeID      string `json:"nodeId"`
+				BlockHeight string `json:"blockHeight"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"rotations"`
+}
+
+type DataNodeEthereumKeyRotations struct {
+	KeyRotations struct {
+		Edges []struct {
+			Node struct {
+				NodeID      string `json:"nodeId"`
+				BlockHeight string `json:"blockHeight"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"keyRotations"`
+}
+
+var (
+	metricValidatorKeyRotations = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "validator", "key_rotations_total"),
+		"Number of key rotations of the validator, by kind of key. Vega and Ethereum rotations are those recorded by the data node, Tendermint ones those seen since the exporter started.",
+		[]string{"vega_id", "key"}, nil,
+	)
+	metricValidatorKeyRotationHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "validator", "key_rotation_height"),
+		"Block height at which the last key rotation of the validator took effect.",
+		[]string{"vega_id", "key"}, nil,
+	)
+)
+
+// keyRotation is what is known of the rotations of a key of a validator.
+type keyRotation struct {
+	rotations float64
+	height    int64
+}
+
+// observe records a rotation at a height.
+func (r *keyRotation) observe(height int64) {
+	r.rotations++
+	if height > r.height {
+		r.height = height
+	}
+}
+
+// KeyRotationCollector counts the key rotations of each validator listed by
+// the data node, with the block they took effect at. The data node records
+// the rotations of Vega and Ethereum keys. Tendermint keys are followed
+// through the node list instead, and the height of a change found in the
+// validator sets.
+type KeyRotationCollector struct {
+	dataNode *DataNodeClient
+	rpc      *RPCClient
+
+	mutex sync.Mutex
+	// Tendermint key of each validator by Vega node ID, and the last height
+	// at which it was still the one listed
+	tmPubKeys   map[string]string
+	tmListedAt  map[string]int64
+	tmRotations map[string]*keyRotation
+}
+
+func NewKeyRotationCollector(dataNode *DataNodeClient, rpc *RPCClient) *KeyRotationCollector {
+	return &KeyRotationCollector{
+		dataNode:    dataNode,
+		rpc:         rpc,
+		tmPubKeys:   make(map[string]string),
+		tmListedAt:  make(map[string]int64),
+		tmRotations: make(map[string]*keyRotation),
+	}
+}
+
+func (c *KeyRotationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricValidatorKeyRotations
+	ch <- metricValidatorKeyRotationHeight
+}
+
+func (c *KeyRotationCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	rotations := map[string]map[string]*keyRotation{
+		"vega":       make(map[string]*keyRotation),
+		"ethereum":   make(map[string]*keyRotation),
+		"tendermint": c.tmRotations,
+	}
+	err := c.listRotations(ctx, rotations)
+	if err != nil {
+		return err
+	}
+	err = c.followTendermintKeys(ctx, rotations)
+	if err != nil {
+		return err
+	}
+
+	for kind, byNode := range rotations {
+		for id, rotation := range byNode {
+			ch <- prometheus.MustNewConstMetric(
+				metricValidatorKeyRotations, prometheus.CounterValue, rotation.rotations, id, kind,
+			)
+			if rotation.rotations > 0 {
+				ch <- prometheus.MustNewConstMetric(
+					metricValidatorKeyRotationHeight, prometheus.GaugeValue, float64(rotation.height), id, kind,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// listRotations counts the Vega and Ethereum key rotations recorded by the
+// data node.
+func (c *KeyRotationCollector) listRotations(ctx context.Context, rotations map[string]map[string]*keyRotation) error {
+	observe := func(kind, id, blockHeight string) error {
+		height, err := strconv.ParseInt(blockHeight, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s key rotation of %s: invalid block height %q", kind, id, blockHeight)
+		}
+		if rotations[kind][id] == nil {
+			rotations[kind][id] = &keyRotation{}
+		}
+		rotations[kind][id].observe(height)
+		return nil
+	}
+
+	cursor := ""
+	for {
+		var page DataNodeKeyRotations
+		err := c.dataNode.Get(ctx, dataNodePage(dataNodeKeyRotationsUrl, cursor), &page)
+		if err != nil {
+			return fmt.Errorf("listing key rotations: %v", err)
+		}
+		for _, edge := range page.Rotations.Edges {
+			err := observe("vega", edge.Node.NodeID, edge.Node.BlockHeight)
+			if err != nil {
+				return err
+			}
+		}
+		if !page.Rotations.PageInfo.HasNextPage {
+			break
+		}
+		cursor = page.Rotations.PageInfo.EndCursor
+	}
+
+	cursor = ""
+	for {
+		var page DataNodeEthereumKeyRotations
+		err := c.dataNode.Get(ctx, dataNodePage(dataNodeEthereumKeyRotationsUrl, cursor), &page)
+		if err != nil {
+			return fmt.Errorf("listing Ethereum key rotations: %v", err)
+		}
+		for _, edge := range page.KeyRotations.Edges {
+			err := observe("ethereum", edge.Node.NodeID, edge.Node.BlockHeight)
+			if err != nil {
+				return err
+			}
+		}
+		if !page.KeyRotations.PageInfo.HasNextPage {
+			return nil
+		}
+		cursor = page.KeyRotations.PageInfo.EndCursor
+	}
+}
+
+// errKeyNotInSet tells that a new Tendermint key isn't in the validator set
+// yet, the rotation is looked for again on the next update.
+var errKeyNotInSet = errors.New("key not in the validator set yet")
+
+// followTendermintKeys compares the Tendermint keys of the node list with
+// the previous ones. A change took effect at the first height whose validator
+// set holds the new key, after the last height the old key was listed at.
+func (c *KeyRotationCollector) followTendermintKeys(ctx context.Context, rotations map[string]map[string]*keyRotation) error {
+	var nodes DataNodeNodes
+	err := c.dataNode.Get(ctx, dataNodeNodesUrl, &nodes)
+	if err != nil {
+		return fmt.Errorf("listing nodes: %v", err)
+	}
+	// Read after the node list, a key listed is in the set by this height if
+	// it took effect
+	height, err := c.latestHeight(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, edge := range nodes.Nodes.Edges {
+		node := edge.Node
+		for _, kind := range []string{"vega", "ethereum"} {
+			if rotations[kind][node.ID] == nil {
+				rotations[kind][node.ID] = &keyRotation{}
+			}
+		}
+		rotation, ok := c.tmRotations[node.ID]
+		if !ok {
+			c.tmRotations[node.ID] = &keyRotation{}
+		}
+		if !ok || node.TmPubKey == c.tmPubKeys[node.ID] {
+			c.tmPubKeys[node.ID] = node.TmPubKey
+			c.tmListedAt[node.ID] = height
+			continue
+		}
+
+		effective, err := c.rotationHeight(ctx, node.TmPubKey, c.tmListedAt[node.ID], height)
+		if err == errKeyNotInSet {
+			logDebugf("Tendermint key of validator %s changed, waiting for it to take effect", node.ID)
+			continue
+		}
+		if err != nil {
+			logWarnf("Finding the height of the Tendermint key rotation of %s: %v, using the current height", node.ID, err)
+			effective = height
+		}
+		logInfof("Validator %s rotated its Tendermint key at height %d", node.ID, effective)
+		rotation.observe(effective)
+		c.tmPubKeys[node.ID] = node.TmPubKey
+		c.tmListedAt[node.ID] = height
+	}
+	return nil
+}
+
+// rotationHeight returns the first height after from, up to to, whose
+// validator set holds pubKey. Once in the set the key stays, the heights are
+// bisected.
+func (c *KeyRotationCollector) rotationHeight(ctx context.Context, pubKey string, from, to int64) (int64, error) {
+	address := consensusAddress(pubKey)
+	if address == "" {
+		return 0, fmt.Errorf("invalid public key %q", pubKey)
+	}
+	inSet := func(height int64) (bool, error) {
+		addresses, err := validatorAddresses(ctx, c.rpc, height)
+		if err != nil {
+			return false, err
+		}
+		for _, a := range addresses {
+			if strings.EqualFold(a, address) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	ok, err := inSet(to)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errKeyNotInSet
+	}
+	for from+1 < to {
+		middle := from + (to-from)/2
+		ok, err := inSet(middle)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			to = middle
+		} else {
+			from = middle
+		}
+	}
+	return to, nil
+}
+
+func (c *KeyRotationCollector) latestHeight(ctx context.Context) (int64, error) {
+	var status VegaStatus
+	err := c.rpc.GetJSON(ctx, vegaStatusUrl, &status)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(status.Result.SyncInfo.LatestBlockHeight, 10, 64)
+}
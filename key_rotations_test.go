@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// keyRotationsFixture is a data node and a Tendermint node. The Tendermint
+// key of validator v1 changes to newKey in the validator set from height
+// rotatedAt.
+type keyRotationsFixture struct {
+	mutex     sync.Mutex
+	height    int64
+	listed    string
+	rotatedAt int64
+}
+
+const (
+	testOldKey = "b2xkLWtleS1vbGQta2V5LW9sZC1rZXktb2xkLWtleSE="
+	testNewKey = "bmV3LWtleS1uZXcta2V5LW5ldy1rZXktbmV3LWtleSE="
+)
+
+func (f *keyRotationsFixture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	encode := func(v interface{}) { json.NewEncoder(w).Encode(v) }
+	switch r.URL.Path {
+	case dataNodeKeyRotationsUrl:
+		encode(map[string]interface{}{"rotations": map[string]interface{}{"edges": []interface{}{
+			map[string]interface{}{"node": map[string]string{"nodeId": "v1", "blockHeight": "40"}},
+			map[string]interface{}{"node": map[string]string{"nodeId": "v1", "blockHeight": "70"}},
+		}}})
+	case dataNodeEthereumKeyRotationsUrl:
+		encode(map[string]interface{}{"keyRotations": map[string]interface{}{"edges": []interface{}{
+			map[string]interface{}{"node": map[string]string{"nodeId": "v2", "blockHeight": "55"}},
+		}}})
+	case dataNodeNodesUrl:
+		encode(map[string]interface{}{"nodes": map[string]interface{}{"edges": []interface{}{
+			map[string]interface{}{"node": map[string]string{"id": "v1", "tmPubKey": f.listed}},
+			map[string]interface{}{"node": map[string]string{"id": "v2", "tmPubKey": testOldKey}},
+		}}})
+	case vegaStatusUrl:
+		fmt.Fprintf(w, `{"result": {"sync_info": {"latest_block_height": "%d"}}}`, f.height)
+	case vegaValidatorsUrl:
+		height, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		key := testOldKey
+		if f.rotatedAt > 0 && height >= f.rotatedAt {
+			key = testNewKey
+		}
+		fmt.Fprintf(w, `{"result": {"total": "1", "validators": [{"address": %q, "voting_power": "10"}]}}`, consensusAddress(key))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestKeyRotationCollector(t *testing.T) {
+	fixture := &keyRotationsFixture{height: 100, listed: testOldKey}
+	server := httptest.NewServer(fixture)
+	defer server.Close()
+	c := NewKeyRotationCollector(NewDataNodeClient(server.URL, nil), NewRPCClient(server.URL, nil))
+
+	steps := []struct {
+		name      string
+		height    int64
+		listed    string
+		rotatedAt int64
+		// Tendermint rotations and height of the last one
+		rotations float64
+		at        float64
+	}{
+		{"first read", 100, testOldKey, 0, 0, 0},
+		// Listed by the data node before it takes effect
+		{"announced", 110, testNewKey, 0, 0, 0},
+		{"took effect", 130, testNewKey, 117, 1, 117},
+		{"unchanged", 140, testNewKey, 117, 1, 117},
+	}
+	for _, step := range steps {
+		fixture.mutex.Lock()
+		fixture.height, fixture.listed, fixture.rotatedAt = step.height, step.listed, step.rotatedAt
+		fixture.mutex.Unlock()
+
+		values, err := collect(t, c)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		rotations := values[`vega_validator_key_rotations_total{key="tendermint",vega_id="v1"}`]
+		at := values[`vega_validator_key_rotation_height{key="tendermint",vega_id="v1"}`]
+		if rotations != step.rotations || at != step.at {
+			t.Errorf("%s: %v Tendermint rotations, last at %v, want %v at %v", step.name, rotations, at, step.rotations, step.at)
+		}
+
+		// The rotations recorded by the data node, whenever they happened
+		for key, want := range map[string]float64{
+			`vega_validator_key_rotations_total{key="vega",vega_id="v1"}`:     2,
+			`vega_validator_key_rotation_height{key="vega",vega_id="v1"}`:     70,
+			`vega_validator_key_rotations_total{key="ethereum",vega_id="v2"}`: 1,
+			`vega_validator_key_rotation_height{key="ethereum",vega_id="v2"}`: 55,
+			`vega_validator_key_rotations_total{key="ethereum",vega_id="v1"}`: 0,
+		} {
+			if value, ok := values[key]; !ok || value != want {
+				t.Errorf("%s: %s = %v (sent: %v), want %v", step.name, key, value, ok, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Credentials mounted in every pod with a service account
+const kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubernetesPodList holds the fields of a v1 PodList the discovery needs.
+type kubernetesPodList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Status struct {
+			Phase      string `json:"phase"`
+			PodIP      string `json:"podIP"`
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// kubernetesClient queries the API server from inside the cluster with the
+// pod service account.
+type kubernetesClient struct {
+	host   string
+	client *http.Client
+}
+
+func newKubernetesClient() (*kubernetesClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST is not set")
+	}
+	ca, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificate in the service account CA")
+	}
+
+	return &kubernetesClient{
+		host: "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+			Timeout:   30 * time.Second,
+		},
+	}, nil
+}
+
+// kubernetesStatusError is returned for API responses other than 2xx.
+type kubernetesStatusError struct {
+	path   string
+	code   int
+	status string
+	body   string
+}
+
+func (e *kubernetesStatusError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.path, e.status, e.body)
+}
+
+// isKubernetesStatus tells whether err is an API response with the given
+// status code.
+func isKubernetesStatus(err error, code int) bool {
+	var statusErr *kubernetesStatusError
+	return errors.As(err, &statusErr) && statusErr.code == code
+}
+
+func (k *kubernetesClient) get(ctx context.Context, path string, v interface{}) error {
+	return k.do(ctx, "GET", path, nil, v)
+}
+
+// do sends in as JSON, when not nil, and decodes the response into out.
+func (k *kubernetesClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+	// The token is read on every request as it gets rotated
+	token, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/token")
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, k.host+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		content, _ := ioutil.ReadAll(resp.Body)
+		return &kubernetesStatusError{
+			path:   path,
+			code:   resp.StatusCode,
+			status: resp.Status,
+			body:   strings.TrimSpace(string(content)),
+		}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// kubernetesNamespaceOr returns namespace, or the one of the exporter pod when
+// empty.
+func kubernetesNamespaceOr(namespace string) (string, error) {
+	if namespace != "" {
+		return namespace, nil
+	}
+	own, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/namespace")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(own)), nil
+}
+
+// kubernetesTargets returns a target per ready pod matching the label
+// selector, named after the pod and labeled with its namespace.
+func kubernetesTargets(ctx context.Context, timeouts map[string]time.Duration) ([]TargetConfig, error) {
+	k, err := newKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err := kubernetesNamespaceOr(*kubernetesNamespace)
+	if err != nil {
+		return nil, err
+	}
+	path := "/api/v1/pods"
+	if namespace != "*" {
+		path = "/api/v1/namespaces/" + url.PathEscape(namespace) + "/pods"
+	}
+	path += "?labelSelector=" + url.QueryEscape(*kubernetesSelector)
+
+	var pods kubernetesPodList
+	err = k.get(ctx, path, &pods)
+	if err != nil {
+		return nil, fmt.Errorf("listing pods: %v", err)
+	}
+
+	var targets []TargetConfig
+	for _, pod := range pods.Items {
+		ready := false
+		for _, condition := range pod.Status.Conditions {
+			ready = ready || condition.Type == "Ready" && condition.Status == "True"
+		}
+		if pod.Status.Phase != "Running" || !ready || pod.Status.PodIP == "" {
+			continue
+		}
+		targets = append(targets, TargetConfig{
+			Name:     pod.Metadata.Name,
+			Endpoint: "http://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(*kubernetesPort)),
+			Labels:   map[string]string{"namespace": pod.Metadata.Namespace},
+			Timeouts: timeouts,
+		})
+	}
+	return targets, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// labelValue normalizes a free-text label value read from the node, such as a
+// moniker, a title or a symbol, as set by the --labels flags. Invalid UTF-8 is
+// always replaced, Prometheus refuses it. Identifiers like addresses, keys and
+// IDs are exported as is: other metrics are joined on them.
+func labelValue(value string) string {
+	value = strings.ToValidUTF8(value, string(utf8.RuneError))
+
+	switch *labelsSanitize {
+	case "strip":
+		value = strings.TrimSpace(strings.Map(func(r rune) rune {
+			if !unicode.IsPrint(r) || r == '"' || r == '\'' || r == '\\' || r == '`' {
+				return -1
+			}
+			return r
+		}, value))
+	case "escape":
+		value = strconv.Quote(value)
+		value = value[1 : len(value)-1]
+	}
+
+	if *labelsLowercase {
+		value = strings.ToLower(value)
+	}
+	if *labelsMaxLength > 0 && utf8.RuneCountInString(value) > *labelsMaxLength {
+		value = string([]rune(value)[:*labelsMaxLength])
+	}
+	return value
+}
+
+func validateLabelsSanitize(mode string) error {
+	switch mode {
+	case "none", "strip", "escape":
+		return nil
+	}
+	return fmt.Errorf("unknown label sanitization %q, expected none, strip or escape", mode)
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestLabelValue(t *testing.T) {
+	defer func(sanitize string, maxLength int, lowercase bool) {
+		*labelsSanitize, *labelsMaxLength, *labelsLowercase = sanitize, maxLength, lowercase
+	}(*labelsSanitize, *labelsMaxLength, *labelsLowercase)
+
+	tests := []struct {
+		name      string
+		sanitize  string
+		maxLength int
+		lowercase bool
+		value     string
+		want      string
+	}{
+		{"none", "none", 0, false, "Node \"One\"\n", "Node \"One\"\n"},
+		{"invalid UTF-8", "none", 0, false, "a\xffb", "a�b"},
+		{"strip", "strip", 0, false, " Node \"One\"\t\\ ", "Node One"},
+		{"escape", "escape", 0, false, "Node \"One\"\n", `Node \"One\"\n`},
+		{"lowercase", "none", 0, true, "Node One", "node one"},
+		{"max length in runes", "none", 3, false, "Nœud", "Nœu"},
+		{"shorter than max length", "none", 10, false, "Node", "Node"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*labelsSanitize, *labelsMaxLength, *labelsLowercase = test.sanitize, test.maxLength, test.lowercase
+			if got := labelValue(test.value); got != test.want {
+				t.Errorf("labelValue(%q) = %q, want %q", test.value, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Collectors walking the chain block by block. With leader election only the
+// leader runs them.
+var leaderOnlyCollectors = map[string]bool{
+	"blocks":        true,
+	"block_results": true,
+	"signing":       true,
+}
+
+// leaderCache keeps the metrics of the latest successful run of the
+// leader-only collectors of a target, with the outcome and duration of the
+// latest run. The leader shares them with the followers on
+// leaderMetricsPath. A replica that lost the lease serves its own when the
+// leader can't be reached, until the metrics are older than
+// --background.max-age.
+type leaderCache struct {
+	mutex     sync.Mutex
+	metrics   map[string][]prometheus.Metric
+	updated   map[string]time.Time
+	success   map[string]bool
+	durations map[string]time.Duration
+}
+
+// update runs a leader-only collector, sending its metrics to ch and
+// keeping them when it succeeds.
+func (c *leaderCache) update(ctx context.Context, name string, collector Collector, ch chan<- prometheus.Metric) error {
+	// The collector runs in the calling goroutine, so that a panic is
+	// recovered like the one of any other collector
+	metrics := make(chan prometheus.Metric)
+	forwarded := make(chan []prometheus.Metric, 1)
+	go func() {
+		var kept []prometheus.Metric
+		for metric := range metrics {
+			ch <- metric
+			kept = append(kept, metric)
+		}
+		forwarded <- kept
+	}()
+	start := time.Now()
+	err := func() error {
+		defer close(metrics)
+		return collector.Update(ctx, metrics)
+	}()
+	kept := <-forwarded
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.metrics == nil {
+		c.metrics = make(map[string][]prometheus.Metric)
+		c.updated = make(map[string]time.Time)
+		c.success = make(map[string]bool)
+		c.durations = make(map[string]time.Duration)
+	}
+	c.success[name] = err == nil
+	c.durations[name] = time.Since(start)
+	if err != nil {
+		return err
+	}
+	c.metrics[name] = kept
+	c.updated[name] = time.Now()
+	return nil
+}
+
+// serve sends the metrics of the latest successful run of a leader-only
+// collector, if any.
+func (c *leaderCache) serve(name string, ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.serveLocked(name, ch)
+}
+
+func (c *leaderCache) serveLocked(name string, ch chan<- prometheus.Metric) {
+	if *backgroundMaxAge > 0 && time.Since(c.updated[name]) > *backgroundMaxAge {
+		return
+	}
+	for _, metric := range c.metrics[name] {
+		ch <- metric
+	}
+}
+
+// share sends what the followers serve of every leader-only collector run:
+// its metrics and the outcome and duration of its latest run.
+func (c *leaderCache) share(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for name, success := range c.success {
+		c.serveLocked(name, ch)
+		var successValue float64
+		if success {
+			successValue = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricCollectorSuccess, prometheus.GaugeValue, successValue, name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricCollectorDuration, prometheus.GaugeValue, c.durations[name].Seconds(), name,
+		)
+	}
+}
+
+// leaderShare is the collector of the registry a target has on
+// leaderMetricsPath. It is unchecked: the metrics of the collectors are
+// described by the exporter already.
+type leaderShare struct {
+	e *Exporter
+}
+
+func (s leaderShare) Describe(ch chan<- *prometheus.Desc) {}
+
+func (s leaderShare) Collect(ch chan<- prometheus.Metric) {
+	s.e.leaderCache.share(ch)
+}
+
+// Path the leader serves the metrics of its leader-only collectors on
+const leaderMetricsPath = "/leader/metrics"
+
+// Annotation of the Lease holding the --ha.advertise-url of the leader
+const leaseURLAnnotation = "vega-prometheus-exporter/url"
+
+const leaderFetchTimeout = 5 * time.Second
+
+// leaderURL is the --ha.advertise-url of the current leader, as last read
+// from the Lease by a follower.
+var leaderURL atomic.Value
+
+// leaderMetricsHandler serves the leader-only metrics of every target, on
+// the leader only.
+func (s *targetSet) leaderMetricsHandler() http.Handler {
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		s.mutex.Lock()
+		gatherers := make(prometheus.Gatherers, 0, len(s.shared))
+		for _, registry := range s.shared {
+			gatherers = append(gatherers, registry)
+		}
+		s.mutex.Unlock()
+		return gatherers.Gather()
+	})
+	handler := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLeader() {
+			http.Error(w, "Not the leader", http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// leaderGatherer adds the leader-only metrics of the leader to those of a
+// follower, so that both replicas serve them. They replace the follower's
+// own cached series; when the leader can't be reached, the follower serves
+// those alone.
+type leaderGatherer struct {
+	local prometheus.Gatherer
+}
+
+func (g *leaderGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.local.Gather()
+	url, _ := leaderURL.Load().(string)
+	if isLeader() || url == "" {
+		return families, err
+	}
+	shared, fetchErr := fetchLeaderMetrics(url)
+	if fetchErr != nil {
+		logWarnf("Fetching the leader-only metrics from %s: %v", url, fetchErr)
+		return families, err
+	}
+
+	sharedSeries := make(map[string]bool)
+	for _, family := range shared {
+		for _, metric := range family.Metric {
+			sharedSeries[seriesKey(family.GetName(), metric)] = true
+		}
+	}
+	for _, family := range families {
+		kept := family.Metric[:0]
+		for _, metric := range family.Metric {
+			if !sharedSeries[seriesKey(family.GetName(), metric)] {
+				kept = append(kept, metric)
+			}
+		}
+		family.Metric = kept
+	}
+	merged, mergeErr := prometheus.Gatherers{
+		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return families, err }),
+		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return shared, nil }),
+	}.Gather()
+	return merged, mergeErr
+}
+
+// fetchLeaderMetrics reads the leader-only metrics of the leader.
+func fetchLeaderMetrics(url string) ([]*dto.MetricFamily, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), leaderFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(url, "/")+leaderMetricsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	var parser expfmt.TextParser
+	byName, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var families []*dto.MetricFamily
+	for _, family := range byName {
+		families = append(families, family)
+	}
+	return families, nil
+}
+
+// seriesKey identifies a series by its name and labels.
+func seriesKey(name string, metric *dto.Metric) string {
+	pairs := make([]string, 0, len(metric.Label))
+	for _, label := range metric.Label {
+		pairs = append(pairs, label.GetName()+"="+strconv.Quote(label.GetValue()))
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Time format of the Lease MicroTime fields
+const kubernetesMicroTime = "2006-01-02T15:04:05.000000Z07:00"
+
+var leading int32
+
+var metricLeader = prometheus.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "exporter",
+		Name:      "leader",
+		Help:      "Whether this exporter replica holds the leader lease.",
+	},
+	func() float64 {
+		if isLeader() {
+			return 1
+		}
+		return 0
+	},
+)
+
+// isLeader tells whether this replica runs the leader only collectors. It
+// always does without leader election.
+func isLeader() bool {
+	return *haLeaseName == "" || atomic.LoadInt32(&leading) == 1
+}
+
+// kubernetesLease holds the fields of a coordination.k8s.io/v1 Lease the
+// election uses.
+type kubernetesLease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		ResourceVersion string            `json:"resourceVersion,omitempty"`
+		Annotations     map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+	} `json:"spec"`
+}
+
+// leaderElection competes for a Kubernetes Lease with the other replicas.
+type leaderElection struct {
+	k        *kubernetesClient
+	path     string
+	name     string
+	ns       string
+	identity string
+	duration time.Duration
+
+	// Expiry is judged on the local clock from the moment the holder was
+	// last seen renewing, replicas' clocks may disagree.
+	observedRenewTime string
+	observedAt        time.Time
+
+	// Called in the background when the replica becomes leader
+	promoted func()
+}
+
+func newLeaderElection() (*leaderElection, error) {
+	k, err := newKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	ns, err := kubernetesNamespaceOr(*haLeaseNamespace)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	return &leaderElection{
+		k:        k,
+		path:     "/apis/coordination.k8s.io/v1/namespaces/" + url.PathEscape(ns) + "/leases",
+		name:     *haLeaseName,
+		ns:       ns,
+		identity: identity,
+		duration: *haLeaseDuration,
+	}, nil
+}
+
+// run tries to acquire or renew the lease every third of its duration. A
+// leader that can't renew in time steps down before another replica may take
+// over.
+func (l *leaderElection) run() {
+	logInfof("Competing for lease %s/%s as %s", l.ns, l.name, l.identity)
+	var renewed time.Time
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), l.duration/3)
+		leader, err := l.tryAcquire(ctx)
+		cancel()
+		if err != nil {
+			logErrorf("Error updating lease %s/%s: %v", l.ns, l.name, err)
+			leader = isLeader() && time.Since(renewed) < l.duration*2/3
+		} else if leader {
+			renewed = time.Now()
+		}
+
+		wasLeader := atomic.SwapInt32(&leading, boolToInt32(leader)) == 1
+		if leader != wasLeader {
+			if leader {
+				logInfof("Acquired lease %s/%s, running leader only collectors", l.ns, l.name)
+				if l.promoted != nil {
+					go l.promoted()
+				}
+			} else {
+				logInfof("Lost lease %s/%s", l.ns, l.name)
+			}
+		}
+		time.Sleep(l.duration / 3)
+	}
+}
+
+// tryAcquire takes or renews the lease when it is free, expired or already
+// ours, and tells whether we hold it.
+func (l *leaderElection) tryAcquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+	var lease kubernetesLease
+	err := l.k.get(ctx, l.path+"/"+url.PathEscape(l.name), &lease)
+	if isKubernetesStatus(err, http.StatusNotFound) {
+		lease.APIVersion = "coordination.k8s.io/v1"
+		lease.Kind = "Lease"
+		lease.Metadata.Name = l.name
+		lease.Metadata.Namespace = l.ns
+		l.claim(&lease, now)
+		err = l.k.do(ctx, "POST", l.path, &lease, &lease)
+		if isKubernetesStatus(err, http.StatusConflict) {
+			// Another replica created it first
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if lease.Spec.RenewTime != l.observedRenewTime {
+		l.observedRenewTime = lease.Spec.RenewTime
+		l.observedAt = now
+	}
+	if lease.Spec.HolderIdentity != l.identity {
+		expiry := l.observedAt.Add(time.Duration(lease.Spec.LeaseDurationSeconds) * time.Second)
+		if lease.Spec.HolderIdentity != "" && now.Before(expiry) {
+			leaderURL.Store(lease.Metadata.Annotations[leaseURLAnnotation])
+			return false, nil
+		}
+		leaderURL.Store("")
+		lease.Spec.LeaseTransitions++
+		lease.Spec.AcquireTime = ""
+	}
+	l.claim(&lease, now)
+
+	// The resource version makes the update fail if another replica got
+	// there first.
+	err = l.k.do(ctx, "PUT", l.path+"/"+url.PathEscape(l.name), &lease, &lease)
+	if isKubernetesStatus(err, http.StatusConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *leaderElection) claim(lease *kubernetesLease, now time.Time) {
+	if lease.Metadata.Annotations == nil {
+		lease.Metadata.Annotations = make(map[string]string)
+	}
+	// Not left to the previous leader's
+	if *haAdvertiseURL != "" {
+		lease.Metadata.Annotations[leaseURLAnnotation] = *haAdvertiseURL
+	} else {
+		delete(lease.Metadata.Annotations, leaseURLAnnotation)
+	}
+	lease.Spec.HolderIdentity = l.identity
+	lease.Spec.LeaseDurationSeconds = int(l.duration.Seconds())
+	lease.Spec.RenewTime = now.UTC().Format(kubernetesMicroTime)
+	if lease.Spec.AcquireTime == "" {
+		lease.Spec.AcquireTime = lease.Spec.RenewTime
+	}
+}
+
+// backfilling tells whether c is a signing collector walking back its window.
+func backfilling(c Collector) bool {
+	if background, ok := c.(*BackgroundCollector); ok {
+		c = background.collector
+	}
+	signing, ok := c.(*SigningCollector)
+	return ok && signing.Backfilling()
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestLeaderCache(t *testing.T) {
+	defer func(maxAge time.Duration) { *backgroundMaxAge = maxAge }(*backgroundMaxAge)
+	*backgroundMaxAge = 0
+
+	desc := prometheus.NewDesc("test_leader_only", "Test.", nil, nil)
+	value := 1.0
+	var failure error
+	collector := collectorFunc(func(ctx context.Context, ch chan<- prometheus.Metric) error {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+		return failure
+	})
+	var cache leaderCache
+	served := func() []float64 {
+		ch := make(chan prometheus.Metric, 10)
+		cache.serve("blocks", ch)
+		close(ch)
+		var values []float64
+		for metric := range ch {
+			_, value := metricKey(t, metric)
+			values = append(values, value)
+		}
+		return values
+	}
+
+	if values := served(); len(values) != 0 {
+		t.Errorf("served %v before any run, want nothing", values)
+	}
+	steps := []struct {
+		name    string
+		value   float64
+		failure error
+		// Value served to followers afterwards
+		served float64
+	}{
+		{"first run", 1, nil, 1},
+		{"later run", 2, nil, 2},
+		{"failed run keeps the previous metrics", 3, errors.New("failed"), 2},
+	}
+	for _, step := range steps {
+		value, failure = step.value, step.failure
+		ch := make(chan prometheus.Metric, 10)
+		err := cache.update(context.Background(), "blocks", collector, ch)
+		close(ch)
+		if err != failure {
+			t.Errorf("%s: error = %v, want %v", step.name, err, failure)
+		}
+		if len(ch) != 1 {
+			t.Errorf("%s: %d metrics sent to the leader's scrape, want 1", step.name, len(ch))
+		}
+		if values := served(); len(values) != 1 || values[0] != step.served {
+			t.Errorf("%s: followers served %v, want %v", step.name, values, step.served)
+		}
+	}
+
+	*backgroundMaxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if values := served(); len(values) != 0 {
+		t.Errorf("served %v past --background.max-age, want nothing", values)
+	}
+}
+
+func TestHeartbeatLeaderOnly(t *testing.T) {
+	var pings int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pings, 1)
+	}))
+	defer server.Close()
+	defer func(url, lease string, interval time.Duration) {
+		*heartbeatURL, *haLeaseName, *heartbeatMinInterval = url, lease, interval
+		atomic.StoreInt32(&leading, 0)
+	}(*heartbeatURL, *haLeaseName, *heartbeatMinInterval)
+	*heartbeatURL, *haLeaseName, *heartbeatMinInterval = server.URL, "exporter", 0
+
+	heartbeat()
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&pings); n != 0 {
+		t.Fatalf("follower pinged %d times, want none", n)
+	}
+
+	atomic.StoreInt32(&leading, 1)
+	heartbeat()
+	for start := time.Now(); atomic.LoadInt32(&pings) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("leader didn't ping")
+		}
+	}
+}
+
+func TestLeaderGatherer(t *testing.T) {
+	defer func(lease string) {
+		*haLeaseName = lease
+		leaderURL.Store("")
+	}(*haLeaseName)
+	*haLeaseName = "exporter"
+
+	target := TargetConfig{Name: "validator"}
+	desc := prometheus.NewDesc("test_leader_only", "Test.", nil, nil)
+	registry := func(value float64) *prometheus.Registry {
+		e := &Exporter{}
+		collector := collectorFunc(func(ctx context.Context, ch chan<- prometheus.Metric) error {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+			return nil
+		})
+		e.leaderCache.update(context.Background(), "blocks", collector, make(chan prometheus.Metric, 10))
+		registry := prometheus.NewRegistry()
+		wrapTarget(registry, target).MustRegister(leaderShare{e})
+		return registry
+	}
+	// The follower cached 1 while it led, the leader has 2 since
+	leader := httptest.NewServer(promhttp.HandlerFor(registry(2), promhttp.HandlerOpts{}))
+	leaderURL.Store(leader.URL)
+	g := &leaderGatherer{local: registry(1)}
+	gathered := func() map[string]float64 {
+		families, err := g.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := make(map[string]float64)
+		for _, family := range families {
+			for _, metric := range family.Metric {
+				values[seriesKey(family.GetName(), metric)] = metric.GetGauge().GetValue()
+			}
+		}
+		return values
+	}
+
+	values := gathered()
+	if v := values[`test_leader_only{node="validator"}`]; v != 2 {
+		t.Errorf("served %v, want the leader's 2", v)
+	}
+	if v, ok := values[`vega_collector_success{collector="blocks",node="validator"}`]; !ok || v != 1 {
+		t.Errorf("collector success = %v (sent: %v), want the leader's 1", v, ok)
+	}
+	if len(values) != 3 {
+		t.Errorf("served %v, want the leader's series only", values)
+	}
+
+	leader.Close()
+	if v := gathered()[`test_leader_only{node="validator"}`]; v != 1 {
+		t.Errorf("served %v with the leader gone, want the cached 1", v)
+	}
+}
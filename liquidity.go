@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeLiquidityProvisionsUrl = "/api/v2/liquidity/provisions"
+
+// Liquidity commitments currently counted by the market
+const liquidityStatusActive = "STATUS_ACTIVE"
+
+type DataNodeLiquidityProvisions struct {
+	LiquidityProvisions struct {
+		Edges []struct {
+			Node struct {
+				ID               string `json:"id"`
+				PartyID          string `json:"partyId"`
+				CommitmentAmount string `json:"commitmentAmount"`
+				Status           string `json:"status"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"liquidityProvisions"`
+}
+
+var (
+	metricMarketLiquidityCommitted = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "liquidity_committed"),
+		"Liquidity committed by the active liquidity providers of the market, in units of the settlement asset.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketLiquidityProviders = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "liquidity_providers"),
+		"Number of active liquidity providers of the market.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketTargetStake = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "target_stake"),
+		"Liquidity the market needs, in units of the settlement asset.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketSuppliedStake = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "supplied_stake"),
+		"Liquidity supplied to the market, in units of the settlement asset.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketLiquidityFeeFactor = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "liquidity_fee_factor"),
+		"Liquidity fee factor of the market.",
+		[]string{"market_id", "market"}, nil,
+	)
+)
+
+// LiquidityCollector exports the liquidity commitments of the markets that
+// are still trading, so that liquidity providers can watch them from the
+// same exporter.
+type LiquidityCollector struct {
+	dataNode *DataNodeClient
+}
+
+func NewLiquidityCollector(dataNode *DataNodeClient) *LiquidityCollector {
+	return &LiquidityCollector{dataNode: dataNode}
+}
+
+func (c *LiquidityCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricMarketLiquidityCommitted
+	ch <- metricMarketLiquidityProviders
+	ch <- metricMarketTargetStake
+	ch <- metricMarketSuppliedStake
+	ch <- metricMarketLiquidityFeeFactor
+}
+
+func (c *LiquidityCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	markets, err := listMarkets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing markets: %v", err)
+	}
+	marketsData, err := listMarketsData(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("reading market data: %v", err)
+	}
+	assets, err := listAssets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing assets: %v", err)
+	}
+
+	for _, market := range markets {
+		if market.closed() {
+			continue
+		}
+		asset, ok := assets[market.product().SettlementAsset]
+		if !ok {
+			return fmt.Errorf("market %s: unknown settlement asset %s", market.ID, market.product().SettlementAsset)
+		}
+
+		committed, providers, err := c.commitments(ctx, market.ID, asset.decimals)
+		if err != nil {
+			return fmt.Errorf("market %s: %v", market.ID, err)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketLiquidityCommitted, prometheus.GaugeValue, committed, market.ID, market.label(),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketLiquidityProviders, prometheus.GaugeValue, providers, market.ID, market.label(),
+		)
+
+		if data, ok := marketsData[market.ID]; ok {
+			targetStake, err := parseAmount(data.TargetStake, asset.decimals)
+			if err != nil {
+				return fmt.Errorf("market %s: target stake: %v", market.ID, err)
+			}
+			suppliedStake, err := parseAmount(data.SuppliedStake, asset.decimals)
+			if err != nil {
+				return fmt.Errorf("market %s: supplied stake: %v", market.ID, err)
+			}
+			ch <- prometheus.MustNewConstMetric(
+				metricMarketTargetStake, prometheus.GaugeValue, targetStake, market.ID, market.label(),
+			)
+			ch <- prometheus.MustNewConstMetric(
+				metricMarketSuppliedStake, prometheus.GaugeValue, suppliedStake, market.ID, market.label(),
+			)
+		}
+
+		feeFactor, err := strconv.ParseFloat(market.Fees.Factors.LiquidityFee, 64)
+		if err != nil {
+			return fmt.Errorf("market %s: invalid liquidity fee %q", market.ID, market.Fees.Factors.LiquidityFee)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketLiquidityFeeFactor, prometheus.GaugeValue, feeFactor, market.ID, market.label(),
+		)
+	}
+	return nil
+}
+
+// commitments returns the liquidity committed to a market by its active
+// providers and their number.
+func (c *LiquidityCollector) commitments(ctx context.Context, marketID string, decimals int) (float64, float64, error) {
+	var committed, providers float64
+	cursor := ""
+	for {
+		var page DataNodeLiquidityProvisions
+		path := dataNodePage(dataNodeLiquidityProvisionsUrl, cursor) + "&marketId=" + url.QueryEscape(marketID)
+		err := c.dataNode.Get(ctx, path, &page)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, edge := range page.LiquidityProvisions.Edges {
+			if edge.Node.Status != liquidityStatusActive {
+				continue
+			}
+			amount, err := parseAmount(edge.Node.CommitmentAmount, decimals)
+			if err != nil {
+				return 0, 0, fmt.Errorf("liquidity provision %s: %v", edge.Node.ID, err)
+			}
+			committed += amount
+			providers++
+		}
+		if !page.LiquidityProvisions.PageInfo.HasNextPage {
+			return committed, providers, nil
+		}
+		cursor = page.LiquidityProvisions.PageInfo.EndCursor
+	}
+}
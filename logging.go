@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const syslogIdentifier = "vega-prometheus-exporter"
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// logLevel values are the matching syslog priorities.
+type logLevel int
+
+const (
+	levelCritical logLevel = 2
+	levelError    logLevel = 3
+	levelWarning  logLevel = 4
+	levelInfo     logLevel = 6
+	levelDebug    logLevel = 7
+)
+
+// minLevel is the least severe level logged, set by --log.level.
+var minLevel = levelInfo
+
+// parseLogLevel maps a --log.level value to its level.
+func parseLogLevel(name string) (logLevel, error) {
+	switch name {
+	case "debug":
+		return levelDebug, nil
+	case "info":
+		return levelInfo, nil
+	case "warn":
+		return levelWarning, nil
+	case "error":
+		return levelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+}
+
+// logSink receives every log entry when logs don't go through the standard
+// logger. caller is the file:line the entry was logged from.
+type logSink interface {
+	Write(level logLevel, message string, caller string) error
+}
+
+var sink logSink
+
+// setupLogging configures where logs go: a syslog or journald sink, or
+// stderr, replaced by a rotated file when --log.file is set.
+func setupLogging() error {
+	level, err := parseLogLevel(*logLevelName)
+	if err != nil {
+		return err
+	}
+	minLevel = level
+
+	// The file only takes the place of stderr: with a sink it would silently
+	// receive nothing but the sink failures
+	if *logFile != "" && *logSinkName != "" && *logSinkName != "stderr" {
+		return fmt.Errorf("--log.file can't be used with --log.sink=%s", *logSinkName)
+	}
+
+	switch *logSinkName {
+	case "", "stderr":
+	case "syslog":
+		syslogSink, err := newSyslogSink(*logSyslogAddress)
+		if err != nil {
+			return fmt.Errorf("connecting to syslog: %v", err)
+		}
+		sink = syslogSink
+	case "journald":
+		journaldSink, err := newJournaldSink()
+		if err != nil {
+			return fmt.Errorf("connecting to journald: %v", err)
+		}
+		sink = journaldSink
+	default:
+		return fmt.Errorf("unknown log sink %q", *logSinkName)
+	}
+
+	if *logFile != "" {
+		log.SetOutput(&lumberjack.Logger{
+			Filename:   *logFile,
+			MaxSize:    *logMaxSize,
+			MaxAge:     *logMaxAge,
+			MaxBackups: *logMaxBackups,
+			Compress:   *logCompress,
+		})
+	}
+	return nil
+}
+
+func logf(level logLevel, format string, args ...interface{}) {
+	if level > minLevel {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	if sink == nil {
+		log.Output(3, message)
+		return
+	}
+
+	caller := ""
+	if _, file, line, ok := runtime.Caller(2); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	err := sink.Write(level, message, caller)
+	if err != nil {
+		// Don't lose the entry when the sink is gone
+		log.Printf("Error writing to log sink: %v (%s)", err, message)
+	}
+}
+
+func logDebugf(format string, args ...interface{}) {
+	logf(levelDebug, format, args...)
+}
+
+func logInfof(format string, args ...interface{}) {
+	logf(levelInfo, format, args...)
+}
+
+func logWarnf(format string, args ...interface{}) {
+	logf(levelWarning, format, args...)
+}
+
+func logErrorf(format string, args ...interface{}) {
+	logf(levelError, format, args...)
+}
+
+// logFatalf logs at critical priority and exits.
+func logFatalf(format string, args ...interface{}) {
+	logf(levelCritical, format, args...)
+	os.Exit(1)
+}
+
+// journaldSink writes entries with the journal native protocol, keeping the
+// priority and the caller as separate fields.
+type journaldSink struct {
+	conn *net.UnixConn
+}
+
+func newJournaldSink() (*journaldSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journaldSink{conn: conn}, nil
+}
+
+func (j *journaldSink) Write(level logLevel, message string, caller string) error {
+	var entry bytes.Buffer
+	journalField(&entry, "PRIORITY", strconv.Itoa(int(level)))
+	journalField(&entry, "SYSLOG_IDENTIFIER", syslogIdentifier)
+	journalField(&entry, "MESSAGE", message)
+	if i := strings.LastIndex(caller, ":"); i > 0 {
+		journalField(&entry, "CODE_FILE", caller[:i])
+		journalField(&entry, "CODE_LINE", caller[i+1:])
+	}
+	_, err := j.conn.Write(entry.Bytes())
+	return err
+}
+
+// journalField appends a field, using the length prefixed form for values
+// spanning several lines.
+func journalField(entry *bytes.Buffer, name string, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(entry, "%s=%s\n", name, value)
+		return
+	}
+	entry.WriteString(name)
+	entry.WriteByte('\n')
+	binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+	entry.WriteString(value)
+	entry.WriteByte('\n')
+}
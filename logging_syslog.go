@@ -0,0 +1,50 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"log/syslog"
+	"strings"
+)
+
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+// newSyslogSink connects to the local syslog daemon, or to address given as
+// network://host:port.
+func newSyslogSink(address string) (*syslogSink, error) {
+	network := ""
+	if address != "" {
+		parts := strings.SplitN(address, "://", 2)
+		if len(parts) == 2 {
+			network, address = parts[0], parts[1]
+		} else {
+			network = "udp"
+		}
+	}
+	writer, err := syslog.Dial(network, address, syslog.LOG_DAEMON|syslog.LOG_INFO, syslogIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (s *syslogSink) Write(level logLevel, message string, caller string) error {
+	if caller != "" {
+		message = message + " caller=" + caller
+	}
+	switch level {
+	case levelCritical:
+		return s.writer.Crit(message)
+	case levelError:
+		return s.writer.Err(message)
+	case levelWarning:
+		return s.writer.Warning(message)
+	case levelDebug:
+		return s.writer.Debug(message)
+	default:
+		return s.writer.Info(message)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogSinkPriority(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sink, err := newSyslogSink("udp://" + conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Priorities of the daemon facility
+	tests := []struct {
+		level logLevel
+		want  string
+	}{
+		{levelCritical, "<26>"},
+		{levelError, "<27>"},
+		{levelWarning, "<28>"},
+		{levelInfo, "<30>"},
+		{levelDebug, "<31>"},
+	}
+	buf := make([]byte, 1024)
+	for _, test := range tests {
+		err := sink.Write(test.level, "message", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry := string(buf[:n]); !strings.HasPrefix(entry, test.want) {
+			t.Errorf("level %d sent as %q, want priority %s", test.level, entry, test.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSetupLoggingFileWithSink(t *testing.T) {
+	defer func(sinkName, file string, level logLevel) {
+		*logSinkName, *logFile, minLevel = sinkName, file, level
+	}(*logSinkName, *logFile, minLevel)
+	*logFile = filepath.Join(t.TempDir(), "exporter.log")
+
+	// Rejected before connecting to the sink
+	for _, name := range []string{"syslog", "journald"} {
+		*logSinkName = name
+		if err := setupLogging(); err == nil {
+			t.Errorf("--log.file accepted with --log.sink=%s", name)
+		}
+	}
+	if sink != nil {
+		t.Errorf("sink set up although the flags are rejected")
+	}
+}
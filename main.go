@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -261,8 +266,15 @@ const vegaConsensusUrl = "/dump_consensus_state"
 const vegaGenesisUrl = "/genesis"
 const netInfo = "/net_info"
 
+// Health check of the Vega wallet service
+const walletHealthUrl = "/api/v2/health"
+
+// Health check of the testnet faucet
+const faucetHealthUrl = "/api/v1/health"
+
 var (
 	tr = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 	client = &http.Client{Transport: tr}
@@ -271,6 +283,200 @@ var (
 		"Address to listen on for telemetry")
 	metricsPath = flag.String("web.telemetry-path", "/metrics",
 		"Path under which to expose metrics")
+	disableCompression = flag.Bool("web.disable-compression", false,
+		"Never gzip the metrics response, even when the scraper accepts it")
+	rateLimit = flag.Float64("web.rate-limit", 0,
+		"Requests per second allowed per client IP on the telemetry endpoint, 0 disables the limit")
+	rateLimitBurst = flag.Int("web.rate-limit-burst", 10,
+		"Number of requests a client IP may burst above the rate limit")
+	allowedCIDRs = flag.String("web.allowed-cidrs", "",
+		"Comma separated list of networks allowed to reach the web endpoints, empty allows everyone")
+	watchdogScrapeAge = flag.Duration("systemd.watchdog-scrape-age", 5*time.Minute,
+		"Stop systemd watchdog pings when no scrape succeeded for this long")
+	readHeaderTimeout = flag.Duration("web.read-header-timeout", 10*time.Second,
+		"Maximum time to read the request headers")
+	writeTimeout = flag.Duration("web.write-timeout", time.Minute,
+		"Maximum time to write a response, must cover the slowest scrape")
+	idleTimeout = flag.Duration("web.idle-timeout", time.Minute,
+		"Maximum time to wait for the next request on a keep-alive connection")
+	maxHeaderBytes = flag.Int("web.max-header-bytes", 16<<10,
+		"Maximum size of the request headers in bytes")
+	rpcProxyURL = flag.String("rpc.proxy-url", "",
+		"Proxy URL for RPC requests (http://, https:// or socks5://), overrides HTTP_PROXY/HTTPS_PROXY")
+	logLevelName = flag.String("log.level", "info",
+		"Least severe level logged: debug, info, warn or error")
+	logScrapes = flag.Bool("log.scrapes", false,
+		"Log each scrape of a target and its collector failures, which are counted in vega_exporter_collector_errors_total either way")
+	logSinkName = flag.String("log.sink", "stderr",
+		"Where to send logs: stderr, syslog or journald")
+	logSyslogAddress = flag.String("log.syslog-address", "",
+		"Remote syslog server as udp://host:port or tcp://host:port, the local daemon when empty")
+	logFile = flag.String("log.file", "",
+		"Write logs to this file instead of stderr, rotating it by size and age. Not available with --log.sink=syslog or journald")
+	logMaxSize = flag.Int("log.max-size", 100,
+		"Size in megabytes at which the log file is rotated")
+	logMaxAge = flag.Int("log.max-age", 7,
+		"Days to keep rotated log files, 0 keeps them regardless of age")
+	logMaxBackups = flag.Int("log.max-backups", 5,
+		"Number of rotated log files to keep, 0 keeps all of them")
+	logCompress = flag.Bool("log.compress", true,
+		"Gzip rotated log files")
+	mockListenAddress = flag.String("mock.listen-address", "127.0.0.1:26657",
+		"Address the mock command serves its fake Tendermint RPC on")
+	mockScenario = flag.String("mock.scenario", "healthy",
+		"Scenario of the mock command: healthy, catching-up, validator-missing or zero-peers")
+	targetsFile = flag.String("targets.file", "",
+		"JSON or YAML file of RPC targets in the Prometheus file_sd format, reloaded when it changes")
+	kubernetesSelector = flag.String("discovery.kubernetes.selector", "",
+		"Label selector of the Vega pods to scrape when running in Kubernetes, e.g. app=vega")
+	kubernetesNamespace = flag.String("discovery.kubernetes.namespace", "",
+		"Namespace of the pods, the exporter's own namespace when empty and every namespace with *")
+	kubernetesPort = flag.Int("discovery.kubernetes.port", 26657,
+		"Tendermint RPC port of the discovered pods")
+	haLeaseName = flag.String("ha.lease-name", "",
+		"Kubernetes Lease the replicas compete for, only the leader walks blocks. Disabled when empty")
+	haLeaseNamespace = flag.String("ha.lease-namespace", "",
+		"Namespace of the Lease, the exporter's own namespace when empty")
+	haLeaseDuration = flag.Duration("ha.lease-duration", 15*time.Second,
+		"Time after which a lease that wasn't renewed may be taken over by another replica")
+	haAdvertiseURL = flag.String("ha.advertise-url", "",
+		"Base URL the other replicas reach this one at, e.g. http://10.0.0.5:9141, to serve its leader-only metrics while it leads. Followers only serve what they cached as leader when empty")
+	scrapeMinInterval = flag.Duration("scrape.min-interval", 0,
+		"Serve the previous collection to scrapes arriving sooner than this after it, 0 disables the cache")
+	backgroundCollectorNames = flag.String("background.collectors", "",
+		"Comma separated collectors run every --background.interval instead of on every scrape, scrapes serve their latest metrics")
+	backgroundInterval = flag.Duration("background.interval", 30*time.Second,
+		"Time between two runs of the background collectors")
+	backgroundMaxAge = flag.Duration("background.max-age", 0,
+		"Drop the metrics of background collectors whose latest successful run is older than this, 0 serves them whatever their age")
+	tracingEndpoint = flag.String("tracing.otlp-endpoint", "",
+		"OTLP/HTTP endpoint the spans of every scrape are sent to, like http://tempo:4318, tracing is disabled when empty")
+	tracingSampleRatio = flag.Float64("tracing.sample-ratio", 1,
+		"Share of the scrapes traced, from 0 to 1")
+	tracingServiceName = flag.String("tracing.service-name", "vega-prometheus-exporter",
+		"Service name of the spans")
+	sentryDSN = flag.String("sentry.dsn", "",
+		"Sentry DSN panics and repeated collector failures are reported to, disabled when empty")
+	sentryFailureThreshold = flag.Int("sentry.failure-threshold", 3,
+		"Consecutive failures of a collector before they are reported to Sentry")
+	sentryMinInterval = flag.Duration("sentry.min-interval", time.Hour,
+		"Minimum time between two reports of the failures of the same collector of a target")
+	heartbeatURL = flag.String("heartbeat.url", "",
+		"URL pinged after successful collections, e.g. a healthchecks.io check or a PagerDuty heartbeat")
+	heartbeatMinInterval = flag.Duration("heartbeat.min-interval", 30*time.Second,
+		"Minimum time between two heartbeat pings")
+	debugDecodeSamples = flag.Bool("debug.decode-samples", false,
+		"Keep the start of the last RPC response that failed to decode for each path, served on "+decodeSamplesPath)
+	labelsSanitize = flag.String("labels.sanitize", "none",
+		"How free-text label values read from the node like monikers are cleaned up: none, strip (drops quotes and control characters) or escape")
+	labelsMaxLength = flag.Int("labels.max-length", 0,
+		"Truncate free-text label values read from the node to this many characters, 0 doesn't truncate")
+	labelsLowercase = flag.Bool("labels.lowercase", false,
+		"Lowercase free-text label values read from the node")
+	probeSeeds = flag.String("probe.seeds", "",
+		"Comma separated seed nodes to probe, as id@host:port dialed over TCP or RPC URLs queried on /health")
+	probeSeedsInterval = flag.Duration("probe.seeds-interval", time.Minute,
+		"How often the seed nodes are probed")
+	discoveryRefreshInterval = flag.Duration("discovery.refresh-interval", 30*time.Second,
+		"How often DNS SRV endpoints are resolved and Kubernetes pods listed again")
+	dryRun = flag.Bool("dry-run", false,
+		"Collect once, print the metrics to stdout and exit instead of serving them, same as the once command")
+	configFile = flag.String("config.file", "",
+		"Path to a YAML configuration file listing RPC targets")
+	rpcTimeout = flag.Duration("rpc.timeout", 10*time.Second,
+		"Default timeout of each collector, unless configured in the config file")
+	rpcMaxBodyBytes = flag.Int64("rpc.max-body-bytes", 64<<20,
+		"Maximum size of the responses of the RPC, data node and Ethereum endpoints in bytes, 0 disables the limit")
+	rpcCompression = flag.Bool("rpc.compression", true,
+		"Ask the endpoints for gzip compressed responses, decompressed transparently")
+	rpcKeepAlive = flag.Bool("rpc.keep-alive", true,
+		"Reuse the connections to the endpoints between requests")
+	rpcMaxIdleConnsPerHost = flag.Int("rpc.max-idle-conns-per-host", http.DefaultMaxIdleConnsPerHost,
+		"Idle connections kept open to each endpoint")
+	rpcIdleConnTimeout = flag.Duration("rpc.idle-conn-timeout", 90*time.Second,
+		"Time after which an idle connection is closed, 0 keeps it open")
+	rpcDialTimeout = flag.Duration("rpc.dial-timeout", 30*time.Second,
+		"Maximum time to connect to an endpoint, 0 leaves it to the timeout of the collector")
+	rpcDNSTTL = flag.Duration("rpc.dns-ttl", 0,
+		"Resolve the host names of open connections again this often, replacing those whose address changed once their request completes. 0 keeps connections until they are idle for --rpc.idle-conn-timeout")
+	rpcTorProxy = flag.String("rpc.tor-proxy", "",
+		"SOCKS5 proxy of Tor, like socks5://127.0.0.1:9050, through which the .onion endpoints are reached")
+	rpcStrictDecoding = flag.Bool("rpc.strict-decoding", false,
+		"Check the RPC responses for fields the exporter doesn't know, counted in vega_rpc_unknown_fields_total to catch schema drift. The responses are still decoded")
+	rpcHTTP2 = flag.Bool("rpc.http2", false,
+		"Negotiate HTTP/2 with https endpoints, multiplexing the requests on a single connection")
+	collectorBlocks = flag.Bool("collector.blocks", false,
+		"Enable the block size and transaction metrics collected from /blockchain")
+	blocksWindow = flag.Int("collector.blocks.window", 100,
+		"Number of recent blocks covered by the block histograms")
+	blockTimestamps = flag.Bool("metrics.block-timestamps", false,
+		"Stamp the block height and signing metrics with the time of their block instead of the scrape time")
+	blockTimestampsMaxAge = flag.Duration("metrics.block-timestamps.max-age", 4*time.Minute,
+		"Blocks older than this are stamped with the scrape time, so that the series of a halted chain don't go stale. 0 stamps every block with its time")
+	collectorSigning = flag.Bool("collector.signing", false,
+		"Enable the per validator signed and missed block counts of the recent commits, read from /commit")
+	signingWindow = flag.Int("collector.signing.window", 100,
+		"Number of recent commits covered by the signing metrics")
+	signingBackfill = flag.Bool("collector.signing.backfill", true,
+		"Walk back the signing window on startup before serving metrics, instead of filling it as blocks come")
+	catchUpBatchSize = flag.Int("catchup.batch-size", 100,
+		"Most heights a block following collector replays per scrape after falling behind, 0 for no limit")
+	catchUpRate = flag.Float64("catchup.rate", 20,
+		"Requests per second a block following collector sends to the node while replaying missed heights, 0 for no limit")
+	collectorWebsocket = flag.Bool("collector.websocket", false,
+		"Follow the consensus events of the RPC WebSocket between scrapes, for the prevote latency of the node's validator")
+	collectorGenesis = flag.Bool("collector.genesis", false,
+		"Export the Vega keys and Ethereum addresses of the genesis validators, read once from /genesis")
+	collectorAbciInfo = flag.Bool("collector.abci-info", false,
+		"Enable the ABCI application metrics collected from /abci_info")
+	collectorKeyRotations = flag.Bool("collector.key-rotations", false,
+		"Count the key rotations of the validators with the height they took effect at, when a data node is configured")
+	collectorWithdrawals = flag.Bool("collector.withdrawals", false,
+		"Export the ERC20 withdrawals approved but not yet submitted to the bridge, when a data node is configured")
+	collectorConsistency = flag.Bool("collector.consistency", false,
+		"Compare the latest heights and block hashes of the targets of the same chain on every scrape, when there are several")
+	consistencyDepth = flag.Uint("collector.consistency.depth", 0,
+		"Blocks below the lowest latest height of the targets of a chain at which their block hashes are compared")
+	collectorNetworkHistory = flag.Bool("collector.network-history", false,
+		"Export the network history segments and IPFS peers of the data node, when one is configured")
+	collectorLiquidity = flag.Bool("collector.liquidity", false,
+		"Export the liquidity commitments, target and supplied stake of the markets, when a data node is configured")
+	collectorTrades = flag.Bool("collector.trades", false,
+		"Count the trades and traded volume of the markets, when a data node is configured")
+	collectorProposals = flag.Bool("collector.proposals", false,
+		"Export the participation and closing time of the open governance proposals, when a data node is configured")
+	collectorAccounts = flag.Bool("collector.accounts", false,
+		"Export the insurance pool of the markets and the network treasury, when a data node is configured")
+	collectorFees = flag.Bool("collector.fees", false,
+		"Export the infrastructure fees paid for the last completed epoch, when a data node is configured")
+	collectorOracles = flag.Bool("collector.oracles", false,
+		"Export the oracle activity and the age of the settlement data of the markets, when a data node is configured")
+	oraclesMaxAge = flag.Duration("collector.oracles.max-age", time.Hour,
+		"Age of the latest settlement data after which a perpetual market is reported stale")
+	collectorMarketEvents = flag.Bool("collector.market-events", false,
+		"Count the liquidations and margin searches of the markets from the event bus, when a data node is configured")
+	collectorMarkets = flag.Bool("collector.markets", false,
+		"Export the trading mode and auctions of the markets, when a data node is configured")
+	collectorStaking = flag.Bool("collector.staking", false,
+		"Export the share of the VEGA supply staked on the network, when a data node and an Ethereum node are configured")
+	collectorEpochs = flag.Bool("collector.epochs", false,
+		"Export the current epoch and how late the last one rolled over, when a data node is configured")
+	collectorRewards = flag.Bool("collector.rewards", false,
+		"Export the reward pools and the rewards paid for the last completed epoch, when a data node is configured")
+	collectorDelegations = flag.Bool("collector.delegations", false,
+		"Export the stake of the validators and the delegation changes of the next epoch, when a data node is configured")
+	collectorValidatorPower = flag.Bool("collector.validator-power", false,
+		"Check the Tendermint voting power of the validators against the one computed by Vega, when a data node is configured")
+	collectorSnapshots = flag.Bool("collector.snapshots", false,
+		"Enable the core snapshot metrics collected from the data node, when one is configured")
+	collectorClock = flag.Bool("collector.clock", false,
+		"Enable the node clock drift and block age metrics")
+	ntpServer = flag.String("ntp.server", "",
+		"NTP server used as time reference by the clock collector (e.g. pool.ntp.org)")
+	collectorBlockResults = flag.Bool("collector.block-results", false,
+		"Enable the event and failed transaction counters collected from /block_results")
+	blockResultsMaxGap = flag.Int("collector.block-results.max-gap", 1000,
+		"Most missed heights the block results collector replays after falling behind, older ones are skipped. 0 replays them all")
 
 	// Metrics
 	up = prometheus.NewDesc(
@@ -283,71 +489,623 @@ var (
 		"Is the node catching up?",
 		nil, nil,
 	)
+	metricLatestBlockHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "sync_latest_block_height"),
+		"Latest block height known to the node.",
+		nil, nil,
+	)
+	metricEarliestBlockHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "sync_earliest_block_height"),
+		"Earliest block height available on the node.",
+		nil, nil,
+	)
+	metricStateSync = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "statesync_in_progress"),
+		"Is the node restoring state from a snapshot?",
+		nil, nil,
+	)
 	metricValidatorSigning = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "validator_signing"),
 		"Flag indicating if a validator is signing or not (per validator).",
 		[]string{"validator"}, nil,
 	)
+	metricValidatorInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "validator_info"),
+		"Consensus address and public key of each validator of the current set, always 1. validator is the name of the matching peer, like in vega_validator_signing. vega_id and vega_name are its Vega identity, from the data node or the genesis.",
+		[]string{"validator", "vega_id", "vega_name", "address", "pub_key"}, nil,
+	)
+	metricValidatorSetChanges = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "validator_set_changes_total"),
+		"Number of validator set changes observed between scrapes.",
+		nil, nil,
+	)
+	metricValidatorAdded = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "validator_added"),
+		"Validators that joined the validator set in the last observed change.",
+		[]string{"address"}, nil,
+	)
+	metricValidatorRemoved = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "validator_removed"),
+		"Validators that left the validator set in the last observed change.",
+		[]string{"address"}, nil,
+	)
+	metricCollectorErrors = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "collector_errors_total"),
+		"Number of times a part of the collection failed, by collector.",
+		[]string{"collector"}, nil,
+	)
+	metricCollectorSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "collector", "success"),
+		"Whether a part of the collection succeeded, by collector.",
+		[]string{"collector"}, nil,
+	)
+	metricCollectorDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "collector", "duration_seconds"),
+		"Time a part of the collection took, that of its latest run for the collectors running in the background.",
+		[]string{"collector"}, nil,
+	)
+	metricCollectorLastSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "collector", "last_success_timestamp_seconds"),
+		"Time of the latest successful run of a collector running in the background, by collector.",
+		[]string{"collector"}, nil,
+	)
+	metricTimeoutPrecommits = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "consensus", "triggered_timeout_precommit_total"),
+		"Number of rounds seen with triggered_timeout_precommit set, precommits took longer than expected.",
+		nil, nil,
+	)
+	metricLastCommitAbsent = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "last_commit", "absent_signatures"),
+		"Number of validators whose signature is missing from the last commit.",
+		nil, nil,
+	)
+	metricPrevotePowerRatio = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "consensus", "prevote_power_ratio"),
+		"Fraction of the voting power that prevoted in a round of the current height.",
+		[]string{"round"}, nil,
+	)
+	metricPrecommitPowerRatio = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "consensus", "precommit_power_ratio"),
+		"Fraction of the voting power that precommitted in a round of the current height.",
+		[]string{"round"}, nil,
+	)
+	metricConsensusStepDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "consensus", "step_duration_seconds"),
+		"Time the node has been in the current height, round and step of the consensus.",
+		[]string{"step"}, nil,
+	)
 )
 
 type Exporter struct {
-	vegaEndpoint string
+	name string
+	// Network label of the target, names are only unique within a network
+	network       string
+	aliases       map[string]string
+	expectedPeers []string
+	rpc           *RPCClient
+	dataNode      *DataNodeClient
+	ethereum      *EthereumClient
+	timeouts      map[string]time.Duration
+	intervals     map[string]time.Duration
+
+	// The parts of the collection reading the Tendermint RPC
+	status    Collector
+	netInfo   Collector
+	consensus Collector
+	// Optional collectors run after the Tendermint RPC metrics
+	collectors map[string]Collector
+
+	// Peers of the latest /net_info, whose signing the consensus part reports
+	validatorsMutex sync.Mutex
+	validators      []VegaValidator
+
+	mutex sync.Mutex
+
+	// Validator set tracking between scrapes
+	validatorSet        map[string]bool
+	validatorSetChanges float64
+	validatorsAdded     []string
+	validatorsRemoved   []string
+
+	// Rounds seen with a triggered precommit timeout, counted once each
+	timeoutPrecommits     float64
+	timeoutPrecommitRound string
+
+	// Progress of the node while it catches up
+	nodeSync syncTracker
+	// Optional trusted node whose latest height is the tip of the chain
+	reference *RPCClient
+
+	// Height/round/step of the consensus and when the node entered it
+	consensusStep      string
+	consensusStepStart time.Time
+
+	// Failures of each part of the collection
+	collectorErrors map[string]float64
+	// Outcome and duration of the parts run by the current collection
+	collectorSuccess   map[string]bool
+	collectorDurations map[string]time.Duration
+	// Root span of the current collection, nil when it isn't traced
+	scrapeSpan *span
+
+	// Peers seen in the last /net_info, served by /sd/peers
+	peersMutex sync.Mutex
+	peers      []peerTarget
+
+	// Chain and latest height of the last /status, compared with the other
+	// targets of the chain. The chain is empty while /status fails
+	headMutex   sync.Mutex
+	headChainID string
+	headHeight  int64
+
+	// Metrics of the leader-only collectors, served once the replica
+	// follows
+	leaderCache leaderCache
+
+	// Vega identity of the consensus keys, for vega_validator_info
+	validatorIdentities validatorIdentities
 }
 
-func NewExporter(vegaEndpoint string) *Exporter {
-	return &Exporter{
-		vegaEndpoint: vegaEndpoint,
+func NewExporter(target TargetConfig) (*Exporter, error) {
+	err := validateEndpoint(target.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if target.Ethereum != nil && target.Ethereum.Endpoint != "" {
+		err = validateEndpoint(target.Ethereum.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("ethereum: %v", err)
+		}
 	}
+	if target.BlockExplorer != nil && target.BlockExplorer.Endpoint != "" {
+		err = validateEndpoint(target.BlockExplorer.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("block explorer: %v", err)
+		}
+	}
+	if target.Wallet != nil && target.Wallet.Endpoint != "" {
+		err = validateEndpoint(target.Wallet.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("wallet: %v", err)
+		}
+	}
+	if target.Faucet != nil && target.Faucet.Endpoint != "" {
+		err = validateEndpoint(target.Faucet.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("faucet: %v", err)
+		}
+	}
+	if target.Reference != nil && target.Reference.Endpoint != "" {
+		err = validateEndpoint(target.Reference.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("reference: %v", err)
+		}
+	}
+
+	e := &Exporter{
+		name:            target.Name,
+		network:         target.Labels["network"],
+		aliases:         target.ValidatorAliases,
+		expectedPeers:   target.ExpectedPeers,
+		rpc:             NewRPCClient(target.Endpoint, target.Headers),
+		timeouts:        target.Timeouts,
+		intervals:       target.Intervals,
+		collectors:      make(map[string]Collector),
+		collectorErrors: make(map[string]float64),
+	}
+	e.status = e.schedule("status", collectorFunc(func(ctx context.Context, ch chan<- prometheus.Metric) error {
+		status, err := e.LoadVegaStatus(ctx, ch)
+		e.recordHead(status, err)
+		return err
+	}))
+	// Without peers the consensus metrics are still exported, only the
+	// signing of each peer is missing
+	e.netInfo = e.schedule("net_info", collectorFunc(func(ctx context.Context, ch chan<- prometheus.Metric) error {
+		validators, err := e.GetVegaValidators(ctx, ch)
+		e.validatorsMutex.Lock()
+		e.validators = validators
+		e.validatorsMutex.Unlock()
+		return err
+	}))
+	e.consensus = e.schedule("consensus", collectorFunc(func(ctx context.Context, ch chan<- prometheus.Metric) error {
+		e.validatorsMutex.Lock()
+		validators := e.validators
+		e.validatorsMutex.Unlock()
+		return e.LoadVegaConsensus(ctx, validators, ch)
+	}))
+
+	if target.CoreGRPC != nil && target.CoreGRPC.Address != "" {
+		coreCollector, err := NewCoreCollector(*target.CoreGRPC)
+		if err != nil {
+			return nil, fmt.Errorf("core gRPC collector: %v", err)
+		}
+		e.collectors["core"] = coreCollector
+	}
+	// Targets can override the --collector flags
+	enabled := func(name string, flagValue bool) bool {
+		if value, ok := target.Collectors[name]; ok {
+			return value
+		}
+		return flagValue
+	}
+
+	if enabled("blocks", *collectorBlocks) {
+		e.collectors["blocks"] = NewBlockCollector(e.rpc, *blocksWindow)
+	}
+	if enabled("signing", *collectorSigning) {
+		e.collectors["signing"] = NewSigningCollector(e.rpc, *signingWindow, *signingBackfill)
+	}
+	if enabled("websocket", *collectorWebsocket) {
+		e.collectors["websocket"] = NewConsensusEventsCollector(e.rpc, target.Endpoint, target.Headers)
+	}
+	if enabled("genesis", *collectorGenesis) {
+		e.collectors["genesis"] = NewGenesisCollector(e.rpc)
+	}
+	if enabled("abci_info", *collectorAbciInfo) {
+		e.collectors["abci_info"] = NewAbciInfoCollector(e.rpc)
+	}
+	if enabled("clock", *collectorClock) {
+		var ntp *ntpClock
+		if *ntpServer != "" {
+			ntp = newNTPClock(*ntpServer)
+		}
+		e.collectors["clock"] = NewClockCollector(e.rpc, ntp)
+	}
+	if enabled("block_results", *collectorBlockResults) {
+		e.collectors["block_results"] = NewBlockResultsCollector(e.rpc)
+	}
+	if target.Ethereum != nil && target.Ethereum.Endpoint != "" {
+		e.ethereum = NewEthereumClient(target.Ethereum.Endpoint, target.Ethereum.Headers)
+	}
+	if target.BlockExplorer != nil && target.BlockExplorer.Endpoint != "" {
+		e.collectors["block_explorer"] = NewBlockExplorerCollector(*target.BlockExplorer, e.rpc)
+	}
+	if target.Wallet != nil && target.Wallet.Endpoint != "" {
+		e.collectors["wallet"] = NewServiceProbeCollector("wallet", *target.Wallet, walletHealthUrl)
+	}
+	if target.Faucet != nil && target.Faucet.Endpoint != "" {
+		e.collectors["faucet"] = NewServiceProbeCollector("faucet", *target.Faucet, faucetHealthUrl)
+	}
+	if target.Reference != nil && target.Reference.Endpoint != "" {
+		e.reference = NewRPCClient(target.Reference.Endpoint, target.Reference.Headers)
+		e.collectors["reference"] = NewReferenceCollector(e.rpc, e.reference)
+	}
+	if target.DataNode != nil && target.DataNode.Endpoint != "" {
+		e.dataNode = NewDataNodeClient(target.DataNode.Endpoint, target.DataNode.Headers)
+		dataNodeCollector, err := NewDataNodeCollector(e.dataNode, *target.DataNode)
+		if err != nil {
+			return nil, fmt.Errorf("data-node collector: %v", err)
+		}
+		e.collectors["datanode"] = dataNodeCollector
+		// The queries run within the timeout of the whole collector
+		for _, query := range target.DataNode.Queries {
+			if timeout := dataNodeCollector.queryTimeout(query); timeout > e.timeout("datanode") {
+				logWarnf("%s: data-node query %s times out after %v, capped to the %v of the datanode collector", e.name, query.Name, timeout, e.timeout("datanode"))
+			}
+		}
+
+		if enabled("snapshots", *collectorSnapshots) {
+			e.collectors["snapshots"] = NewSnapshotCollector(e.dataNode)
+		}
+		if enabled("markets", *collectorMarkets) {
+			e.collectors["markets"] = NewMarketsCollector(e.dataNode)
+		}
+		if enabled("liquidity", *collectorLiquidity) {
+			e.collectors["liquidity"] = NewLiquidityCollector(e.dataNode)
+		}
+		if enabled("trades", *collectorTrades) {
+			e.collectors["trades"] = NewTradesCollector(e.dataNode)
+		}
+		if enabled("proposals", *collectorProposals) {
+			e.collectors["proposals"] = NewProposalsCollector(e.dataNode, target.DataNode.Party)
+		}
+		if enabled("accounts", *collectorAccounts) {
+			e.collectors["accounts"] = NewAccountsCollector(e.dataNode)
+		}
+		if enabled("epochs", *collectorEpochs) {
+			e.collectors["epochs"] = NewEpochsCollector(e.dataNode)
+		}
+		if enabled("delegations", *collectorDelegations) {
+			e.collectors["delegations"] = NewDelegationsCollector(e.dataNode)
+		}
+		if enabled("validator_power", *collectorValidatorPower) {
+			e.collectors["validator_power"] = NewValidatorPowerCollector(e.dataNode, e.rpc)
+		}
+		if enabled("rewards", *collectorRewards) {
+			e.collectors["rewards"] = NewRewardsCollector(e.dataNode)
+		}
+		if enabled("fees", *collectorFees) {
+			e.collectors["fees"] = NewFeesCollector(e.dataNode, target.DataNode.Party)
+		}
+		if enabled("oracles", *collectorOracles) {
+			e.collectors["oracles"] = NewOraclesCollector(e.dataNode, *oraclesMaxAge)
+		}
+		if enabled("market_events", *collectorMarketEvents) {
+			e.collectors["market_events"] = NewMarketEventsCollector(e.dataNode, *target.DataNode)
+		}
+		if enabled("staking", *collectorStaking) && e.ethereum != nil {
+			e.collectors["staking"] = NewStakingCollector(e.dataNode, e.ethereum)
+		}
+		if enabled("network_history", *collectorNetworkHistory) {
+			e.collectors["network_history"] = NewNetworkHistoryCollector(e.dataNode)
+		}
+		if enabled("withdrawals", *collectorWithdrawals) {
+			e.collectors["withdrawals"] = NewWithdrawalsCollector(e.dataNode)
+		}
+		if enabled("key_rotations", *collectorKeyRotations) {
+			e.collectors["key_rotations"] = NewKeyRotationCollector(e.dataNode, e.rpc)
+		}
+	}
+	// After the data node, whose delegated stake the bridge is reconciled with
+	if e.ethereum != nil && target.Ethereum.StakingBridge != "" {
+		e.collectors["staking_bridge"] = NewStakingBridgeCollector(e.ethereum, e.dataNode, *target.Ethereum)
+	}
+
+	for name, c := range e.collectors {
+		e.collectors[name] = e.schedule(name, c)
+	}
+
+	return e, nil
+}
+
+// schedule runs the named collector in the background when it has an
+// interval configured or is listed in --background.collectors, and returns
+// it unchanged otherwise.
+func (e *Exporter) schedule(name string, c Collector) Collector {
+	interval, ok := e.intervals[name]
+	if !ok {
+		if !backgroundCollectors[name] {
+			return c
+		}
+		interval = *backgroundInterval
+	}
+	return NewBackgroundCollector(e.name, name, c, interval, func() (context.Context, context.CancelFunc) {
+		return e.timeoutContext(name)
+	})
 }
 
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- up
 	ch <- metricCatchingUp
+	ch <- metricLatestBlockHeight
+	ch <- metricEarliestBlockHeight
+	ch <- metricRPCSchema
+	ch <- metricCatchingUpDuration
+	ch <- metricSyncRate
+	ch <- metricSyncBlocksBehind
+	ch <- metricSyncETA
+	ch <- metricStateSync
 	ch <- metricValidatorSigning
+	ch <- metricValidatorInfo
+	ch <- metricValidatorSetChanges
+	ch <- metricValidatorAdded
+	ch <- metricValidatorRemoved
+	ch <- metricTimeoutPrecommits
+	ch <- metricLastCommitAbsent
+	ch <- metricPrevotePowerRatio
+	ch <- metricPrecommitPowerRatio
+	ch <- metricConsensusStepDuration
+	ch <- metricCollectorErrors
+	ch <- metricCollectorSuccess
+	ch <- metricCollectorDuration
+	ch <- metricCollectorLastSuccess
+	ch <- metricPeers
+	ch <- metricExpectedPeerConnected
+	ch <- metricP2PListening
+	ch <- metricP2PListenerInfo
+	for _, c := range e.collectors {
+		c.Describe(ch)
+	}
 }
 
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	_, err := e.LoadVegaStatus(ch)
-	if err != nil {
-		ch <- prometheus.MustNewConstMetric(
-			up, prometheus.GaugeValue, 0,
-		)
-		log.Println(err)
-		return
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.collectorSuccess = make(map[string]bool)
+	e.collectorDurations = make(map[string]time.Duration)
+	_, e.scrapeSpan = startTrace(context.Background(), "scrape")
+	e.scrapeSpan.setAttribute("node", e.name)
+	defer e.scrapeSpan.finish(nil)
+
+	// Each part of the collection runs on its own: a failing one only loses
+	// its own metrics and is counted in the collector errors.
+	statusOK := e.run("status", func(ctx context.Context) error {
+		return e.status.Update(ctx, ch)
+	})
+	var upValue float64
+	if statusOK {
+		upValue = 1
+		markScrapeSuccess()
+		heartbeat()
 	}
 	ch <- prometheus.MustNewConstMetric(
-		up, prometheus.GaugeValue, 1,
+		up, prometheus.GaugeValue, upValue,
 	)
 
-	validators, err := e.GetVegaValidators()
+	e.run("net_info", func(ctx context.Context) error {
+		return e.netInfo.Update(ctx, ch)
+	})
+	e.run("consensus", func(ctx context.Context) error {
+		return e.consensus.Update(ctx, ch)
+	})
+
+	for name, c := range e.collectors {
+		if !leaderOnlyCollectors[name] {
+			e.run(name, func(ctx context.Context) error {
+				return c.Update(ctx, ch)
+			})
+			continue
+		}
+		// A replica that just became leader serves the cached metrics until
+		// it has walked back the window. Those of the leader replace the
+		// cached ones of a follower, see leaderGatherer.
+		if !isLeader() || backfilling(c) {
+			e.leaderCache.serve(name, ch)
+			continue
+		}
+		e.run(name, func(ctx context.Context) error {
+			return e.leaderCache.update(ctx, name, c, ch)
+		})
+	}
+
+	for name, errors := range e.collectorErrors {
+		ch <- prometheus.MustNewConstMetric(
+			metricCollectorErrors, prometheus.CounterValue, errors, name,
+		)
+	}
+	e.collectRuns(ch)
+}
+
+// collectRuns exports the outcome and duration of the parts of the
+// collection, and the time of the latest successful run of the background
+// collectors, telling fresh metrics from cached ones.
+func (e *Exporter) collectRuns(ch chan<- prometheus.Metric) {
+	collectors := map[string]Collector{
+		"status":    e.status,
+		"net_info":  e.netInfo,
+		"consensus": e.consensus,
+	}
+	for name, c := range e.collectors {
+		collectors[name] = c
+	}
+	for name, c := range collectors {
+		success, ok := e.collectorSuccess[name]
+		if !ok {
+			// Skipped, like the leader-only collectors of followers
+			continue
+		}
+		var successValue float64
+		if success {
+			successValue = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricCollectorSuccess, prometheus.GaugeValue, successValue, name,
+		)
+
+		// Serving the metrics of a background collector takes no time, its
+		// run is what matters
+		duration := e.collectorDurations[name]
+		background, ok := c.(*BackgroundCollector)
+		if ok {
+			duration = background.Duration()
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricCollectorDuration, prometheus.GaugeValue, duration.Seconds(), name,
+		)
+		if !ok {
+			continue
+		}
 
-	err = e.LoadVegaConsensus(validators, ch)
+		lastSuccess := background.LastSuccess()
+		if lastSuccess.IsZero() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricCollectorLastSuccess, prometheus.GaugeValue, float64(lastSuccess.UnixNano())/1e9, name,
+		)
+	}
 }
 
-func (e *Exporter) LoadVegaStatus(ch chan<- prometheus.Metric) (VegaStatus, error) {
+// run runs a part of the collection within its timeout and records whether
+// it failed.
+func (e *Exporter) run(name string, update func(ctx context.Context) error) bool {
+	ctx, cancel := e.timeoutContext(name)
+	defer cancel()
+	ctx, span := startSpan(withSpan(ctx, e.scrapeSpan), "collector "+name, spanKindInternal)
+	span.setAttribute("collector", name)
+
+	// Every part has a series from the first scrape, so that increases are
+	// seen by rate()
+	if _, ok := e.collectorErrors[name]; !ok {
+		e.collectorErrors[name] = 0
+	}
+	start := time.Now()
+	err := callCollector(e.name, name, func() error {
+		return update(ctx)
+	})
+	span.finish(err)
+	e.collectorDurations[name] = time.Since(start)
+	e.collectorSuccess[name] = err == nil
+	// The failure of a background run was counted on the first scrape it
+	// was returned to
+	var reported reportedError
+	if errors.As(err, &reported) {
+		return false
+	}
+	if err != nil {
+		sentry.collectorFailed(e.name, name, err)
+		e.collectorErrors[name]++
+		if *logScrapes {
+			logErrorf("Collector %s failed: %v", name, err)
+		}
+		return false
+	}
+	sentry.collectorSucceeded(e.name, name)
+	return true
+}
+
+// callCollector runs update, turning a panic into an error so that one
+// malformed response can't take the other collectors, or the process, down.
+func callCollector(node, collector string, update func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			logErrorf("Collector %s of %s panicked: %v\n%s", collector, node, r, stack)
+			metricPanics.WithLabelValues(collector).Inc()
+			sentry.panicked(node, collector, r, stack)
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return update()
+}
+
+// timeoutContext returns a context bounded by the timeout configured for the
+// named collector, falling back to the "default" entry and --rpc.timeout.
+func (e *Exporter) timeoutContext(name string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), e.timeout(name))
+}
+
+// timeout returns the timeout of the named collector.
+func (e *Exporter) timeout(name string) time.Duration {
+	timeout, ok := e.timeouts[name]
+	if !ok {
+		timeout, ok = e.timeouts["default"]
+	}
+	if !ok {
+		timeout = *rpcTimeout
+	}
+	return timeout
+}
+
+func (e *Exporter) LoadVegaStatus(ctx context.Context, ch chan<- prometheus.Metric) (VegaStatus, error) {
 	// we initialize our array
 	var vegaStatus VegaStatus
-	req, err := http.NewRequest("GET", e.vegaEndpoint+vegaStatusUrl, nil)
+	body, err := e.rpc.Get(ctx, vegaStatusUrl)
 	if err != nil {
 		return vegaStatus, err
 	}
+	//fmt.Println(string(body))
+
+	if schema, ok := e.rpc.detectSchema(body); ok {
+		ch <- prometheus.MustNewConstMetric(
+			metricRPCSchema, prometheus.GaugeValue, 1, schema.version, schema.integerEncoding(),
+		)
+	}
 
-	// Make request and show output.
-	resp, err := client.Do(req)
+	// we unmarshal our byteArray which contains our
+	// json content into 'vegaStatus' which we defined above
+	err = e.rpc.decode(vegaStatusUrl, body, &vegaStatus)
 	if err != nil {
 		return vegaStatus, err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
+	// Everything is parsed before the first metric is sent, so that a
+	// malformed /status doesn't leave some of them behind
+	latestHeight, err := strconv.ParseFloat(vegaStatus.Result.SyncInfo.LatestBlockHeight, 64)
 	if err != nil {
 		return vegaStatus, err
 	}
-	//fmt.Println(string(body))
-
-	// we unmarshal our byteArray which contains our
-	// json content into 'vegaStatus' which we defined above
-	err = json.Unmarshal(body, &vegaStatus)
+	earliestHeight, err := strconv.ParseFloat(vegaStatus.Result.SyncInfo.EarliestBlockHeight, 64)
 	if err != nil {
 		return vegaStatus, err
 	}
@@ -363,49 +1121,66 @@ func (e *Exporter) LoadVegaStatus(ch chan<- prometheus.Metric) (VegaStatus, erro
 		metricCatchingUp, prometheus.GaugeValue, catching,
 	)
 
-	return vegaStatus, nil
-}
+	ch <- blockMetric(prometheus.MustNewConstMetric(
+		metricLatestBlockHeight, prometheus.GaugeValue, latestHeight,
+	), vegaStatus.Result.SyncInfo.LatestBlockTime)
 
-func (e *Exporter) GetVegaValidators() ([]VegaValidator, error) {
-	// Get Vega genesis file
-	req, err := http.NewRequest("GET", e.vegaEndpoint+netInfo, nil)
-	if err != nil {
-		return nil, err
+	var referenceHeight int64
+	if vegaStatus.Result.SyncInfo.CatchingUp {
+		referenceHeight = e.referenceHeight(ctx)
 	}
+	e.nodeSync.update(vegaStatus.Result.SyncInfo.CatchingUp, int64(latestHeight), vegaStatus.Result.SyncInfo.LatestBlockTime, referenceHeight)
+	e.nodeSync.collect(ch)
 
-	// Make request and show output.
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
+	ch <- prometheus.MustNewConstMetric(
+		metricEarliestBlockHeight, prometheus.GaugeValue, earliestHeight,
+	)
 
-	body, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		return nil, err
+	// Tendermint doesn't report state sync directly. While a snapshot is
+	// being restored the node catches up without any block stored yet.
+	var stateSync float64
+	if vegaStatus.Result.SyncInfo.CatchingUp && latestHeight == 0 {
+		stateSync = 1
 	}
+	ch <- prometheus.MustNewConstMetric(
+		metricStateSync, prometheus.GaugeValue, stateSync,
+	)
 
-	var result map[string]interface{}
-	err = json.Unmarshal(body, &result)
+	return vegaStatus, nil
+}
+
+func (e *Exporter) GetVegaValidators(ctx context.Context, ch chan<- prometheus.Metric) ([]VegaValidator, error) {
+	// Get Vega genesis file
+	body, err := e.rpc.Get(ctx, netInfo)
 	if err != nil {
 		return nil, err
 	}
+
 	var validators VegaNetInfo
-	v, err := json.Marshal(result["result"])
-	err = json.Unmarshal(v, &result)
+	err = e.rpc.decode(netInfo, body, &validators)
 	if err != nil {
 		return nil, err
 	}
-	json.Unmarshal(v, &validators)
-	//log.Printf("result: %+v\n", result)
-	//log.Printf("marshaled result: %+v\n", v)
+	e.recordPeers(validators)
+	e.collectPeers(validators, ch)
 
 	var retValidators []VegaValidator
 	for _, val := range validators.Result.Peers {
+		// Votes are matched on the first 12 characters of the ID, a peer
+		// with a shorter one can't be
+		if len(val.NodeInfo.ID) < 12 {
+			logDebugf("Skipping peer %q of %s: node ID %q too short", val.NodeInfo.Moniker, e.name, val.NodeInfo.ID)
+			continue
+		}
 		var validator VegaValidator
 		validator.Name = val.NodeInfo.Moniker
 		validator.Address = val.NodeInfo.ID
 		validator.ShortAddress = val.NodeInfo.ID[0:12]
+		if alias, ok := e.aliases[val.NodeInfo.ID]; ok {
+			validator.Name = alias
+		} else if alias, ok := e.aliases[val.NodeInfo.Moniker]; ok {
+			validator.Name = alias
+		}
 		retValidators = append(retValidators, validator)
 	}
 
@@ -414,55 +1189,213 @@ func (e *Exporter) GetVegaValidators() ([]VegaValidator, error) {
 	return retValidators, nil
 }
 
-func (e *Exporter) LoadVegaConsensus(validators []VegaValidator, ch chan<- prometheus.Metric) error {
+func (e *Exporter) LoadVegaConsensus(ctx context.Context, validators []VegaValidator, ch chan<- prometheus.Metric) error {
 	var vegaConsensus VegaConsensus
 	// Load channel stats
-	req, err := http.NewRequest("GET", e.vegaEndpoint+vegaConsensusUrl, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Make request and show output.
-	resp, err := client.Do(req)
+	body, err := e.rpc.Get(ctx, vegaConsensusUrl)
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		log.Fatal(err)
+		// The node may be restarting, the next scrape tries again
+		return fmt.Errorf("loading consensus state: %v", err)
 	}
 	// fmt.Println(string(body))
-	err = json.Unmarshal(body, &vegaConsensus)
+	err = e.rpc.decode(vegaConsensusUrl, body, &vegaConsensus)
 	if err != nil {
 		return err
 	}
 
 	votes := GetVoteSlice(vegaConsensus.Result.RoundState.LastCommit.Votes)
-	log.Printf("%+v\n", votes)
-	log.Printf("%+v\n", validators)
+	logDebugf("Votes: %+v", votes)
+	logDebugf("Validators: %+v", validators)
+
+	// Validators without a precommit in the last commit are listed as
+	// nil-Vote
+	var absent float64
+	for _, vote := range vegaConsensus.Result.RoundState.LastCommit.Votes {
+		if vote == nil || fmt.Sprint(vote) == "nil-Vote" {
+			absent++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricLastCommitAbsent, prometheus.GaugeValue, absent,
+	)
 
 	for _, val := range validators {
 		//log.Printf("Parsing validator %s\n", val.Name)
 		if contains(votes, val.ShortAddress) {
 			ch <- prometheus.MustNewConstMetric(
-				metricValidatorSigning, prometheus.GaugeValue, 1, val.Name,
+				metricValidatorSigning, prometheus.GaugeValue, 1, labelValue(val.Name),
 			)
 		} else {
 			ch <- prometheus.MustNewConstMetric(
-				metricValidatorSigning, prometheus.GaugeValue, 0, val.Name,
+				metricValidatorSigning, prometheus.GaugeValue, 0, labelValue(val.Name),
 			)
 		}
 	}
 
-	log.Println("Endpoint scraped")
+	// Peers are matched to the validator set the way votes are, on the
+	// prefix of the address, so that validator joins with
+	// vega_validator_signing. It is empty for validators that aren't peers of
+	// the node. The Vega identity comes from the consensus public key, it is
+	// empty for validators the data node or the genesis doesn't know
+	identities := e.identities(ctx)
+	for _, val := range vegaConsensus.Result.RoundState.Validators.Validators {
+		var name string
+		for _, peer := range validators {
+			if strings.HasPrefix(strings.ToUpper(val.Address), strings.ToUpper(peer.ShortAddress)) {
+				name = peer.Name
+				break
+			}
+		}
+		identity := identities[val.PubKey.Value]
+		ch <- prometheus.MustNewConstMetric(
+			metricValidatorInfo, prometheus.GaugeValue, 1,
+			labelValue(name), identity.vegaID, labelValue(identity.name), val.Address, val.PubKey.Value,
+		)
+	}
+	e.trackValidatorSet(vegaConsensus, ch)
+	e.trackTimeoutPrecommits(vegaConsensus, ch)
+	e.trackStep(vegaConsensus, ch)
+	collectVotePower(vegaConsensus, ch)
+
+	if *logScrapes {
+		logInfof("Endpoint %s scraped", e.name)
+	}
 	return nil
 }
 
+// trackValidatorSet diffs the current consensus validator set against the one
+// seen on the previous scrape and exports the change counter and the
+// validators added or removed by the last change.
+func (e *Exporter) trackValidatorSet(vegaConsensus VegaConsensus, ch chan<- prometheus.Metric) {
+	current := make(map[string]bool)
+	for _, val := range vegaConsensus.Result.RoundState.Validators.Validators {
+		current[val.Address] = true
+	}
+
+	if e.validatorSet != nil && len(current) > 0 {
+		var added, removed []string
+		for address := range current {
+			if !e.validatorSet[address] {
+				added = append(added, address)
+			}
+		}
+		for address := range e.validatorSet {
+			if !current[address] {
+				removed = append(removed, address)
+			}
+		}
+		if len(added) > 0 || len(removed) > 0 {
+			logWarnf("Validator set changed: added %v, removed %v", added, removed)
+			e.validatorSetChanges++
+			e.validatorsAdded = added
+			e.validatorsRemoved = removed
+		}
+	}
+	if len(current) > 0 {
+		e.validatorSet = current
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		metricValidatorSetChanges, prometheus.CounterValue, e.validatorSetChanges,
+	)
+	for _, address := range e.validatorsAdded {
+		ch <- prometheus.MustNewConstMetric(
+			metricValidatorAdded, prometheus.GaugeValue, 1, address,
+		)
+	}
+	for _, address := range e.validatorsRemoved {
+		ch <- prometheus.MustNewConstMetric(
+			metricValidatorRemoved, prometheus.GaugeValue, 1, address,
+		)
+	}
+}
+
+// trackTimeoutPrecommits counts the rounds in which the precommit timeout was
+// triggered. A round staying in that state over several scrapes is counted
+// once.
+func (e *Exporter) trackTimeoutPrecommits(vegaConsensus VegaConsensus, ch chan<- prometheus.Metric) {
+	roundState := vegaConsensus.Result.RoundState
+	round := fmt.Sprintf("%s/%d", roundState.Height, roundState.Round)
+	if roundState.TriggeredTimeoutPrecommit && round != e.timeoutPrecommitRound {
+		e.timeoutPrecommits++
+		e.timeoutPrecommitRound = round
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		metricTimeoutPrecommits, prometheus.CounterValue, e.timeoutPrecommits,
+	)
+}
+
+// collectVotePower exports the fraction of the voting power behind the
+// prevotes and precommits of each round, which ends the bit arrays of the
+// votes as in "BA{4:xxx_} 30/40 = 0.75".
+func collectVotePower(vegaConsensus VegaConsensus, ch chan<- prometheus.Metric) {
+	for _, votes := range vegaConsensus.Result.RoundState.Votes {
+		round := strconv.Itoa(votes.Round)
+		if ratio, ok := bitArrayRatio(votes.PrevotesBitArray); ok {
+			ch <- prometheus.MustNewConstMetric(
+				metricPrevotePowerRatio, prometheus.GaugeValue, ratio, round,
+			)
+		}
+		if ratio, ok := bitArrayRatio(votes.PrecommitsBitArray); ok {
+			ch <- prometheus.MustNewConstMetric(
+				metricPrecommitPowerRatio, prometheus.GaugeValue, ratio, round,
+			)
+		}
+	}
+}
+
+// bitArrayRatio returns the fraction at the end of a vote bit array.
+func bitArrayRatio(bitArray string) (float64, bool) {
+	i := strings.LastIndex(bitArray, "=")
+	if i < 0 {
+		return 0, false
+	}
+	ratio, err := strconv.ParseFloat(strings.TrimSpace(bitArray[i+1:]), 64)
+	return ratio, err == nil
+}
+
+// Names of the Tendermint round steps, by number
+var roundSteps = map[int]string{
+	1: "new_height",
+	2: "new_round",
+	3: "propose",
+	4: "prevote",
+	5: "prevote_wait",
+	6: "precommit",
+	7: "precommit_wait",
+	8: "commit",
+}
+
+// trackStep exports the time spent in the current height, round and step. A
+// step is timed from the first scrape that sees it, except the first round
+// of a height which starts at the start_time of the round state.
+func (e *Exporter) trackStep(vegaConsensus VegaConsensus, ch chan<- prometheus.Metric) {
+	roundState := vegaConsensus.Result.RoundState
+	step := fmt.Sprintf("%s/%d/%d", roundState.Height, roundState.Round, roundState.Step)
+	if step != e.consensusStep {
+		now := time.Now()
+		start := now
+		if !strings.HasPrefix(e.consensusStep, roundState.Height+"/") && roundState.Round == 0 &&
+			!roundState.StartTime.IsZero() && roundState.StartTime.Before(now) {
+			start = roundState.StartTime
+		}
+		e.consensusStep = step
+		e.consensusStepStart = start
+	}
+
+	name, ok := roundSteps[roundState.Step]
+	if !ok {
+		name = strconv.Itoa(roundState.Step)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricConsensusStepDuration, prometheus.GaugeValue, time.Since(e.consensusStepStart).Seconds(), name,
+	)
+}
+
 func contains(s []string, e string) bool {
 	for _, a := range s {
-		log.Printf("'%s' '%s'\n", a, e)
+		logDebugf("'%s' '%s'", a, e)
 		if strings.TrimSpace(a) == strings.TrimSpace(e) {
 			return true
 		}
@@ -481,32 +1414,257 @@ func GetVoteSlice(votesInt []interface{}) []string {
 			votes = append(votes, match[0])
 		}
 	}
-	log.Println(votes)
+	logDebugf("%v", votes)
 	return votes
 }
 
 func main() {
 	err := godotenv.Load()
 	if err != nil {
-		log.Println("Error loading .env file, assume env variables are set.")
+		logInfof("Error loading .env file, assume env variables are set.")
+	}
+
+	// The command comes first, flags follow. Without one the exporter
+	// serves metrics as it always did.
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flag.Usage = usage
+	flag.CommandLine.Parse(args)
+
+	err = setupLogging()
+	if err != nil {
+		log.Fatalf("Error setting up logging: %v", err)
+	}
+
+	if *rpcProxyURL != "" {
+		proxyURL, err := url.Parse(*rpcProxyURL)
+		if err != nil {
+			logFatalf("Invalid proxy URL %q: %v", *rpcProxyURL, err)
+		}
+		tr.Proxy = http.ProxyURL(proxyURL)
+	}
+	if *rpcTorProxy != "" {
+		err = setupTor(*rpcTorProxy)
+		if err != nil {
+			logFatalf("Invalid Tor proxy %q: %v", *rpcTorProxy, err)
+		}
+	}
+	tuneTransport(tr)
+	tr.DialContext = dialContext
+	tr.ForceAttemptHTTP2 = *rpcHTTP2
+	err = validateLabelsSanitize(*labelsSanitize)
+	if err != nil {
+		logFatalf("Invalid --labels.sanitize: %v", err)
+	}
+	err = parseBackgroundCollectors(*backgroundCollectorNames)
+	if err != nil {
+		logFatalf("Invalid --background.collectors: %v", err)
+	}
+	if *sentryDSN != "" {
+		sentry, err = newSentryClient(*sentryDSN)
+		if err != nil {
+			logFatalf("Invalid --sentry.dsn: %v", err)
+		}
+		go sentry.run()
+	}
+
+	if *dryRun && command == "serve" {
+		command = "once"
+	}
+
+	switch command {
+	case "serve":
+		serve()
+	case "check", "check-config":
+		os.Exit(check())
+	case "once":
+		os.Exit(once())
+	case "mock":
+		mock()
+	case "version":
+		printVersion()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", command)
+		usage()
+		os.Exit(2)
+	}
+}
+
+// loadTargets returns the targets of the config file, or the one described by
+// the environment when there is neither a config file nor another source of
+// targets.
+func loadTargets() *targetSource {
+	source := &targetSource{}
+	if *configFile != "" {
+		config, err := LoadConfig(*configFile)
+		if err != nil {
+			logFatalf("Error loading config file: %v", err)
+		}
+		source.timeouts = config.Timeouts
+		source.intervals = config.Intervals
+		if len(config.Targets) > 0 || *targetsFile != "" || *kubernetesSelector != "" {
+			source.configured = config.Targets
+			return source
+		}
+	}
+	if *targetsFile != "" || *kubernetesSelector != "" {
+		return source
+	}
+
+	target := TargetConfig{Endpoint: os.Getenv("VEGA_ENDPOINT")}
+	target.Timeouts = source.timeouts
+	target.Intervals = source.intervals
+	if reference := os.Getenv("VEGA_REFERENCE_ENDPOINT"); reference != "" {
+		target.Reference = &TargetConfig{Endpoint: reference}
+	}
+	if peers := os.Getenv("VEGA_EXPECTED_PEERS"); peers != "" {
+		target.ExpectedPeers = strings.Split(peers, ",")
+	}
+	if address := os.Getenv("VEGA_CORE_GRPC_ADDRESS"); address != "" {
+		target.CoreGRPC = &CoreGRPCConfig{
+			Address: address,
+			TLS:     os.Getenv("VEGA_CORE_GRPC_TLS") == "true",
+		}
+	}
+	target.normalizeEndpoints()
+	source.configured = []TargetConfig{target}
+	return source
+}
+
+// serve exposes the metrics over HTTP until the process is stopped.
+func serve() {
+	source := loadTargets()
+	ctx, cancel := context.WithTimeout(context.Background(), *rpcTimeout)
+	targets, err := source.targets(ctx)
+	cancel()
+	if err != nil {
+		logFatalf("%v", err)
+	}
+	prometheus.MustRegister(metricHeartbeat, metricPanics, metricRPCErrors, metricRPCResponses, metricRPCCompressedResponses, metricRPCDecodeErrors, metricRPCUnknownFields, metricDNSChanges)
+	set := newTargetSet()
+	err = set.update(targets)
+	if err != nil {
+		logFatalf("%v", err)
+	}
+	go source.watch(set)
+	if *tracingEndpoint != "" {
+		go sendSpans()
+	}
+	if *rpcDNSTTL > 0 {
+		go resolvedConns.run(*rpcDNSTTL)
 	}
 
-	flag.Parse()
+	if *haLeaseName != "" {
+		election, err := newLeaderElection()
+		if err != nil {
+			logFatalf("Error setting up leader election: %v", err)
+		}
+		prometheus.MustRegister(metricLeader)
+		election.promoted = set.backfill
+		go election.run()
+	}
+	// Unreachable targets are reported but still served, vega_up tells
+	// when they come back.
+	for _, target := range targets {
+		_, err := checkTarget(target)
+		if err != nil {
+			logWarnf("%s: %v", targetName(target), err)
+		}
+	}
+	// With leader election, the replica backfills once it acquires the lease
+	if isLeader() {
+		set.backfill()
+	}
 
-	vegaEndpoint := os.Getenv("VEGA_ENDPOINT")
+	if *collectorConsistency {
+		prometheus.MustRegister(newConsistencyChecker(set))
+	}
 
-	exporter := NewExporter(vegaEndpoint)
-	prometheus.MustRegister(exporter)
+	if *probeSeeds != "" {
+		seeds, err := parseSeeds(*probeSeeds)
+		if err != nil {
+			logFatalf("Invalid --probe.seeds: %v", err)
+		}
+		prober := newSeedProber(seeds)
+		prometheus.MustRegister(prober)
+		go prober.run(*probeSeedsInterval)
+	}
 
-	http.Handle(*metricsPath, promhttp.Handler())
+	var targetsGatherer prometheus.Gatherer = set
+	if *haLeaseName != "" {
+		targetsGatherer = &leaderGatherer{local: set}
+		http.Handle(leaderMetricsPath, set.leaderMetricsHandler())
+	}
+	if *scrapeMinInterval > 0 {
+		prometheus.MustRegister(metricCachedScrapes)
+		targetsGatherer = &cachingGatherer{gatherer: targetsGatherer, interval: *scrapeMinInterval}
+	}
+
+	// Same as promhttp.Handler() with configurable gzip negotiation
+	metricsHandler := promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		// Targets are gathered first so that the exporter counters include
+		// their collection
+		promhttp.HandlerFor(prometheus.Gatherers{targetsGatherer, prometheus.DefaultGatherer}, promhttp.HandlerOpts{
+			DisableCompression: *disableCompression,
+		}),
+	)
+	if *rateLimit > 0 {
+		metricsHandler = newRateLimiter(*rateLimit, *rateLimitBurst).limit(metricsHandler)
+	}
+	http.Handle(*metricsPath, metricsHandler)
+	http.Handle(peersSDPath, peersSDHandler(set))
+	if *debugDecodeSamples {
+		http.HandleFunc(decodeSamplesPath, decodeSamplesHandler)
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
              <head><title>Vega Metrics Exporter</title></head>
              <body>
              <h1>Vega Metrics Exporter</h1>
              <p><a href='` + *metricsPath + `'>Metrics</a></p>
+             <p><a href='` + peersSDPath + `'>Peers service discovery</a></p>
              </body>
              </html>`))
 	})
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+
+	var handler http.Handler = http.DefaultServeMux
+	if *allowedCIDRs != "" {
+		networks, err := parseCIDRs(*allowedCIDRs)
+		if err != nil {
+			logFatalf("Invalid --web.allowed-cidrs: %v", err)
+		}
+		handler = allowNetworks(networks, handler)
+	}
+
+	server := &http.Server{
+		Addr:              *listenAddress,
+		Handler:           handler,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		MaxHeaderBytes:    *maxHeaderBytes,
+	}
+	// A socket passed by systemd takes precedence over --web.listen-address
+	listener, err := activationListener()
+	if err != nil {
+		logFatalf("Error using socket from systemd: %v", err)
+	}
+	if listener == nil {
+		listener, err = net.Listen("tcp", *listenAddress)
+		if err != nil {
+			logFatalf("%v", err)
+		}
+	}
+
+	err = sdNotify("READY=1")
+	if err != nil {
+		logWarnf("Error notifying systemd: %v", err)
+	}
+	startWatchdog(*watchdogScrapeAge)
+
+	logFatalf("%v", server.Serve(listener))
 }
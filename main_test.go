@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLoadVegaStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		latest   string
+		earliest string
+		err      bool
+	}{
+		{"valid", "10", "1", false},
+		{"malformed latest height", "ten", "1", true},
+		{"malformed earliest height", "10", "one", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"jsonrpc": "2.0", "id": -1, "result": {"sync_info": {"latest_block_height": %q,
+					"latest_block_time": "2023-01-01T00:00:00Z", "earliest_block_height": %q, "catching_up": true}}}`,
+					test.latest, test.earliest)
+			}))
+			defer server.Close()
+			e := &Exporter{name: "status", rpc: NewRPCClient(server.URL, nil)}
+
+			ch := make(chan prometheus.Metric, 100)
+			_, err := e.LoadVegaStatus(context.Background(), ch)
+			close(ch)
+			var sent []string
+			for metric := range ch {
+				// The schema is reported whatever the body, to tell why it
+				// doesn't decode
+				if metric.Desc() == metricRPCSchema {
+					continue
+				}
+				key, _ := metricKey(t, metric)
+				sent = append(sent, key)
+			}
+			if (err != nil) != test.err {
+				t.Fatalf("error = %v, want an error: %v", err, test.err)
+			}
+			// A status that doesn't parse sends nothing
+			if test.err && len(sent) > 0 {
+				t.Errorf("metrics sent before the error: %v", sent)
+			}
+			if !test.err && len(sent) == 0 {
+				t.Error("no metric sent")
+			}
+		})
+	}
+}
+
+func TestGetVegaValidators(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"jsonrpc": "2.0", "id": -1, "result": {"n_peers": "3", "peers": [
+			{"node_info": {"id": "a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0", "moniker": "full"}},
+			{"node_info": {"id": "b1b1", "moniker": "short"}},
+			{"node_info": {"id": "", "moniker": "empty"}}]}}`)
+	}))
+	defer server.Close()
+	e := &Exporter{name: "net_info", rpc: NewRPCClient(server.URL, nil)}
+
+	ch := make(chan prometheus.Metric, 100)
+	validators, err := e.GetVegaValidators(context.Background(), ch)
+	close(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(validators) != 1 || validators[0].Name != "full" || validators[0].ShortAddress != "a0a0a0a0a0a0" {
+		t.Errorf("validators = %+v, want only the peer with a full ID", validators)
+	}
+}
+
+func TestBitArrayRatio(t *testing.T) {
+	tests := []struct {
+		bitArray string
+		ratio    float64
+		ok       bool
+	}{
+		{"BA{4:xx_x} 3/4 = 0.75", 0.75, true},
+		{"BA{4:____} 0/40 = 0.00", 0, true},
+		{"BA{1:x} 10/10 = 1", 1, true},
+		{"nil-BitArray", 0, false},
+		{"", 0, false},
+		{"BA{4:xx_x} 3/4 = ", 0, false},
+		{"BA{4:xx_x} 3/4 = n/a", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.bitArray, func(t *testing.T) {
+			ratio, ok := bitArrayRatio(test.bitArray)
+			if ratio != test.ratio || ok != test.ok {
+				t.Errorf("bitArrayRatio(%q) = %v, %v, want %v, %v", test.bitArray, ratio, ok, test.ratio, test.ok)
+			}
+		})
+	}
+}
+
+func TestLoadVegaConsensusValidatorInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case vegaConsensusUrl:
+			fmt.Fprint(w, `{"jsonrpc": "2.0", "id": -1, "result": {"round_state": {"validators": {"validators": [
+				{"address": "A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0", "pub_key": {"value": "key-a"}},
+				{"address": "B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1", "pub_key": {"value": "key-b"}}]},
+				"last_commit": {"votes": []}}}}`)
+		case vegaGenesisUrl:
+			fmt.Fprint(w, `{"jsonrpc": "2.0", "id": -1, "result": {"genesis": {"app_state": {"validators": {
+				"key-a": {"id": "vega-a", "tm_pub_key": "key-a", "name": "validator-a"}}}}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	e := &Exporter{name: "consensus", rpc: NewRPCClient(server.URL, nil)}
+	// Peers are matched on the prefix of the address like the votes, the
+	// Vega identity on the public key
+	peers := []VegaValidator{
+		{Name: "peer-a", Address: "a0a0a0a0a0a0ffffffffffffffffffffffffffff", ShortAddress: "a0a0a0a0a0a0"},
+		{Name: "peer-c", Address: "c2c2c2c2c2c2c2c2c2c2c2c2c2c2c2c2c2c2c2c2", ShortAddress: "c2c2c2c2c2c2"},
+	}
+
+	values, err := collect(t, collectorFunc(func(ctx context.Context, ch chan<- prometheus.Metric) error {
+		return e.LoadVegaConsensus(ctx, peers, ch)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{
+		`vega_validator_info{address="A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0",pub_key="key-a",validator="peer-a",vega_id="vega-a",vega_name="validator-a"}`,
+		`vega_validator_info{address="B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1",pub_key="key-b",validator="",vega_id="",vega_name=""}`,
+	} {
+		if values[key] != 1 {
+			t.Errorf("%s = %v, want 1 in %v", key, values[key], values)
+		}
+	}
+}
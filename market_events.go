@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/websocket"
+)
+
+const dataNodeEventBusUrl = "/api/v2/stream/event/bus"
+
+// Bus events followed by the market events collector
+const (
+	busEventPositionResolution = "BUS_EVENT_TYPE_POSITION_RESOLUTION"
+	busEventLedgerMovements    = "BUS_EVENT_TYPE_LEDGER_MOVEMENTS"
+	busEventSettleMarket       = "BUS_EVENT_TYPE_SETTLE_MARKET"
+)
+
+// Transfers of a margin search, moving collateral to a margin account below
+// its search level
+const transferTypeMarginLow = "TRANSFER_TYPE_MARGIN_LOW"
+
+// Transfers of a mark-to-market settlement
+var mtmTransferTypes = map[string]bool{
+	"TRANSFER_TYPE_MTM_LOSS": true,
+	"TRANSFER_TYPE_MTM_WIN":  true,
+}
+
+// DataNodeBusEvents is a batch of events of the data-node event bus.
+type DataNodeBusEvents struct {
+	Result struct {
+		Events []struct {
+			Type               string `json:"type"`
+			Block              string `json:"block"`
+			PositionResolution *struct {
+				MarketID   string `json:"marketId"`
+				Distressed int64  `json:"distressed,string"`
+				Closed     int64  `json:"closed,string"`
+			} `json:"positionResolution"`
+			LedgerMovements *struct {
+				LedgerMovements []struct {
+					Entries []struct {
+						Type        string `json:"type"`
+						FromAccount struct {
+							MarketID string `json:"marketId"`
+						} `json:"fromAccount"`
+						ToAccount struct {
+							MarketID string `json:"marketId"`
+						} `json:"toAccount"`
+					} `json:"entries"`
+				} `json:"ledgerMovements"`
+			} `json:"ledgerMovements"`
+			SettleMarket *struct {
+				MarketID string `json:"marketId"`
+			} `json:"settleMarket"`
+		} `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+var (
+	metricMarketClosedOutPositions = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "closed_out_positions_total"),
+		"Number of distressed positions closed out by the network since the exporter started.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketDistressedPositions = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "distressed_positions_total"),
+		"Number of distressed positions found by the position resolutions since the exporter started.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketMarginSearches = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "margin_searches_total"),
+		"Number of margin search transfers since the exporter started.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketMTMSettlements = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "mtm_settlements_total"),
+		"Number of mark-to-market settlements since the exporter started.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketLastMTMSettlement = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "last_mtm_settlement_timestamp_seconds"),
+		"Time the latest mark-to-market settlement of the market was received.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketFinalSettlements = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "final_settlements_total"),
+		"Number of final settlements of the market since the exporter started.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricDataNodeEventsUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datanode", "events_up"),
+		"Whether the exporter is subscribed to the event bus of the data node.",
+		nil, nil,
+	)
+	metricDataNodeEventsReconnects = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datanode", "events_reconnects_total"),
+		"Number of times the event bus subscription was set up again after failing.",
+		nil, nil,
+	)
+)
+
+// marketEventCounts are the events of a market counted by the collector.
+type marketEventCounts struct {
+	closedOut        float64
+	distressed       float64
+	marginSearches   float64
+	mtmSettlements   float64
+	finalSettlements float64
+	// Block of the latest mark-to-market settlement, a settlement moves
+	// collateral with many transfers of the same block
+	lastMTMBlock string
+	lastMTM      time.Time
+}
+
+// MarketEventsCollector counts the liquidations, margin searches and
+// settlements of the markets, read in the background from the event bus of the data node.
+type MarketEventsCollector struct {
+	dataNode *DataNodeClient
+	endpoint string
+	headers  map[string]string
+
+	mutex      sync.Mutex
+	connected  bool
+	reconnects float64
+	counts     map[string]*marketEventCounts
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewMarketEventsCollector(dataNode *DataNodeClient, config DataNodeConfig) *MarketEventsCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &MarketEventsCollector{
+		dataNode: dataNode,
+		endpoint: config.Endpoint,
+		headers:  config.Headers,
+		counts:   make(map[string]*marketEventCounts),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	go c.run()
+	return c
+}
+
+func (c *MarketEventsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricMarketClosedOutPositions
+	ch <- metricMarketDistressedPositions
+	ch <- metricMarketMarginSearches
+	ch <- metricMarketMTMSettlements
+	ch <- metricMarketLastMTMSettlement
+	ch <- metricMarketFinalSettlements
+	ch <- metricDataNodeEventsUp
+	ch <- metricDataNodeEventsReconnects
+}
+
+func (c *MarketEventsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	markets, err := listMarkets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing markets: %v", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var connected float64
+	if c.connected {
+		connected = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricDataNodeEventsUp, prometheus.GaugeValue, connected,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricDataNodeEventsReconnects, prometheus.CounterValue, c.reconnects,
+	)
+	for _, market := range markets {
+		counts, ok := c.counts[market.ID]
+		if !ok {
+			if market.closed() {
+				continue
+			}
+			counts = &marketEventCounts{}
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketClosedOutPositions, prometheus.CounterValue, counts.closedOut, market.ID, market.label(),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketDistressedPositions, prometheus.CounterValue, counts.distressed, market.ID, market.label(),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketMarginSearches, prometheus.CounterValue, counts.marginSearches, market.ID, market.label(),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketMTMSettlements, prometheus.CounterValue, counts.mtmSettlements, market.ID, market.label(),
+		)
+		if !counts.lastMTM.IsZero() {
+			ch <- prometheus.MustNewConstMetric(
+				metricMarketLastMTMSettlement, prometheus.GaugeValue, float64(counts.lastMTM.Unix()), market.ID, market.label(),
+			)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketFinalSettlements, prometheus.CounterValue, counts.finalSettlements, market.ID, market.label(),
+		)
+	}
+	return nil
+}
+
+// Close stops following the events.
+func (c *MarketEventsCollector) Close() error {
+	c.cancel()
+	return nil
+}
+
+// run keeps a subscription open until the collector is closed.
+func (c *MarketEventsCollector) run() {
+	for {
+		err := c.subscribe()
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.mutex.Lock()
+		c.connected = false
+		c.reconnects++
+		c.mutex.Unlock()
+		logWarnf("Event bus of %s: %v, reconnecting in %v", c.endpoint, err, websocketRetryInterval)
+
+		select {
+		case <-time.After(websocketRetryInterval):
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe reads the events of a new event bus subscription until it fails.
+func (c *MarketEventsCollector) subscribe() error {
+	ws, err := dialWebsocket(c.ctx, c.endpoint, dataNodeEventBusUrl, c.headers)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	go func() {
+		<-c.ctx.Done()
+		ws.Close()
+	}()
+
+	err = websocket.JSON.Send(ws, map[string]interface{}{
+		"type": []string{busEventPositionResolution, busEventLedgerMovements, busEventSettleMarket},
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.connected = true
+	c.mutex.Unlock()
+
+	for {
+		var message DataNodeBusEvents
+		ws.SetReadDeadline(time.Now().Add(websocketReadTimeout))
+		err := websocket.JSON.Receive(ws, &message)
+		if err != nil {
+			return err
+		}
+		if message.Error != nil {
+			return fmt.Errorf("subscription failed: %s", message.Error.Message)
+		}
+		c.handle(message, time.Now())
+	}
+}
+
+// handle counts the events of a batch received at the given time.
+func (c *MarketEventsCollector) handle(message DataNodeBusEvents, received time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, event := range message.Result.Events {
+		switch {
+		case event.Type == busEventPositionResolution && event.PositionResolution != nil:
+			counts := c.market(event.PositionResolution.MarketID)
+			counts.closedOut += float64(event.PositionResolution.Closed)
+			counts.distressed += float64(event.PositionResolution.Distressed)
+
+		case event.Type == busEventLedgerMovements && event.LedgerMovements != nil:
+			for _, movement := range event.LedgerMovements.LedgerMovements {
+				for _, entry := range movement.Entries {
+					if entry.Type == transferTypeMarginLow && entry.ToAccount.MarketID != "" {
+						c.market(entry.ToAccount.MarketID).marginSearches++
+					}
+					if !mtmTransferTypes[entry.Type] {
+						continue
+					}
+					market := entry.FromAccount.MarketID
+					if market == "" {
+						market = entry.ToAccount.MarketID
+					}
+					counts := c.market(market)
+					if counts.lastMTMBlock != event.Block {
+						counts.mtmSettlements++
+						counts.lastMTMBlock = event.Block
+					}
+					counts.lastMTM = received
+				}
+			}
+
+		case event.Type == busEventSettleMarket && event.SettleMarket != nil:
+			c.market(event.SettleMarket.MarketID).finalSettlements++
+		}
+	}
+}
+
+// market returns the counts of a market, the mutex must be held.
+func (c *MarketEventsCollector) market(id string) *marketEventCounts {
+	counts, ok := c.counts[id]
+	if !ok {
+		counts = &marketEventCounts{}
+		c.counts[id] = counts
+	}
+	return counts
+}
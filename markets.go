@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeMarketsUrl = "/api/v2/markets"
+const dataNodeMarketsDataUrl = "/api/v2/markets/data"
+const dataNodePositionsUrl = "/api/v2/positions"
+
+// dataNodeProduct is the part of a market product read by the exporter,
+// the same for futures and perpetuals.
+type dataNodeProduct struct {
+	SettlementAsset                 string `json:"settlementAsset"`
+	DataSourceSpecForSettlementData struct {
+		ID string `json:"id"`
+	} `json:"dataSourceSpecForSettlementData"`
+}
+
+type DataNodeMarket struct {
+	ID                    string `json:"id"`
+	State                 string `json:"state"`
+	TradingMode           string `json:"tradingMode"`
+	DecimalPlaces         string `json:"decimalPlaces"`
+	PositionDecimalPlaces string `json:"positionDecimalPlaces"`
+	TradableInstrument    struct {
+		Instrument struct {
+			Code    string `json:"code"`
+			Name    string `json:"name"`
+			Product struct {
+				Future    *dataNodeProduct `json:"future"`
+				Perpetual *dataNodeProduct `json:"perpetual"`
+			} `json:"product"`
+		} `json:"instrument"`
+	} `json:"tradableInstrument"`
+	Fees struct {
+		Factors struct {
+			MakerFee          string `json:"makerFee"`
+			InfrastructureFee string `json:"infrastructureFee"`
+			LiquidityFee      string `json:"liquidityFee"`
+		} `json:"factors"`
+	} `json:"fees"`
+}
+
+type DataNodeMarkets struct {
+	Markets struct {
+		Edges []struct {
+			Node DataNodeMarket `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"markets"`
+}
+
+type DataNodeMarketData struct {
+	Market            string `json:"market"`
+	MarkPrice         string `json:"markPrice"`
+	TargetStake       string `json:"targetStake"`
+	SuppliedStake     string `json:"suppliedStake"`
+	MarketTradingMode string `json:"marketTradingMode"`
+	MarketState       string `json:"marketState"`
+	Trigger           string `json:"trigger"`
+	AuctionStart      string `json:"auctionStart"`
+}
+
+type DataNodeMarketsData struct {
+	MarketsData []DataNodeMarketData `json:"marketsData"`
+}
+
+type DataNodePositions struct {
+	Positions struct {
+		Edges []struct {
+			Node struct {
+				MarketID   string `json:"marketId"`
+				PartyID    string `json:"partyId"`
+				OpenVolume string `json:"openVolume"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"positions"`
+}
+
+// Market states after which a market doesn't trade anymore
+var closedMarketStates = map[string]bool{
+	"STATE_REJECTED":  true,
+	"STATE_CANCELLED": true,
+	"STATE_CLOSED":    true,
+	"STATE_SETTLED":   true,
+}
+
+// Trading modes of the trading mode metric, always exported. Monitoring
+// auctions are split by their trigger. A mode missing here is exported on its
+// own once a market is in it.
+var tradingModes = []string{
+	"continuous",
+	"batch_auction",
+	"opening_auction",
+	"price_monitoring_auction",
+	"liquidity_auction",
+	"monitoring_auction",
+	"long_block_auction",
+	"suspended_via_governance",
+	"no_trading",
+}
+
+var (
+	metricMarkets = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "markets"),
+		"Number of markets by state.",
+		[]string{"state"}, nil,
+	)
+	metricPartiesWithPositions = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "parties_with_positions"),
+		"Number of distinct parties with an open position in any market still trading.",
+		nil, nil,
+	)
+	metricMarketTradingMode = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "trading_mode"),
+		"Trading mode of the market, 1 for the current mode and 0 for the others.",
+		[]string{"market_id", "market", "mode"}, nil,
+	)
+	metricMarketAuction = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "auction_seconds"),
+		"Time since the start of the auction the market is in.",
+		[]string{"market_id", "market"}, nil,
+	)
+)
+
+// MarketsCollector exports the number of markets and of parties with
+// positions, and the state of the markets still trading.
+type MarketsCollector struct {
+	dataNode *DataNodeClient
+}
+
+func NewMarketsCollector(dataNode *DataNodeClient) *MarketsCollector {
+	return &MarketsCollector{dataNode: dataNode}
+}
+
+func (c *MarketsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricMarkets
+	ch <- metricPartiesWithPositions
+	ch <- metricMarketTradingMode
+	ch <- metricMarketAuction
+}
+
+func (c *MarketsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	markets, err := listMarkets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing markets: %v", err)
+	}
+	marketsData, err := listMarketsData(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("reading market data: %v", err)
+	}
+	parties, err := c.partiesWithPositions(ctx, markets)
+	if err != nil {
+		return fmt.Errorf("listing positions: %v", err)
+	}
+
+	// The usual states are reported even without markets, for the others
+	// only once a market is in them
+	states := map[string]float64{"proposed": 0, "pending": 0, "active": 0, "suspended": 0, "settled": 0}
+	for _, market := range markets {
+		states[strings.ToLower(strings.TrimPrefix(market.State, "STATE_"))]++
+	}
+	for state, count := range states {
+		ch <- prometheus.MustNewConstMetric(
+			metricMarkets, prometheus.GaugeValue, count, state,
+		)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricPartiesWithPositions, prometheus.GaugeValue, parties,
+	)
+
+	for _, market := range markets {
+		if market.closed() {
+			continue
+		}
+		data, ok := marketsData[market.ID]
+		if !ok {
+			data = DataNodeMarketData{MarketTradingMode: market.TradingMode}
+		}
+
+		mode := tradingMode(data.MarketTradingMode, data.Trigger)
+		listed := false
+		for _, known := range tradingModes {
+			value := 0.0
+			if known == mode {
+				value = 1
+				listed = true
+			}
+			ch <- prometheus.MustNewConstMetric(
+				metricMarketTradingMode, prometheus.GaugeValue, value, market.ID, market.label(), known,
+			)
+		}
+		if !listed && mode != "" {
+			ch <- prometheus.MustNewConstMetric(
+				metricMarketTradingMode, prometheus.GaugeValue, 1, market.ID, market.label(), mode,
+			)
+		}
+		if strings.HasSuffix(mode, "auction") && data.AuctionStart != "" && data.AuctionStart != "0" {
+			start, err := parseUnixNano(data.AuctionStart)
+			if err != nil {
+				return fmt.Errorf("market %s: auction start: %v", market.ID, err)
+			}
+			ch <- prometheus.MustNewConstMetric(
+				metricMarketAuction, prometheus.GaugeValue, time.Since(start).Seconds(), market.ID, market.label(),
+			)
+		}
+	}
+	return nil
+}
+
+// partiesWithPositions returns the number of distinct parties with a
+// non-zero open volume. Only the positions of the markets still trading are
+// listed, those of closed markets are all closed out.
+func (c *MarketsCollector) partiesWithPositions(ctx context.Context, markets []DataNodeMarket) (float64, error) {
+	filter := url.Values{}
+	for _, market := range markets {
+		if !market.closed() {
+			filter.Add("filter.marketIds", market.ID)
+		}
+	}
+	if len(filter) == 0 {
+		return 0, nil
+	}
+
+	parties := make(map[string]bool)
+	cursor := ""
+	for {
+		var page DataNodePositions
+		err := c.dataNode.Get(ctx, dataNodePage(dataNodePositionsUrl, cursor)+"&"+filter.Encode(), &page)
+		if err != nil {
+			return 0, err
+		}
+		for _, edge := range page.Positions.Edges {
+			if edge.Node.OpenVolume != "" && edge.Node.OpenVolume != "0" {
+				parties[edge.Node.PartyID] = true
+			}
+		}
+		if !page.Positions.PageInfo.HasNextPage {
+			return float64(len(parties)), nil
+		}
+		cursor = page.Positions.PageInfo.EndCursor
+	}
+}
+
+// tradingMode returns the mode label of a trading mode of the data node,
+// telling monitoring auctions triggered by prices and by liquidity apart.
+func tradingMode(mode string, trigger string) string {
+	name := strings.ToLower(strings.TrimPrefix(mode, "TRADING_MODE_"))
+	if name == "monitoring_auction" {
+		switch {
+		case trigger == "AUCTION_TRIGGER_PRICE":
+			return "price_monitoring_auction"
+		case strings.HasPrefix(trigger, "AUCTION_TRIGGER_LIQUIDITY"):
+			return "liquidity_auction"
+		}
+	}
+	return name
+}
+
+// closed tells whether the market is done trading, per market metrics skip
+// those markets.
+func (m DataNodeMarket) closed() bool {
+	return closedMarketStates[m.State]
+}
+
+// perpetual tells whether the market trades a perpetual, which receives
+// settlement data all along rather than at expiry.
+func (m DataNodeMarket) perpetual() bool {
+	return m.TradableInstrument.Instrument.Product.Perpetual != nil
+}
+
+// product returns the future or perpetual of the market.
+func (m DataNodeMarket) product() dataNodeProduct {
+	product := m.TradableInstrument.Instrument.Product
+	if product.Future != nil {
+		return *product.Future
+	}
+	if product.Perpetual != nil {
+		return *product.Perpetual
+	}
+	return dataNodeProduct{}
+}
+
+// label returns the market code used in the market label.
+func (m DataNodeMarket) label() string {
+	return labelValue(m.TradableInstrument.Instrument.Code)
+}
+
+// listMarkets returns the markets of the data node.
+func listMarkets(ctx context.Context, dataNode *DataNodeClient) ([]DataNodeMarket, error) {
+	var markets []DataNodeMarket
+	cursor := ""
+	for {
+		var page DataNodeMarkets
+		err := dataNode.Get(ctx, dataNodePage(dataNodeMarketsUrl, cursor), &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range page.Markets.Edges {
+			markets = append(markets, edge.Node)
+		}
+		if !page.Markets.PageInfo.HasNextPage {
+			return markets, nil
+		}
+		cursor = page.Markets.PageInfo.EndCursor
+	}
+}
+
+// listMarketsData returns the current data of every market by market ID.
+func listMarketsData(ctx context.Context, dataNode *DataNodeClient) (map[string]DataNodeMarketData, error) {
+	var data DataNodeMarketsData
+	err := dataNode.Get(ctx, dataNodeMarketsDataUrl, &data)
+	if err != nil {
+		return nil, err
+	}
+	byMarket := make(map[string]DataNodeMarketData)
+	for _, marketData := range data.MarketsData {
+		byMarket[marketData.Market] = marketData
+	}
+	return byMarket, nil
+}
+
+// parseAmount converts an amount of the data node, in the smallest unit of
+// an asset, to units of the asset. Empty amounts are 0.
+func parseAmount(value string, decimals int) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	amount, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	return assetAmount(amount, decimals), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTradingMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		trigger string
+		want    string
+	}{
+		{"TRADING_MODE_CONTINUOUS", "AUCTION_TRIGGER_UNSPECIFIED", "continuous"},
+		{"TRADING_MODE_OPENING_AUCTION", "AUCTION_TRIGGER_OPENING", "opening_auction"},
+		{"TRADING_MODE_MONITORING_AUCTION", "AUCTION_TRIGGER_PRICE", "price_monitoring_auction"},
+		{"TRADING_MODE_MONITORING_AUCTION", "AUCTION_TRIGGER_LIQUIDITY_TARGET_NOT_MET", "liquidity_auction"},
+		{"TRADING_MODE_MONITORING_AUCTION", "AUCTION_TRIGGER_GOVERNANCE_SUSPENSION", "monitoring_auction"},
+		{"TRADING_MODE_LONG_BLOCK_AUCTION", "AUCTION_TRIGGER_LONG_BLOCK", "long_block_auction"},
+		{"TRADING_MODE_SUSPENDED_VIA_GOVERNANCE", "", "suspended_via_governance"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			if mode := tradingMode(test.mode, test.trigger); mode != test.want {
+				t.Errorf("tradingMode(%q, %q) = %q, want %q", test.mode, test.trigger, mode, test.want)
+			}
+		})
+	}
+}
+
+func TestMarketsTradingMode(t *testing.T) {
+	modes := map[string]string{
+		"m1": "TRADING_MODE_CONTINUOUS",
+		"m2": "TRADING_MODE_LONG_BLOCK_AUCTION",
+		"m3": "TRADING_MODE_FUTURE_AUCTION",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case dataNodeMarketsUrl:
+			var edges []interface{}
+			for id := range modes {
+				edges = append(edges, map[string]interface{}{"node": map[string]interface{}{
+					"id": id, "state": "STATE_ACTIVE",
+					"tradableInstrument": map[string]interface{}{"instrument": map[string]string{"code": id}},
+				}})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"markets": map[string]interface{}{"edges": edges}})
+		case dataNodeMarketsDataUrl:
+			var data []interface{}
+			for id, mode := range modes {
+				data = append(data, map[string]string{"market": id, "marketTradingMode": mode})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"marketsData": data})
+		case dataNodePositionsUrl:
+			json.NewEncoder(w).Encode(map[string]interface{}{"positions": map[string]interface{}{}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	values, err := collect(t, NewMarketsCollector(NewDataNodeClient(server.URL, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := make(map[string]string)
+	for market := range modes {
+		for _, mode := range append(tradingModes, "future_auction") {
+			key := `vega_market_trading_mode{market="` + market + `",market_id="` + market + `",mode="` + mode + `"}`
+			value, ok := values[key]
+			if value == 1 {
+				if current[market] != "" {
+					t.Errorf("market %s in both %s and %s", market, current[market], mode)
+				}
+				current[market] = mode
+			}
+			if !ok && mode != "future_auction" {
+				t.Errorf("%s not exported", key)
+			}
+		}
+	}
+	want := map[string]string{"m1": "continuous", "m2": "long_block_auction", "m3": "future_auction"}
+	for market, mode := range want {
+		if current[market] != mode {
+			t.Errorf("market %s in mode %q, want %q", market, current[market], mode)
+		}
+	}
+}
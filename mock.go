@@ -0,0 +1,1212 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Scenarios served by the mock command
+const (
+	mockHealthy          = "healthy"
+	mockCatchingUp       = "catching-up"
+	mockValidatorMissing = "validator-missing"
+	mockZeroPeers        = "zero-peers"
+)
+
+var mockScenarios = []string{mockHealthy, mockCatchingUp, mockValidatorMissing, mockZeroPeers}
+
+// Consensus addresses and keys of the mocked validators. As on a real
+// network, the p2p node ID of each is the hash of another key and has nothing
+// in common with its consensus address.
+var mockValidators = []struct {
+	moniker string
+	nodeID  string
+	address string
+	pubKey  string
+}{
+	{"mock-validator-0", "0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d0d00", "A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0A0", "oKCgoKCgoKCgoKCgoKCgoKCgoKCgoKCgoKCgoKCgoKA="},
+	{"mock-validator-1", "1d1d1d1d1d1d1d1d1d1d1d1d1d1d1d1d1d1d1d11", "B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1B1", "sbGxsbGxsbGxsbGxsbGxsbGxsbGxsbGxsbGxsbGxsbE="},
+	{"mock-validator-2", "2d2d2d2d2d2d2d2d2d2d2d2d2d2d2d2d2d2d2d22", "C2C2C2C2C2C2C2C2C2C2C2C2C2C2C2C2C2C2C2C2", "wsLCwsLCwsLCwsLCwsLCwsLCwsLCwsLCwsLCwsI="},
+}
+
+// mockNode serves canned Tendermint RPC responses for a scenario. The chain
+// produces a block per second from the start of the mock.
+type mockNode struct {
+	scenario string
+	start    time.Time
+}
+
+// mock serves a fake Tendermint RPC until the process is stopped.
+func mock() {
+	valid := false
+	for _, scenario := range mockScenarios {
+		valid = valid || scenario == *mockScenario
+	}
+	if !valid {
+		logFatalf("Unknown mock scenario %q, expected one of %s", *mockScenario, strings.Join(mockScenarios, ", "))
+	}
+
+	node := &mockNode{scenario: *mockScenario, start: time.Now()}
+	mux := http.NewServeMux()
+	mux.HandleFunc(vegaStatusUrl, node.handle(node.status))
+	mux.HandleFunc(netInfo, node.handle(node.netInfo))
+	mux.HandleFunc(vegaConsensusUrl, node.handle(node.consensus))
+	mux.HandleFunc(vegaAbciInfoUrl, node.handle(node.abciInfo))
+	mux.HandleFunc(vegaGenesisUrl, node.handle(node.genesis))
+	mux.HandleFunc(vegaHealthUrl, node.handle(func() interface{} { return map[string]interface{}{} }))
+	mux.HandleFunc(vegaBlockchainUrl, node.handleHeight(node.blockchain))
+	mux.HandleFunc(vegaCommitUrl, node.handleHeight(node.commit))
+	mux.HandleFunc(vegaValidatorsUrl, node.handleHeight(node.validators))
+	mux.HandleFunc(vegaBlockResultsUrl, node.handleHeight(node.blockResults))
+	mux.Handle(vegaWebsocketUrl, websocket.Handler(node.events))
+	// Data-node REST API, so that the mock can also be the data node of a
+	// target
+	mux.HandleFunc(dataNodeNodesUrl, node.handleREST(node.nodes))
+	mux.HandleFunc(dataNodeKeyRotationsUrl, node.handleREST(func() interface{} {
+		// The second validator rotated its Vega key at height 5
+		return map[string]interface{}{"rotations": map[string]interface{}{
+			"edges": []interface{}{map[string]interface{}{"node": map[string]string{
+				"nodeId": fmt.Sprintf("%064x", 2), "oldPubKey": fmt.Sprintf("%064x", 0xf01),
+				"newPubKey": fmt.Sprintf("%064x", 0x101), "blockHeight": "5",
+			}}},
+			"pageInfo": map[string]interface{}{"hasNextPage": false},
+		}}
+	}))
+	mux.HandleFunc(dataNodeEthereumKeyRotationsUrl, node.handleREST(func() interface{} {
+		return map[string]interface{}{"keyRotations": map[string]interface{}{
+			"edges":    []interface{}{},
+			"pageInfo": map[string]interface{}{"hasNextPage": false},
+		}}
+	}))
+	mux.HandleFunc(dataNodeDelegationsUrl, node.delegations)
+	mux.HandleFunc(dataNodeAssetsUrl, node.handleREST(node.assets))
+	mux.HandleFunc(dataNodeAssetUrl+mockAssetVEGA, node.handleREST(func() interface{} {
+		return map[string]interface{}{"asset": map[string]interface{}{
+			"id": mockAssetVEGA,
+			"details": map[string]interface{}{
+				"symbol": "VEGA",
+				"erc20":  map[string]string{"contractAddress": "0x1111111111111111111111111111111111111111"},
+			},
+		}}
+	}))
+	mux.HandleFunc(dataNodeNetworkParametersUrl+networkParameterRewardAsset, node.handleREST(func() interface{} {
+		return map[string]interface{}{"networkParameter": map[string]string{
+			"key": networkParameterRewardAsset, "value": mockAssetVEGA,
+		}}
+	}))
+	mux.HandleFunc(dataNodeNodesDataUrl, node.handleREST(func() interface{} {
+		return map[string]interface{}{"nodeData": map[string]string{"stakedTotal": mockStake(32500000).String()}}
+	}))
+	mux.HandleFunc(dataNodeWithdrawalsUrl, node.withdrawals)
+	mux.HandleFunc(dataNodeWithdrawalUrl, node.withdrawal)
+	mux.HandleFunc(dataNodeHistorySegmentsUrl, node.handleREST(node.historySegments))
+	mux.HandleFunc(dataNodeHistoryPeersUrl, node.handleREST(func() interface{} {
+		return map[string]interface{}{"connectedPeers": []interface{}{
+			map[string]string{"id": "12D3KooWmock1"}, map[string]string{"id": "12D3KooWmock2"},
+		}}
+	}))
+	mux.HandleFunc(dataNodeMarketsUrl, node.handleREST(node.markets))
+	mux.HandleFunc(dataNodeMarketsDataUrl, node.handleREST(node.marketsData))
+	mux.HandleFunc(dataNodePositionsUrl, node.positions)
+	mux.HandleFunc(dataNodeLiquidityProvisionsUrl, node.handleREST(node.liquidityProvisions))
+	mux.HandleFunc(dataNodeTradesUrl, node.trades)
+	mux.HandleFunc(dataNodeGovernanceUrl, node.handleREST(node.governance))
+	mux.HandleFunc(dataNodeAccountsUrl, node.accounts)
+	mux.HandleFunc(dataNodeEpochUrl, node.epoch)
+	mux.Handle(dataNodeEventBusUrl, websocket.Handler(node.busEvents))
+	mux.HandleFunc(dataNodeOracleSpecsUrl, node.handleREST(node.oracleSpecs))
+	mux.HandleFunc(dataNodeOracleDataUrl, node.oracleData)
+	mux.HandleFunc(dataNodeEpochRewardSummariesUrl, node.handleREST(node.epochRewardSummaries))
+	mux.HandleFunc(dataNodeRewardsUrl, node.handleREST(node.rewards))
+	mux.HandleFunc(mockEthereumUrl, node.ethereum)
+	// Wallet service
+	mux.HandleFunc(walletHealthUrl, node.handleREST(func() interface{} { return map[string]interface{}{} }))
+	mux.HandleFunc("/api/v2/version", node.handleREST(func() interface{} {
+		return map[string]string{"version": "v0.73.0"}
+	}))
+	// Faucet
+	mux.HandleFunc(faucetHealthUrl, node.handleREST(func() interface{} { return map[string]interface{}{} }))
+	// Block explorer API, indexing up to two blocks behind the node
+	mux.HandleFunc(blockExplorerInfoUrl, node.handleREST(func() interface{} {
+		height, _ := node.height()
+		return map[string]string{"version": "v0.73.0", "commitHash": "0123456789abcdef", "height": strconv.FormatInt(height-2, 10)}
+	}))
+
+	logInfof("Serving mock Tendermint RPC on %s, scenario %s", *mockListenAddress, node.scenario)
+	logFatalf("%v", http.ListenAndServe(*mockListenAddress, mux))
+}
+
+func (n *mockNode) handle(result func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Compressed like the responses of the Tendermint RPC
+		var body io.Writer = w
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			body = gz
+		}
+		json.NewEncoder(body).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      -1,
+			"result":  result(),
+		})
+	}
+}
+
+// handleREST serves a data-node REST response, which isn't wrapped in a
+// JSON-RPC envelope.
+func (n *mockNode) handleREST(result func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result())
+	}
+}
+
+// handleHeight passes the height query parameter, the latest height when
+// missing, to result. The minHeight and maxHeight of /blockchain are read by
+// the handler itself.
+func (n *mockNode) handleHeight(result func(r *http.Request, height int64) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		height, _ := n.height()
+		if value := r.URL.Query().Get("height"); value != "" {
+			requested, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || requested < 1 || requested > height {
+				http.Error(w, fmt.Sprintf("height %s is not available", value), http.StatusInternalServerError)
+				return
+			}
+			height = requested
+		}
+		n.handle(func() interface{} { return result(r, height) })(w, r)
+	}
+}
+
+// height returns the latest height and the time of its block.
+func (n *mockNode) height() (int64, time.Time) {
+	if n.scenario == mockCatchingUp {
+		// Blocks from an hour ago replayed ten times faster than real time
+		elapsed := time.Since(n.start)
+		return 1 + int64(elapsed.Seconds()*10), n.start.Add(-time.Hour).Add(elapsed * 10)
+	}
+	elapsed := time.Since(n.start).Truncate(time.Second)
+	return 1 + int64(elapsed.Seconds()), n.start.Add(elapsed)
+}
+
+func (n *mockNode) status() interface{} {
+	height, blockTime := n.height()
+	return map[string]interface{}{
+		"node_info": map[string]interface{}{
+			"protocol_version": map[string]string{"p2p": "8", "block": "11", "app": "1"},
+			"id":               mockValidators[0].nodeID,
+			"listen_addr":      "tcp://0.0.0.0:26656",
+			"network":          "vega-mock",
+			"version":          "0.34.24",
+			"channels":         "40202122233038606100",
+			"moniker":          mockValidators[0].moniker,
+			"other":            map[string]string{"tx_index": "on", "rpc_address": "tcp://0.0.0.0:26657"},
+		},
+		"sync_info": map[string]interface{}{
+			"latest_block_hash":     mockHash("block", height),
+			"latest_app_hash":       mockHash("app", height),
+			"latest_block_height":   fmt.Sprint(height),
+			"latest_block_time":     blockTime,
+			"earliest_block_hash":   mockHash("block", 1),
+			"earliest_app_hash":     mockHash("app", 1),
+			"earliest_block_height": "1",
+			"earliest_block_time":   n.start,
+			"catching_up":           n.scenario == mockCatchingUp,
+		},
+		"validator_info": map[string]interface{}{
+			"address":      mockValidators[0].address,
+			"pub_key":      map[string]string{"type": "tendermint/PubKeyEd25519", "value": mockValidators[0].pubKey},
+			"voting_power": "10",
+		},
+	}
+}
+
+func (n *mockNode) netInfo() interface{} {
+	peers := []interface{}{}
+	if n.scenario != mockZeroPeers {
+		for i, validator := range mockValidators[1:] {
+			peers = append(peers, map[string]interface{}{
+				"node_info": map[string]interface{}{
+					"id":          validator.nodeID,
+					"listen_addr": fmt.Sprintf("tcp://10.0.0.%d:26656", i+1),
+					"network":     "vega-mock",
+					"moniker":     validator.moniker,
+					"other":       map[string]string{"tx_index": "on", "rpc_address": "tcp://0.0.0.0:26657"},
+				},
+				"is_outbound": i%2 == 0,
+				"remote_ip":   fmt.Sprintf("10.0.0.%d", i+1),
+			})
+		}
+	}
+	return map[string]interface{}{
+		"listening": true,
+		"listeners": []string{"Listener(@0.0.0.0:26656)"},
+		"n_peers":   fmt.Sprint(len(peers)),
+		"peers":     peers,
+	}
+}
+
+func (n *mockNode) consensus() interface{} {
+	height, blockTime := n.height()
+
+	validators := []interface{}{}
+	votes := []interface{}{}
+	for i, validator := range mockValidators {
+		validators = append(validators, map[string]interface{}{
+			"address":           validator.address,
+			"pub_key":           map[string]string{"type": "tendermint/PubKeyEd25519", "value": validator.pubKey},
+			"voting_power":      "10",
+			"proposer_priority": "0",
+		})
+		if n.scenario == mockValidatorMissing && i == len(mockValidators)-1 {
+			votes = append(votes, "nil-Vote")
+			continue
+		}
+		votes = append(votes, fmt.Sprintf(
+			"Vote{%d:%s %d/00/SIGNED_MSG_TYPE_PRECOMMIT(Precommit) %s %s @ %s}",
+			i, validator.address[:12], height, mockHash("block", height)[:12], "000000000000",
+			blockTime.UTC().Format(time.RFC3339Nano),
+		))
+	}
+
+	// Rounds of the next height so far: a failed one first when it takes
+	// two, then the current one waiting for the proposal
+	roundVotes := []interface{}{}
+	for round := 0; round <= mockRound(height+1); round++ {
+		prevotes, precommits := "BA{3:___} 0/30 = 0.00", "BA{3:___} 0/30 = 0.00"
+		if round < mockRound(height+1) {
+			prevotes, precommits = "BA{3:xx_} 20/30 = 0.67", "BA{3:x__} 10/30 = 0.33"
+		}
+		roundVotes = append(roundVotes, map[string]interface{}{
+			"round":                round,
+			"prevotes":             []string{"nil-Vote", "nil-Vote", "nil-Vote"},
+			"prevotes_bit_array":   prevotes,
+			"precommits":           []string{"nil-Vote", "nil-Vote", "nil-Vote"},
+			"precommits_bit_array": precommits,
+		})
+	}
+
+	return map[string]interface{}{
+		"round_state": map[string]interface{}{
+			"height":      fmt.Sprint(height + 1),
+			"round":       mockRound(height + 1),
+			"step":        1,
+			"start_time":  blockTime.Add(time.Second),
+			"commit_time": blockTime,
+			"validators": map[string]interface{}{
+				"validators": validators,
+				"proposer":   validators[int(height)%len(validators)],
+			},
+			"locked_round": -1,
+			"valid_round":  -1,
+			"votes":        roundVotes,
+			"commit_round": -1,
+			"last_commit": map[string]interface{}{
+				"votes":           votes,
+				"votes_bit_array": "",
+				"peer_maj_23s":    map[string]interface{}{},
+			},
+			"last_validators": map[string]interface{}{
+				"validators": validators,
+				"proposer":   validators[int(height-1)%len(validators)],
+			},
+			"triggered_timeout_precommit": mockRound(height+1) > 0,
+		},
+		"peers": []interface{}{},
+	}
+}
+
+func (n *mockNode) genesis() interface{} {
+	validators := make(map[string]interface{})
+	for i, validator := range mockValidators {
+		validators[validator.pubKey] = map[string]interface{}{
+			"id":                 fmt.Sprintf("%064x", i+1),
+			"vega_pub_key":       fmt.Sprintf("%064x", 0x100+i),
+			"vega_pub_key_index": 1,
+			"ethereum_address":   fmt.Sprintf("0x%040x", 0x200+i),
+			"tm_pub_key":         validator.pubKey,
+			"name":               validator.moniker,
+		}
+	}
+	return map[string]interface{}{
+		"genesis": map[string]interface{}{
+			"chain_id":  "vega-mock",
+			"app_state": map[string]interface{}{"validators": validators},
+		},
+	}
+}
+
+// Path of the mocked Ethereum JSON-RPC endpoint
+const mockEthereumUrl = "/ethereum"
+
+// ethereum serves the calls of the staking bridge and staking collectors.
+// Ethereum blocks follow the Tendermint ones, with a deposit every 10 blocks
+// and a removal every 25 blocks, of 100 VEGA each. The VEGA token has a
+// supply of 64999723.
+func (n *mockNode) ethereum(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	latest, _ := n.height()
+	token := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+
+	var result interface{}
+	switch request.Method {
+	case "eth_blockNumber":
+		result = fmt.Sprintf("0x%x", latest)
+	case "eth_call":
+		var call struct {
+			Data string `json:"data"`
+		}
+		if len(request.Params) > 0 {
+			json.Unmarshal(request.Params[0], &call)
+		}
+		supply := big.NewInt(1000000)
+		if call.Data == erc20TotalSupply {
+			supply = big.NewInt(64999723)
+		}
+		result = fmt.Sprintf("0x%064x", new(big.Int).Mul(supply, token))
+	case "eth_getLogs":
+		var filter struct {
+			FromBlock string `json:"fromBlock"`
+			ToBlock   string `json:"toBlock"`
+		}
+		if len(request.Params) > 0 {
+			json.Unmarshal(request.Params[0], &filter)
+		}
+		from, _ := parseQuantity(filter.FromBlock)
+		to, _ := parseQuantity(filter.ToBlock)
+		amount := fmt.Sprintf("0x%064x", new(big.Int).Mul(big.NewInt(100), token))
+		logs := []interface{}{}
+		for block := from; block <= to; block++ {
+			for event, every := range map[string]int64{"deposited": 10, "removed": 25} {
+				if block%every == 0 {
+					logs = append(logs, map[string]interface{}{
+						"blockNumber": fmt.Sprintf("0x%x", block),
+						"topics":      []string{stakingBridgeEvents[event]},
+						"data":        amount,
+						"removed":     false,
+					})
+				}
+			}
+		}
+		result = logs
+	default:
+		http.Error(w, "unknown method "+request.Method, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+}
+
+// Heights per network history segment of the mock
+const mockHistorySegmentBlocks = 10
+
+// historySegments returns a segment for every complete range of
+// mockHistorySegmentBlocks heights.
+func (n *mockNode) historySegments() interface{} {
+	height, _ := n.height()
+	segments := []interface{}{}
+	for to := int64(mockHistorySegmentBlocks); to <= height; to += mockHistorySegmentBlocks {
+		segments = append(segments, map[string]string{
+			"fromHeight":       strconv.FormatInt(to-mockHistorySegmentBlocks+1, 10),
+			"toHeight":         strconv.FormatInt(to, 10),
+			"historySegmentId": fmt.Sprintf("Qm%044d", to),
+		})
+	}
+	return map[string]interface{}{"segments": segments}
+}
+
+// IDs of the mocked assets
+const (
+	mockAssetVEGA = "d1984e3d365faa05bcafbe41f50f90e3663ee7c0da22bb1e24b164e9532691b2"
+	mockAssetUSDT = "bf1e88d19db4b3ca0d1d5bdb73718a01686b18cf731ca26adedf3c8b83802bba"
+)
+
+func (n *mockNode) assets() interface{} {
+	var edges []interface{}
+	for id, details := range map[string][]string{mockAssetVEGA: {"VEGA", "18"}, mockAssetUSDT: {"USDT", "6"}} {
+		edges = append(edges, map[string]interface{}{
+			"node": map[string]interface{}{
+				"id":      id,
+				"details": map[string]string{"symbol": details[0], "decimals": details[1]},
+			},
+		})
+	}
+	return map[string]interface{}{"assets": map[string]interface{}{
+		"edges":    edges,
+		"pageInfo": map[string]interface{}{"hasNextPage": false},
+	}}
+}
+
+// mockWithdrawals returns a submitted withdrawal, one of 10 VEGA pending for
+// an hour and a pending one of 250 USDT created with the mock, oldest first.
+func (n *mockNode) mockWithdrawals() []map[string]string {
+	withdrawal := func(id, asset, amount string, created time.Time, txHash string) map[string]string {
+		return map[string]string{
+			"id":               id,
+			"asset":            asset,
+			"amount":           amount,
+			"status":           withdrawalStatusFinalized,
+			"createdTimestamp": strconv.FormatInt(created.UnixNano(), 10),
+			"txHash":           txHash,
+		}
+	}
+	return []map[string]string{
+		withdrawal("w1", mockAssetUSDT, "1000000", n.start.Add(-24*time.Hour), "0xabc"),
+		withdrawal("w3", mockAssetVEGA, "10000000000000000000", n.start.Add(-time.Hour), ""),
+		withdrawal("w2", mockAssetUSDT, "250000000", n.start, ""),
+	}
+}
+
+// withdrawals lists the withdrawals created from the
+// dateRange.startTimestamp query parameter.
+func (n *mockNode) withdrawals(w http.ResponseWriter, r *http.Request) {
+	start, _ := strconv.ParseInt(r.URL.Query().Get("dateRange.startTimestamp"), 10, 64)
+	edges := []interface{}{}
+	for _, withdrawal := range n.mockWithdrawals() {
+		created, _ := strconv.ParseInt(withdrawal["createdTimestamp"], 10, 64)
+		if created >= start {
+			edges = append(edges, map[string]interface{}{"node": withdrawal})
+		}
+	}
+	n.handleREST(func() interface{} {
+		return map[string]interface{}{"withdrawals": map[string]interface{}{
+			"edges":    edges,
+			"pageInfo": map[string]interface{}{"hasNextPage": false},
+		}}
+	})(w, r)
+}
+
+// withdrawal returns the withdrawal of the ID ending the path.
+func (n *mockNode) withdrawal(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, dataNodeWithdrawalUrl)
+	for _, withdrawal := range n.mockWithdrawals() {
+		if withdrawal["id"] == id {
+			n.handleREST(func() interface{} {
+				return map[string]interface{}{"withdrawal": withdrawal}
+			})(w, r)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// IDs of the mocked markets: a perpetual still trading and a settled future
+const (
+	mockMarketPerpetual = "4e9081e20e9e81f3e747d42cb0c9b8826454df01899e6027a22e771e19cc79fc"
+	mockMarketSettled   = "2c2ea995d7366e423be7604f63ce047aa7186eb030ecc7b77395eae2fcbffcc5"
+)
+
+func (n *mockNode) markets() interface{} {
+	market := func(id, code, state, tradingMode, productKind string) interface{} {
+		return map[string]interface{}{"node": map[string]interface{}{
+			"id":                    id,
+			"state":                 state,
+			"tradingMode":           tradingMode,
+			"decimalPlaces":         "2",
+			"positionDecimalPlaces": "2",
+			"tradableInstrument": map[string]interface{}{
+				"instrument": map[string]interface{}{
+					"code": code,
+					"name": code,
+					"product": map[string]interface{}{
+						productKind: map[string]interface{}{
+							"settlementAsset":                 mockAssetUSDT,
+							"dataSourceSpecForSettlementData": map[string]string{"id": "spec-" + code},
+						},
+					},
+				},
+			},
+			"fees": map[string]interface{}{"factors": map[string]string{
+				"makerFee":          "0.0002",
+				"infrastructureFee": "0.0005",
+				"liquidityFee":      "0.001",
+			}},
+		}}
+	}
+	return map[string]interface{}{"markets": map[string]interface{}{
+		"edges": []interface{}{
+			market(mockMarketPerpetual, "BTCUSDT.PERP", "STATE_ACTIVE", "TRADING_MODE_CONTINUOUS", "perpetual"),
+			market(mockMarketSettled, "ETHUSDT.MF21", "STATE_SETTLED", "TRADING_MODE_NO_TRADING", "future"),
+		},
+		"pageInfo": map[string]interface{}{"hasNextPage": false},
+	}}
+}
+
+// positions lists the positions of three parties on the perpetual market,
+// one of them closed, and of one of them on the settled future, in the
+// markets of the filter.marketIds query parameters.
+func (n *mockNode) positions(w http.ResponseWriter, r *http.Request) {
+	markets := make(map[string]bool)
+	for _, market := range r.URL.Query()["filter.marketIds"] {
+		markets[market] = true
+	}
+	edges := []interface{}{}
+	position := func(market, party, openVolume string) {
+		if len(markets) > 0 && !markets[market] {
+			return
+		}
+		edges = append(edges, map[string]interface{}{"node": map[string]string{
+			"marketId": market, "partyId": party, "openVolume": openVolume,
+		}})
+	}
+	position(mockMarketPerpetual, mockParty, "150")
+	position(mockMarketPerpetual, "party-2", "-150")
+	position(mockMarketPerpetual, "party-3", "0")
+	position(mockMarketSettled, mockParty, "200")
+	n.handleREST(func() interface{} {
+		return map[string]interface{}{"positions": map[string]interface{}{
+			"edges":    edges,
+			"pageInfo": map[string]interface{}{"hasNextPage": false},
+		}}
+	})(w, r)
+}
+
+// marketsData puts the perpetual market in a price monitoring auction for
+// the last ten seconds of every thirty.
+func (n *mockNode) marketsData() interface{} {
+	data := map[string]string{
+		"market":            mockMarketPerpetual,
+		"markPrice":         "6500000",
+		"targetStake":       "50000000000",
+		"suppliedStake":     "75000000000",
+		"marketTradingMode": "TRADING_MODE_CONTINUOUS",
+		"marketState":       "STATE_ACTIVE",
+	}
+	elapsed := time.Since(n.start)
+	if cycle := elapsed % (30 * time.Second); cycle >= 20*time.Second {
+		data["marketTradingMode"] = "TRADING_MODE_MONITORING_AUCTION"
+		data["marketState"] = "STATE_SUSPENDED"
+		data["trigger"] = "AUCTION_TRIGGER_PRICE"
+		data["auctionStart"] = strconv.FormatInt(n.start.Add(elapsed-cycle+20*time.Second).UnixNano(), 10)
+	}
+	return map[string]interface{}{"marketsData": []interface{}{data}}
+}
+
+// trades lists two trades of 1.5 contracts at 65000 per block of the
+// perpetual market, from the dateRange.startTimestamp query parameter.
+func (n *mockNode) trades(w http.ResponseWriter, r *http.Request) {
+	start, _ := strconv.ParseInt(r.URL.Query().Get("dateRange.startTimestamp"), 10, 64)
+	edges := []interface{}{}
+	if r.URL.Query().Get("marketIds") == mockMarketPerpetual {
+		latest, _ := n.height()
+		for height := int64(1); height <= latest; height++ {
+			timestamp := n.start.Add(time.Duration(height-1) * time.Second).UnixNano()
+			if timestamp < start {
+				continue
+			}
+			for i := 0; i < 2; i++ {
+				edges = append(edges, map[string]interface{}{"node": map[string]string{
+					"id":        fmt.Sprintf("trade-%d-%d", height, i),
+					"price":     "6500000",
+					"size":      "150",
+					"timestamp": strconv.FormatInt(timestamp, 10),
+				}})
+			}
+		}
+	}
+	n.handleREST(func() interface{} {
+		return map[string]interface{}{"trades": map[string]interface{}{
+			"edges":    edges,
+			"pageInfo": map[string]interface{}{"hasNextPage": false},
+		}}
+	})(w, r)
+}
+
+// accounts lists the accounts of the filter.accountTypes query parameters:
+// the insurance pools of both markets, the one of the perpetual shrinking by
+// 10 USDT per block, the network treasury in VEGA and reward pools.
+func (n *mockNode) accounts(w http.ResponseWriter, r *http.Request) {
+	height, _ := n.height()
+	types := make(map[string]bool)
+	for _, accountType := range r.URL.Query()["filter.accountTypes"] {
+		types[accountType] = true
+	}
+	edges := []interface{}{}
+	account := func(owner, balance, asset, market, accountType string) {
+		if len(types) > 0 && !types[accountType] {
+			return
+		}
+		edges = append(edges, map[string]interface{}{"node": map[string]string{
+			"owner":    owner,
+			"balance":  balance,
+			"asset":    asset,
+			"marketId": market,
+			"type":     accountType,
+		}})
+	}
+	account("network", fmt.Sprint(100000000000-height*10000000), mockAssetUSDT, mockMarketPerpetual, accountTypeInsurance)
+	account("network", "2500000000", mockAssetUSDT, mockMarketSettled, accountTypeInsurance)
+	account("network", "3000000000000000000000000", mockAssetVEGA, "", accountTypeNetworkTreasury)
+	account("network", "50000000000000000000000", mockAssetVEGA, "", "ACCOUNT_TYPE_GLOBAL_REWARD")
+	account("network", "2000000000", mockAssetUSDT, "strategy-1", "ACCOUNT_TYPE_REWARD_MAKER_PAID_FEES")
+	account("network", "500000000", mockAssetUSDT, "strategy-2", "ACCOUNT_TYPE_REWARD_MAKER_PAID_FEES")
+
+	n.handleREST(func() interface{} {
+		return map[string]interface{}{"accounts": map[string]interface{}{
+			"edges":    edges,
+			"pageInfo": map[string]interface{}{"hasNextPage": false},
+		}}
+	})(w, r)
+}
+
+// busEvents streams the events of the data-node event bus: a position
+// resolution closing out 2 of 3 distressed positions of the perpetual market
+// every five blocks, a margin search every other block and a mark-to-market
+// settlement every three blocks. The future settles at block 10.
+func (n *mockNode) busEvents(ws *websocket.Conn) {
+	defer ws.Close()
+	var request struct {
+		Type []string `json:"type"`
+	}
+	err := websocket.JSON.Receive(ws, &request)
+	if err != nil {
+		return
+	}
+
+	last, _ := n.height()
+	for {
+		time.Sleep(50 * time.Millisecond)
+		latest, _ := n.height()
+		if latest == last {
+			continue
+		}
+		last = latest
+
+		var events []interface{}
+		if latest%5 == 0 {
+			events = append(events, map[string]interface{}{
+				"type": busEventPositionResolution,
+				"positionResolution": map[string]string{
+					"marketId": mockMarketPerpetual, "distressed": "3", "closed": "2",
+				},
+			})
+		}
+		if latest%2 == 0 {
+			events = append(events, map[string]interface{}{
+				"type": busEventLedgerMovements,
+				"ledgerMovements": map[string]interface{}{"ledgerMovements": []interface{}{
+					map[string]interface{}{"entries": []interface{}{
+						map[string]interface{}{
+							"type":      transferTypeMarginLow,
+							"toAccount": map[string]string{"marketId": mockMarketPerpetual},
+						},
+					}},
+				}},
+			})
+		}
+		if latest%3 == 0 {
+			entry := func(transferType string) interface{} {
+				return map[string]interface{}{
+					"type":        transferType,
+					"fromAccount": map[string]string{"marketId": mockMarketPerpetual},
+					"toAccount":   map[string]string{"marketId": mockMarketPerpetual},
+				}
+			}
+			events = append(events, map[string]interface{}{
+				"type":  busEventLedgerMovements,
+				"block": mockHash("block", latest),
+				"ledgerMovements": map[string]interface{}{"ledgerMovements": []interface{}{
+					map[string]interface{}{"entries": []interface{}{entry("TRANSFER_TYPE_MTM_LOSS")}},
+					map[string]interface{}{"entries": []interface{}{entry("TRANSFER_TYPE_MTM_WIN")}},
+				}},
+			})
+		}
+		if latest == 10 {
+			events = append(events, map[string]interface{}{
+				"type":         busEventSettleMarket,
+				"settleMarket": map[string]string{"marketId": mockMarketSettled},
+			})
+		}
+		if len(events) == 0 {
+			continue
+		}
+		err := websocket.JSON.Send(ws, map[string]interface{}{"result": map[string]interface{}{"events": events}})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// oracleSpecs lists the settlement data sources of both markets, the one of
+// the settled future no longer active.
+func (n *mockNode) oracleSpecs() interface{} {
+	spec := func(id, status string) interface{} {
+		return map[string]interface{}{"node": map[string]interface{}{
+			"externalDataSourceSpec": map[string]interface{}{
+				"spec": map[string]string{"id": id, "status": status},
+			},
+		}}
+	}
+	return map[string]interface{}{"oracleSpecs": map[string]interface{}{
+		"edges": []interface{}{
+			spec("spec-BTCUSDT.PERP", oracleSpecStatusActive),
+			spec("spec-ETHUSDT.MF21", "STATUS_DEACTIVATED"),
+		},
+		"pageInfo": map[string]interface{}{"hasNextPage": false},
+	}}
+}
+
+// oracleData submits data for the perpetual market every five blocks, listed
+// after the block of the pagination.after cursor.
+func (n *mockNode) oracleData(w http.ResponseWriter, r *http.Request) {
+	after, _ := strconv.ParseInt(r.URL.Query().Get("pagination.after"), 10, 64)
+	height, _ := n.height()
+	edges := []interface{}{}
+	endCursor := ""
+	for block := int64(5); block <= height; block += 5 {
+		if block <= after {
+			continue
+		}
+		endCursor = strconv.FormatInt(block, 10)
+		edges = append(edges, map[string]interface{}{"node": map[string]interface{}{
+			"externalData": map[string]interface{}{
+				"data": map[string]interface{}{
+					"matchedSpecIds": []string{"spec-BTCUSDT.PERP"},
+					"broadcastAt":    strconv.FormatInt(n.start.Add(time.Duration(block-1)*time.Second).UnixNano(), 10),
+				},
+			},
+		}})
+	}
+	n.handleREST(func() interface{} {
+		return map[string]interface{}{"oracleData": map[string]interface{}{
+			"edges":    edges,
+			"pageInfo": map[string]interface{}{"hasNextPage": false, "endCursor": endCursor},
+		}}
+	})(w, r)
+}
+
+// mockEpochBlocks is the number of blocks of a mocked epoch
+const mockEpochBlocks = 10
+
+// currentEpoch returns the epoch of the latest block.
+func (n *mockNode) currentEpoch() int64 {
+	height, _ := n.height()
+	return (height-1)/mockEpochBlocks + 1
+}
+
+// epoch serves the epoch of the id query parameter, the current one when
+// missing.
+func (n *mockNode) epoch(w http.ResponseWriter, r *http.Request) {
+	seq := n.currentEpoch()
+	if value := r.URL.Query().Get("id"); value != "" {
+		requested, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || requested < 1 || requested > seq {
+			http.Error(w, fmt.Sprintf("epoch %s not found", value), http.StatusNotFound)
+			return
+		}
+		seq = requested
+	}
+	firstBlock := (seq-1)*mockEpochBlocks + 1
+	start := n.start.Add(time.Duration(firstBlock-1) * time.Second)
+	timestamps := map[string]string{
+		"startTime":  strconv.FormatInt(start.UnixNano(), 10),
+		"expiryTime": strconv.FormatInt(start.Add(mockEpochBlocks*time.Second).UnixNano(), 10),
+		"firstBlock": strconv.FormatInt(firstBlock, 10),
+	}
+	if seq < n.currentEpoch() {
+		// Epochs roll over with the first block after their expiry, a
+		// quarter of a second late
+		timestamps["endTime"] = strconv.FormatInt(start.Add(mockEpochBlocks*time.Second+250*time.Millisecond).UnixNano(), 10)
+		timestamps["lastBlock"] = strconv.FormatInt(firstBlock+mockEpochBlocks-1, 10)
+	}
+	n.handleREST(func() interface{} {
+		return map[string]interface{}{"epoch": map[string]interface{}{
+			"seq":        strconv.FormatInt(seq, 10),
+			"timestamps": timestamps,
+		}}
+	})(w, r)
+}
+
+// epochRewardSummaries pays 120 USDT of infrastructure fees and 1000 VEGA
+// of staking rewards for every completed epoch.
+func (n *mockNode) epochRewardSummaries() interface{} {
+	var edges []interface{}
+	for epoch := int64(1); epoch < n.currentEpoch(); epoch++ {
+		summary := func(asset, market, rewardType, amount string) interface{} {
+			return map[string]interface{}{"node": map[string]string{
+				"epoch":      strconv.FormatInt(epoch, 10),
+				"assetId":    asset,
+				"marketId":   market,
+				"rewardType": rewardType,
+				"amount":     amount,
+			}}
+		}
+		edges = append(edges,
+			summary(mockAssetUSDT, mockMarketPerpetual, rewardTypeInfrastructureFees, "90000000"),
+			summary(mockAssetUSDT, "", rewardTypeInfrastructureFees, "30000000"),
+			summary(mockAssetVEGA, "", "ACCOUNT_TYPE_GLOBAL_REWARD", "1000000000000000000000"),
+		)
+	}
+	return map[string]interface{}{"summaries": map[string]interface{}{
+		"edges":    edges,
+		"pageInfo": map[string]interface{}{"hasNextPage": false},
+	}}
+}
+
+// rewards gives mockParty a third of the infrastructure fees of every
+// completed epoch.
+func (n *mockNode) rewards() interface{} {
+	var edges []interface{}
+	for epoch := int64(1); epoch < n.currentEpoch(); epoch++ {
+		edges = append(edges, map[string]interface{}{"node": map[string]string{
+			"epoch":      strconv.FormatInt(epoch, 10),
+			"assetId":    mockAssetUSDT,
+			"partyId":    mockParty,
+			"rewardType": rewardTypeInfrastructureFees,
+			"amount":     "40000000",
+		}})
+	}
+	return map[string]interface{}{"rewards": map[string]interface{}{
+		"edges":    edges,
+		"pageInfo": map[string]interface{}{"hasNextPage": false},
+	}}
+}
+
+// mockParty is the party voting on the mocked proposals
+const mockParty = "f4c3d2b1a0f4c3d2b1a0f4c3d2b1a0f4c3d2b1a0f4c3d2b1a0f4c3d2b1a0f4c3"
+
+// governance lists two open proposals, closing a day and twelve hours after
+// the start of the mock. mockParty only voted on the first one.
+func (n *mockNode) governance() interface{} {
+	proposal := func(id, title string, closing time.Duration, yes, no []interface{}) interface{} {
+		return map[string]interface{}{"node": map[string]interface{}{
+			"proposal": map[string]interface{}{
+				"id":        id,
+				"reference": id,
+				"state":     proposalStateOpen,
+				"terms": map[string]string{
+					"closingTimestamp": strconv.FormatInt(n.start.Add(closing).Unix(), 10),
+				},
+				"rationale": map[string]string{"title": title},
+			},
+			"yes": yes,
+			"no":  no,
+		}}
+	}
+	vote := func(party, weight string) interface{} {
+		return map[string]string{"partyId": party, "totalGovernanceTokenWeight": weight}
+	}
+	return map[string]interface{}{"connection": map[string]interface{}{
+		"edges": []interface{}{
+			proposal("proposal-1", "Update network parameter", 24*time.Hour,
+				[]interface{}{vote(mockParty, mockStake(8125000).String()), vote("party-2", mockStake(3250000).String())},
+				[]interface{}{vote("party-3", mockStake(1625000).String())}),
+			proposal("proposal-2", "New market BTCUSDT.PERP", 12*time.Hour,
+				[]interface{}{vote("party-2", mockStake(3250000).String())}, []interface{}{}),
+		},
+		"pageInfo": map[string]interface{}{"hasNextPage": false},
+	}}
+}
+
+// liquidityProvisions returns two active commitments of 50000 and 25000 USDT
+// and a cancelled one.
+func (n *mockNode) liquidityProvisions() interface{} {
+	provision := func(id, amount, status string) interface{} {
+		return map[string]interface{}{"node": map[string]string{
+			"id":               id,
+			"partyId":          id,
+			"commitmentAmount": amount,
+			"status":           status,
+		}}
+	}
+	return map[string]interface{}{"liquidityProvisions": map[string]interface{}{
+		"edges": []interface{}{
+			provision("lp1", "50000000000", liquidityStatusActive),
+			provision("lp2", "25000000000", liquidityStatusActive),
+			provision("lp3", "10000000000", "STATUS_CANCELLED"),
+		},
+		"pageInfo": map[string]interface{}{"hasNextPage": false},
+	}}
+}
+
+// nodes lists the validators as the data node does, all with the voting
+// power of the Tendermint validator set. The last validator rotates its
+// Tendermint key every ten seconds, so that it never matches the set.
+func (n *mockNode) nodes() interface{} {
+	var edges []interface{}
+	for i, validator := range mockValidators {
+		tmPubKey := validator.pubKey
+		if i == len(mockValidators)-1 {
+			tmPubKey = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%032d", int(time.Since(n.start).Seconds()/10))))
+		}
+		edges = append(edges, map[string]interface{}{
+			"node": map[string]interface{}{
+				"id":              fmt.Sprintf("%064x", i+1),
+				"pubKey":          fmt.Sprintf("%064x", 0x100+i),
+				"tmPubKey":        tmPubKey,
+				"ethereumAddress": fmt.Sprintf("0x%040x", 0x200+i),
+				"name":            validator.moniker,
+				"stakedTotal":     mockStake(mockValidatorStakes[i]).String(),
+				"rankingScore":    map[string]interface{}{"votingPower": 10},
+			},
+		})
+	}
+	return map[string]interface{}{"nodes": map[string]interface{}{"edges": edges}}
+}
+
+// VEGA staked on each mocked validator by its operator and a delegator
+var mockValidatorStakes = []int64{10000000, 12500000, 10000000}
+
+// mockStake returns an amount of VEGA in its smallest unit.
+func mockStake(tokens int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(tokens), new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+}
+
+// delegations lists the delegations of the epochId query parameter. Every
+// validator is staked half by its operator and half by a delegator; for the
+// next epoch the delegator of the second one adds 1000000 VEGA and the one of
+// the third removes 500000.
+func (n *mockNode) delegations(w http.ResponseWriter, r *http.Request) {
+	epoch, _ := strconv.ParseInt(r.URL.Query().Get("epochId"), 10, 64)
+	edges := []interface{}{}
+	if epoch <= n.currentEpoch()+1 {
+		for i, stake := range mockValidatorStakes {
+			delegated := stake / 2
+			if epoch == n.currentEpoch()+1 {
+				delegated += []int64{0, 1000000, -500000}[i]
+			}
+			for party, amount := range map[string]int64{fmt.Sprintf("operator-%d", i): stake / 2, fmt.Sprintf("delegator-%d", i): delegated} {
+				edges = append(edges, map[string]interface{}{"node": map[string]string{
+					"party":    party,
+					"nodeId":   fmt.Sprintf("%064x", i+1),
+					"amount":   mockStake(amount).String(),
+					"epochSeq": strconv.FormatInt(epoch, 10),
+				}})
+			}
+		}
+	}
+	n.handleREST(func() interface{} {
+		return map[string]interface{}{"delegations": map[string]interface{}{
+			"edges":    edges,
+			"pageInfo": map[string]interface{}{"hasNextPage": false},
+		}}
+	})(w, r)
+}
+
+func (n *mockNode) abciInfo() interface{} {
+	height, _ := n.height()
+	return map[string]interface{}{
+		"response": map[string]string{
+			"data":                "Vega",
+			"version":             "v0.73.0",
+			"app_version":         "1",
+			"last_block_height":   fmt.Sprint(height),
+			"last_block_app_hash": mockHash("app", height),
+		},
+	}
+}
+
+func (n *mockNode) blockchain(r *http.Request, height int64) interface{} {
+	max := height
+	if value, err := strconv.ParseInt(r.URL.Query().Get("maxHeight"), 10, 64); err == nil && value < max {
+		max = value
+	}
+	min := max - blockchainPageSize + 1
+	if value, err := strconv.ParseInt(r.URL.Query().Get("minHeight"), 10, 64); err == nil && value > min {
+		min = value
+	}
+	if min < 1 {
+		min = 1
+	}
+
+	metas := []interface{}{}
+	for h := max; h >= min; h-- {
+		metas = append(metas, map[string]interface{}{
+			"block_id":   map[string]interface{}{"hash": mockHash("block", h)},
+			"block_size": "1024",
+			"header": map[string]interface{}{
+				"chain_id":         "vega-mock",
+				"height":           fmt.Sprint(h),
+				"time":             n.start.Add(time.Duration(h-1) * time.Second),
+				"app_hash":         mockHash("app", h),
+				"proposer_address": mockValidators[int(h)%len(mockValidators)].address,
+			},
+			"num_txs": fmt.Sprint(h % 5),
+		})
+	}
+	return map[string]interface{}{
+		"last_height": fmt.Sprint(height),
+		"block_metas": metas,
+	}
+}
+
+// commit returns the commit of a height. Absent validators sign with an empty
+// address, like Tendermint does.
+func (n *mockNode) commit(r *http.Request, height int64) interface{} {
+	signatures := []interface{}{}
+	for i, validator := range mockValidators {
+		signature := map[string]interface{}{
+			"block_id_flag":     2,
+			"validator_address": validator.address,
+			"timestamp":         n.start.Add(time.Duration(height)*time.Second + time.Duration(i)*100*time.Millisecond),
+			"signature":         "",
+		}
+		if n.scenario == mockValidatorMissing && i == len(mockValidators)-1 {
+			signature["block_id_flag"] = blockIDFlagAbsent
+			signature["validator_address"] = ""
+			signature["timestamp"] = time.Time{}
+			signature["signature"] = nil
+		}
+		signatures = append(signatures, signature)
+	}
+	latest, _ := n.height()
+	return map[string]interface{}{
+		"signed_header": map[string]interface{}{
+			"header": map[string]interface{}{
+				"chain_id": "vega-mock",
+				"height":   fmt.Sprint(height),
+				"time":     n.start.Add(time.Duration(height-1) * time.Second),
+				"app_hash": mockHash("app", height),
+			},
+			"commit": map[string]interface{}{
+				"height":     fmt.Sprint(height),
+				"round":      mockRound(height),
+				"block_id":   map[string]interface{}{"hash": mockHash("block", height)},
+				"signatures": signatures,
+			},
+		},
+		"canonical": height < latest,
+	}
+}
+
+func (n *mockNode) validators(r *http.Request, height int64) interface{} {
+	validators := []interface{}{}
+	for _, validator := range mockValidators {
+		validators = append(validators, map[string]interface{}{
+			"address":           validator.address,
+			"pub_key":           map[string]string{"type": "tendermint/PubKeyEd25519", "value": validator.pubKey},
+			"voting_power":      "10",
+			"proposer_priority": "0",
+		})
+	}
+	return map[string]interface{}{
+		"block_height": fmt.Sprint(height),
+		"validators":   validators,
+		"count":        fmt.Sprint(len(validators)),
+		"total":        fmt.Sprint(len(validators)),
+	}
+}
+
+// blockResults returns a transaction per block, failing at every fifth height.
+func (n *mockNode) blockResults(r *http.Request, height int64) interface{} {
+	code := 0
+	if height%5 == 0 {
+		code = 1
+	}
+	return map[string]interface{}{
+		"height": fmt.Sprint(height),
+		"txs_results": []interface{}{
+			map[string]interface{}{
+				"code":   code,
+				"events": []interface{}{map[string]interface{}{"type": "tx", "attributes": []interface{}{}}},
+			},
+		},
+		"begin_block_events": []interface{}{},
+		"end_block_events":   []interface{}{},
+	}
+}
+
+// events sends a NewRound event at every height, followed by the prevotes and
+// precommits of the validators a hundred milliseconds apart, once subscribed.
+func (n *mockNode) events(ws *websocket.Conn) {
+	defer ws.Close()
+	var request struct {
+		ID interface{} `json:"id"`
+	}
+	var subscriptions []interface{}
+	for len(subscriptions) < 2 {
+		err := websocket.JSON.Receive(ws, &request)
+		if err != nil {
+			return
+		}
+		subscriptions = append(subscriptions, request.ID)
+		websocket.JSON.Send(ws, map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "result": map[string]interface{}{}})
+	}
+
+	send := func(id interface{}, eventType string, value interface{}) error {
+		return websocket.JSON.Send(ws, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"result": map[string]interface{}{
+				"data": map[string]interface{}{"type": eventType, "value": value},
+			},
+		})
+	}
+	last, _ := n.height()
+	for {
+		time.Sleep(50 * time.Millisecond)
+		latest, _ := n.height()
+		if latest == last {
+			continue
+		}
+		last = latest
+
+		height := fmt.Sprint(latest + 1)
+		err := send(subscriptions[0], "tendermint/event/NewRound", map[string]interface{}{
+			"height": height, "round": 0, "step": "RoundStepNewRound",
+		})
+		if err != nil {
+			return
+		}
+		for _, voteType := range []int{voteTypePrevote, voteTypePrevote + 1} {
+			for i, validator := range mockValidators {
+				if n.scenario == mockValidatorMissing && i == len(mockValidators)-1 {
+					continue
+				}
+				time.Sleep(100 * time.Millisecond)
+				err := send(subscriptions[1], "tendermint/event/Vote", map[string]interface{}{
+					"Vote": map[string]interface{}{
+						"type":              voteType,
+						"height":            height,
+						"round":             0,
+						"timestamp":         time.Now(),
+						"validator_address": validator.address,
+						"validator_index":   i,
+					},
+				})
+				if err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// mockRound returns the round at which a height committed, every seventh
+// height needs a second round.
+func mockRound(height int64) int {
+	if height%7 == 0 {
+		return 1
+	}
+	return 0
+}
+
+// mockHash returns a stable fake hash for a height.
+func mockHash(kind string, height int64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", kind, height)))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeHistorySegmentsUrl = "/api/v2/networkhistory/segments"
+const dataNodeHistoryPeersUrl = "/api/v2/networkhistory/peers"
+
+type DataNodeHistorySegments struct {
+	Segments []struct {
+		FromHeight       string `json:"fromHeight"`
+		ToHeight         string `json:"toHeight"`
+		HistorySegmentID string `json:"historySegmentId"`
+	} `json:"segments"`
+}
+
+type DataNodeHistoryPeers struct {
+	ConnectedPeers []struct {
+		ID string `json:"id"`
+	} `json:"connectedPeers"`
+}
+
+var (
+	metricHistorySegmentLatestHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "network_history", "latest_segment_height"),
+		"Last height of the latest network history segment of the data node.",
+		nil, nil,
+	)
+	metricHistorySegmentCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "network_history", "segments"),
+		"Number of network history segments held by the data node.",
+		nil, nil,
+	)
+	metricHistoryPeers = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "network_history", "peers"),
+		"Number of IPFS swarm peers the data node shares network history with.",
+		nil, nil,
+	)
+)
+
+// NetworkHistoryCollector exports the network history segments of the data
+// node and its IPFS peers, to confirm that history is produced and shared
+// for decentralised history.
+type NetworkHistoryCollector struct {
+	dataNode *DataNodeClient
+}
+
+func NewNetworkHistoryCollector(dataNode *DataNodeClient) *NetworkHistoryCollector {
+	return &NetworkHistoryCollector{dataNode: dataNode}
+}
+
+func (c *NetworkHistoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricHistorySegmentLatestHeight
+	ch <- metricHistorySegmentCount
+	ch <- metricHistoryPeers
+}
+
+func (c *NetworkHistoryCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var segments DataNodeHistorySegments
+	err := c.dataNode.Get(ctx, dataNodeHistorySegmentsUrl, &segments)
+	if err != nil {
+		return err
+	}
+
+	var latest float64
+	for _, segment := range segments.Segments {
+		height, err := strconv.ParseFloat(segment.ToHeight, 64)
+		if err != nil {
+			return fmt.Errorf("segment %s: invalid height %q", segment.HistorySegmentID, segment.ToHeight)
+		}
+		if height > latest {
+			latest = height
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricHistorySegmentLatestHeight, prometheus.GaugeValue, latest,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricHistorySegmentCount, prometheus.GaugeValue, float64(len(segments.Segments)),
+	)
+
+	var peers DataNodeHistoryPeers
+	err = c.dataNode.Get(ctx, dataNodeHistoryPeersUrl, &peers)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricHistoryPeers, prometheus.GaugeValue, float64(len(peers.ConnectedPeers)),
+	)
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Weight of the latest sample in the smoothed sync rate
+const syncRateSmoothing = 0.3
+
+var (
+	metricCatchingUpDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sync", "catching_up_seconds"),
+		"Time the node has been catching up for, 0 once it caught up.",
+		nil, nil,
+	)
+	metricSyncRate = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sync", "rate_blocks_per_second"),
+		"Blocks the node gains per second on the tip of the chain while catching up, smoothed over the scrapes.",
+		nil, nil,
+	)
+	metricSyncBlocksBehind = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sync", "blocks_behind"),
+		"Blocks the node still has to catch up, behind the reference node when one is configured, estimated from the latest block time otherwise.",
+		nil, nil,
+	)
+	metricSyncETA = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sync", "eta_seconds"),
+		"Estimated time until the node caught up at the current sync rate, only while it gains on the chain.",
+		nil, nil,
+	)
+)
+
+// syncTracker follows a node catching up across the /status of the scrapes.
+// The tip of the chain is the latest height of the reference node when one is
+// configured. Without one, the node gains on the chain when its latest block
+// time moves faster than the clock, and blocks are counted at the rate the
+// chain produced the blocks it replayed.
+type syncTracker struct {
+	// When catching_up turned true, zero while the node is synced
+	since time.Time
+
+	// Previous sample, zero when there is none
+	sampled   time.Time
+	height    int64
+	blockTime time.Time
+	reference int64
+
+	// Blocks per second of chain time
+	chainRate float64
+	// Smoothed blocks gained per second, once measured, and blocks left
+	rate     float64
+	measured bool
+	behind   float64
+}
+
+// update records a sample of /status, with the latest height of the
+// reference node or 0 when there is none.
+func (t *syncTracker) update(catchingUp bool, height int64, blockTime time.Time, reference int64) {
+	now := time.Now()
+	if !catchingUp {
+		*t = syncTracker{}
+		return
+	}
+	if t.since.IsZero() {
+		t.since = now
+	}
+
+	if !t.sampled.IsZero() {
+		elapsed := now.Sub(t.sampled).Seconds()
+		blocks := float64(height - t.height)
+		chainTime := blockTime.Sub(t.blockTime).Seconds()
+		if chainTime > 0 && blocks > 0 {
+			t.chainRate = blocks / chainTime
+		}
+		var gained float64
+		measured := elapsed > 0
+		switch {
+		case reference > 0 && t.reference > 0:
+			gained = (blocks - float64(reference-t.reference)) / elapsed
+		case t.chainRate > 0:
+			gained = blocks/elapsed - t.chainRate
+		default:
+			measured = false
+		}
+		if measured {
+			if !t.measured {
+				t.rate = gained
+			} else {
+				t.rate = syncRateSmoothing*gained + (1-syncRateSmoothing)*t.rate
+			}
+			t.measured = true
+		}
+	}
+
+	switch {
+	case reference > 0:
+		t.behind = float64(reference - height)
+	case t.chainRate > 0:
+		t.behind = now.Sub(blockTime).Seconds() * t.chainRate
+	}
+	if t.behind < 0 {
+		t.behind = 0
+	}
+	t.sampled = now
+	t.height = height
+	t.blockTime = blockTime
+	t.reference = reference
+}
+
+// referenceHeight returns the latest height of the reference node, or 0
+// without one or when it can't be read.
+func (e *Exporter) referenceHeight(ctx context.Context) int64 {
+	if e.reference == nil {
+		return 0
+	}
+	height, err := latestHeight(ctx, e.reference)
+	if err != nil {
+		logDebugf("Reference height of %s: %v", e.name, err)
+		return 0
+	}
+	return height
+}
+
+func (t *syncTracker) collect(ch chan<- prometheus.Metric) {
+	var duration float64
+	if !t.since.IsZero() {
+		duration = time.Since(t.since).Seconds()
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricCatchingUpDuration, prometheus.GaugeValue, duration,
+	)
+	if t.reference > 0 || t.chainRate > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			metricSyncBlocksBehind, prometheus.GaugeValue, t.behind,
+		)
+	}
+	// The rate needs two samples
+	if !t.measured {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricSyncRate, prometheus.GaugeValue, t.rate,
+	)
+	if t.rate > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			metricSyncETA, prometheus.GaugeValue, t.behind/t.rate,
+		)
+	}
+}
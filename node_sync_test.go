@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSyncTracker(t *testing.T) {
+	now := time.Now()
+	type sample struct {
+		catchingUp bool
+		height     int64
+		blockTime  time.Time
+		reference  int64
+	}
+	tests := []struct {
+		name    string
+		samples []sample
+		want    map[string]float64
+	}{
+		{"synced", []sample{{false, 100, now, 0}},
+			map[string]float64{"vega_sync_catching_up_seconds": 0}},
+		{"single sample", []sample{{true, 100, now.Add(-time.Hour), 1000}},
+			map[string]float64{"vega_sync_blocks_behind": 900}},
+		// 200 blocks while the reference made 100, over 10s
+		{"with a reference", []sample{{true, 100, now.Add(-time.Hour), 1000}, {true, 300, now.Add(-50 * time.Minute), 1100}},
+			map[string]float64{"vega_sync_blocks_behind": 800, "vega_sync_rate_blocks_per_second": 10, "vega_sync_eta_seconds": 80}},
+		// 100 blocks made in 50s of chain time replayed in 10s
+		{"from the block times", []sample{{true, 100, now.Add(-1000 * time.Second), 0}, {true, 200, now.Add(-950 * time.Second), 0}},
+			map[string]float64{"vega_sync_blocks_behind": 1900, "vega_sync_rate_blocks_per_second": 8, "vega_sync_eta_seconds": 237.5}},
+		{"losing ground", []sample{{true, 100, now.Add(-time.Hour), 1000}, {true, 150, now.Add(-time.Hour), 1100}},
+			map[string]float64{"vega_sync_blocks_behind": 950, "vega_sync_rate_blocks_per_second": -5}},
+		{"caught up", []sample{{true, 100, now.Add(-time.Hour), 1000}, {false, 1000, now, 1000}},
+			map[string]float64{"vega_sync_catching_up_seconds": 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var tracker syncTracker
+			for _, s := range test.samples {
+				// Samples are 10s apart
+				if !tracker.sampled.IsZero() {
+					tracker.sampled = tracker.sampled.Add(-10 * time.Second)
+				}
+				tracker.update(s.catchingUp, s.height, s.blockTime, s.reference)
+			}
+			ch := make(chan prometheus.Metric, 10)
+			tracker.collect(ch)
+			close(ch)
+			values := make(map[string]float64)
+			for metric := range ch {
+				key, value := metricKey(t, metric)
+				values[key] = value
+			}
+			// The catch-up duration only depends on the clock
+			if _, ok := test.want["vega_sync_catching_up_seconds"]; !ok {
+				delete(values, "vega_sync_catching_up_seconds")
+			}
+			if len(values) != len(test.want) {
+				t.Errorf("metrics = %v, want %v", values, test.want)
+			}
+			for key, want := range test.want {
+				if got, ok := values[key]; !ok || math.Abs(got-want) > math.Abs(want)*0.01 {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
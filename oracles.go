@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeOracleSpecsUrl = "/api/v2/oracle/specs"
+const dataNodeOracleDataUrl = "/api/v2/oracle/data"
+
+// Data-source specs still matching oracle data
+const oracleSpecStatusActive = "STATUS_ACTIVE"
+
+type DataNodeOracleSpecs struct {
+	OracleSpecs struct {
+		Edges []struct {
+			Node struct {
+				ExternalDataSourceSpec struct {
+					Spec struct {
+						ID     string `json:"id"`
+						Status string `json:"status"`
+					} `json:"spec"`
+				} `json:"externalDataSourceSpec"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"oracleSpecs"`
+}
+
+type DataNodeOracleData struct {
+	OracleData struct {
+		Edges []struct {
+			Node struct {
+				ExternalData struct {
+					Data struct {
+						MatchedSpecIDs []string `json:"matchedSpecIds"`
+						BroadcastAt    string   `json:"broadcastAt"`
+					} `json:"data"`
+				} `json:"externalData"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"oracleData"`
+}
+
+var (
+	metricOracleSpecsActive = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "oracle", "specs_active"),
+		"Number of active data-source specs.",
+		nil, nil,
+	)
+	metricOracleData = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "oracle", "data_submissions"),
+		"Number of oracle data submissions kept by the data node, listed since the exporter started.",
+		nil, nil,
+	)
+	metricMarketSettlementDataAge = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "settlement_data_age_seconds"),
+		"Time since the settlement data source of the market last produced data.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketSettlementDataStale = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "settlement_data_stale"),
+		"Whether the settlement data source of the perpetual market produced no data within --collector.oracles.max-age.",
+		[]string{"market_id", "market"}, nil,
+	)
+)
+
+// OraclesCollector exports the activity of the oracles and flags the
+// perpetual markets still trading whose settlement data source went quiet.
+// Futures only receive settlement data at expiry, so they are never stale.
+// The oracle data is listed oldest first from where the previous update
+// stopped.
+type OraclesCollector struct {
+	dataNode *DataNodeClient
+	maxAge   time.Duration
+
+	mutex sync.Mutex
+	// End cursor of the oracle data listed so far
+	cursor      string
+	submissions float64
+	// Time of the latest data matched by each spec
+	latest map[string]time.Time
+}
+
+func NewOraclesCollector(dataNode *DataNodeClient, maxAge time.Duration) *OraclesCollector {
+	return &OraclesCollector{dataNode: dataNode, maxAge: maxAge, latest: make(map[string]time.Time)}
+}
+
+func (c *OraclesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricOracleSpecsActive
+	ch <- metricOracleData
+	ch <- metricMarketSettlementDataAge
+	ch <- metricMarketSettlementDataStale
+}
+
+func (c *OraclesCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	active, err := c.activeSpecs(ctx)
+	if err != nil {
+		return fmt.Errorf("listing data-source specs: %v", err)
+	}
+	err = c.follow(ctx)
+	if err != nil {
+		return fmt.Errorf("listing oracle data: %v", err)
+	}
+	markets, err := listMarkets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing markets: %v", err)
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		metricOracleSpecsActive, prometheus.GaugeValue, active,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricOracleData, prometheus.GaugeValue, c.submissions,
+	)
+	for _, market := range markets {
+		spec := market.product().DataSourceSpecForSettlementData.ID
+		if market.closed() || spec == "" {
+			continue
+		}
+		stale := 1.0
+		if broadcastAt, ok := c.latest[spec]; ok {
+			age := time.Since(broadcastAt)
+			ch <- prometheus.MustNewConstMetric(
+				metricMarketSettlementDataAge, prometheus.GaugeValue, age.Seconds(), market.ID, market.label(),
+			)
+			if age <= c.maxAge {
+				stale = 0
+			}
+		}
+		if !market.perpetual() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketSettlementDataStale, prometheus.GaugeValue, stale, market.ID, market.label(),
+		)
+	}
+	return nil
+}
+
+// activeSpecs returns the number of active data-source specs.
+func (c *OraclesCollector) activeSpecs(ctx context.Context) (float64, error) {
+	active := 0.0
+	cursor := ""
+	for {
+		var page DataNodeOracleSpecs
+		err := c.dataNode.Get(ctx, dataNodePage(dataNodeOracleSpecsUrl, cursor), &page)
+		if err != nil {
+			return 0, err
+		}
+		for _, edge := range page.OracleSpecs.Edges {
+			if edge.Node.ExternalDataSourceSpec.Spec.Status == oracleSpecStatusActive {
+				active++
+			}
+		}
+		if !page.OracleSpecs.PageInfo.HasNextPage {
+			return active, nil
+		}
+		cursor = page.OracleSpecs.PageInfo.EndCursor
+	}
+}
+
+// follow counts the oracle data submitted since the previous update and
+// records the time of the latest one matched by each spec.
+func (c *OraclesCollector) follow(ctx context.Context) error {
+	for {
+		var page DataNodeOracleData
+		path := dataNodePage(dataNodeOracleDataUrl, c.cursor) + "&pagination.newestFirst=false"
+		err := c.dataNode.Get(ctx, path, &page)
+		if err != nil {
+			return err
+		}
+		// A page is counted whole or not at all, it is read again after an
+		// error
+		broadcasts := make([]time.Time, len(page.OracleData.Edges))
+		for i, edge := range page.OracleData.Edges {
+			broadcasts[i], err = parseUnixNano(edge.Node.ExternalData.Data.BroadcastAt)
+			if err != nil {
+				return err
+			}
+		}
+		for i, edge := range page.OracleData.Edges {
+			c.submissions++
+			for _, spec := range edge.Node.ExternalData.Data.MatchedSpecIDs {
+				if broadcasts[i].After(c.latest[spec]) {
+					c.latest[spec] = broadcasts[i]
+				}
+			}
+		}
+		// The end cursor of an empty page is empty, the next update starts
+		// from the same place
+		if page.OracleData.PageInfo.EndCursor != "" {
+			c.cursor = page.OracleData.PageInfo.EndCursor
+		}
+		if !page.OracleData.PageInfo.HasNextPage {
+			return nil
+		}
+	}
+}
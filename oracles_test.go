@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOraclesCollectorStale(t *testing.T) {
+	// Both specs last produced data two hours ago
+	broadcastAt := time.Now().Add(-2 * time.Hour).UnixNano()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case dataNodeOracleSpecsUrl:
+			fmt.Fprint(w, `{"oracleSpecs": {"edges": []}}`)
+		case dataNodeOracleDataUrl:
+			fmt.Fprintf(w, `{"oracleData": {"edges": [
+				{"node": {"externalData": {"data": {"matchedSpecIds": ["perp-spec"], "broadcastAt": "%d"}}}},
+				{"node": {"externalData": {"data": {"matchedSpecIds": ["future-spec"], "broadcastAt": "%d"}}}}
+			], "pageInfo": {"endCursor": "2"}}}`, broadcastAt, broadcastAt)
+		case dataNodeMarketsUrl:
+			fmt.Fprint(w, `{"markets": {"edges": [
+				{"node": {"id": "perp", "state": "STATE_ACTIVE", "tradableInstrument": {"instrument": {"product":
+					{"perpetual": {"dataSourceSpecForSettlementData": {"id": "perp-spec"}}}}}}},
+				{"node": {"id": "future", "state": "STATE_ACTIVE", "tradableInstrument": {"instrument": {"product":
+					{"future": {"dataSourceSpecForSettlementData": {"id": "future-spec"}}}}}}}
+			]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	values, err := collect(t, NewOraclesCollector(NewDataNodeClient(server.URL, nil), time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["vega_oracle_data_submissions"] != 2 {
+		t.Errorf("submissions = %v, want 2", values["vega_oracle_data_submissions"])
+	}
+	if stale, ok := values[`vega_market_settlement_data_stale{market="",market_id="perp"}`]; !ok || stale != 1 {
+		t.Errorf("perpetual stale = %v, %v, want 1", stale, ok)
+	}
+	// Futures only receive settlement data at expiry
+	if stale, ok := values[`vega_market_settlement_data_stale{market="",market_id="future"}`]; ok {
+		t.Errorf("future stale = %v, want no sample", stale)
+	}
+	if _, ok := values[`vega_market_settlement_data_age_seconds{market="",market_id="future"}`]; !ok {
+		t.Error("no settlement data age of the future")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricPeers = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "peers"),
+		"Number of peers of the node by direction of the connection.",
+		[]string{"direction"}, nil,
+	)
+	metricExpectedPeerConnected = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "expected_peer_connected"),
+		"Whether the node is connected to a peer listed in expected_peers.",
+		[]string{"peer_id"}, nil,
+	)
+	metricP2PListening = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "p2p", "listening"),
+		"Whether the node accepts P2P connections.",
+		nil, nil,
+	)
+	metricP2PListenerInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "p2p", "listener_info"),
+		"Addresses the node listens on for P2P connections, always 1.",
+		[]string{"address"}, nil,
+	)
+)
+
+// collectPeers exports the metrics about the peers of the last /net_info.
+func (e *Exporter) collectPeers(netInfo VegaNetInfo, ch chan<- prometheus.Metric) {
+	var inbound, outbound float64
+	connected := make(map[string]bool)
+	for _, peer := range netInfo.Result.Peers {
+		connected[strings.ToLower(peer.NodeInfo.ID)] = true
+		if peer.IsOutbound {
+			outbound++
+		} else {
+			inbound++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricPeers, prometheus.GaugeValue, inbound, "inbound",
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricPeers, prometheus.GaugeValue, outbound, "outbound",
+	)
+
+	for _, id := range e.expectedPeers {
+		var value float64
+		if connected[strings.ToLower(strings.TrimSpace(id))] {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricExpectedPeerConnected, prometheus.GaugeValue, value, strings.TrimSpace(id),
+		)
+	}
+
+	var listening float64
+	if netInfo.Result.Listening {
+		listening = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricP2PListening, prometheus.GaugeValue, listening,
+	)
+	for _, listener := range netInfo.Result.Listeners {
+		ch <- prometheus.MustNewConstMetric(
+			metricP2PListenerInfo, prometheus.GaugeValue, 1, listenerAddress(listener),
+		)
+	}
+}
+
+// listenerAddress turns a listener of /net_info, like
+// Listener(@0.0.0.0:26656), into its address.
+func listenerAddress(listener string) string {
+	address := strings.TrimSuffix(strings.TrimPrefix(listener, "Listener("), ")")
+	if i := strings.Index(address, "@"); i >= 0 {
+		address = address[i+1:]
+	}
+	return address
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeGovernanceUrl = "/api/v2/governance"
+
+// Proposals still open to votes
+const proposalStateOpen = "STATE_OPEN"
+
+// The governance token weight of a vote is in base units of the token, with
+// 18 decimals
+type dataNodeVote struct {
+	PartyID                    string `json:"partyId"`
+	TotalGovernanceTokenWeight string `json:"totalGovernanceTokenWeight"`
+}
+
+type DataNodeGovernance struct {
+	Connection struct {
+		Edges []struct {
+			Node struct {
+				Proposal struct {
+					ID        string `json:"id"`
+					Reference string `json:"reference"`
+					State     string `json:"state"`
+					Terms     struct {
+						ClosingTimestamp string `json:"closingTimestamp"`
+					} `json:"terms"`
+					Rationale struct {
+						Title string `json:"title"`
+					} `json:"rationale"`
+				} `json:"proposal"`
+				Yes []dataNodeVote `json:"yes"`
+				No  []dataNodeVote `json:"no"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"connection"`
+}
+
+var (
+	metricProposalParticipation = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "proposal", "participation_ratio"),
+		"Governance tokens that voted on the open proposal, as a share of the tokens staked on the network.",
+		[]string{"proposal_id", "proposal"}, nil,
+	)
+	metricProposalClosing = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "proposal", "closing_seconds"),
+		"Time left before the open proposal stops accepting votes.",
+		[]string{"proposal_id", "proposal"}, nil,
+	)
+	metricProposalVoted = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "proposal", "voted"),
+		"Whether the party of the data-node configuration voted on the open proposal.",
+		[]string{"proposal_id", "proposal", "party"}, nil,
+	)
+)
+
+// ProposalsCollector exports the participation of the open governance
+// proposals and, when a party is configured, whether it already voted.
+type ProposalsCollector struct {
+	dataNode *DataNodeClient
+	party    string
+}
+
+func NewProposalsCollector(dataNode *DataNodeClient, party string) *ProposalsCollector {
+	return &ProposalsCollector{dataNode: dataNode, party: party}
+}
+
+func (c *ProposalsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricProposalParticipation
+	ch <- metricProposalClosing
+	ch <- metricProposalVoted
+}
+
+func (c *ProposalsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var nodesData DataNodeNodesData
+	err := c.dataNode.Get(ctx, dataNodeNodesDataUrl, &nodesData)
+	if err != nil {
+		return fmt.Errorf("reading nodes data: %v", err)
+	}
+	staked, ok := new(big.Int).SetString(nodesData.NodeData.StakedTotal, 10)
+	if !ok {
+		return fmt.Errorf("invalid total stake %q", nodesData.NodeData.StakedTotal)
+	}
+
+	cursor := ""
+	for {
+		var page DataNodeGovernance
+		path := dataNodePage(dataNodeGovernanceUrl, cursor) + "&proposalState=" + proposalStateOpen
+		err := c.dataNode.Get(ctx, path, &page)
+		if err != nil {
+			return err
+		}
+		for _, edge := range page.Connection.Edges {
+			proposal := edge.Node.Proposal
+			if proposal.State != proposalStateOpen {
+				continue
+			}
+			title := proposal.Rationale.Title
+			if title == "" {
+				title = proposal.Reference
+			}
+			title = labelValue(title)
+
+			closing, err := strconv.ParseInt(proposal.Terms.ClosingTimestamp, 10, 64)
+			if err != nil {
+				return fmt.Errorf("proposal %s: invalid closing timestamp %q", proposal.ID, proposal.Terms.ClosingTimestamp)
+			}
+			ch <- prometheus.MustNewConstMetric(
+				metricProposalClosing, prometheus.GaugeValue,
+				time.Until(time.Unix(closing, 0)).Seconds(), proposal.ID, title,
+			)
+
+			participation := new(big.Int)
+			voted := 0.0
+			for _, votes := range [][]dataNodeVote{edge.Node.Yes, edge.Node.No} {
+				for _, vote := range votes {
+					weight, ok := new(big.Int).SetString(vote.TotalGovernanceTokenWeight, 10)
+					if !ok {
+						return fmt.Errorf("proposal %s: invalid vote weight %q", proposal.ID, vote.TotalGovernanceTokenWeight)
+					}
+					participation.Add(participation, weight)
+					if vote.PartyID == c.party {
+						voted = 1
+					}
+				}
+			}
+			// Without stake, there is no share to report
+			if staked.Sign() > 0 {
+				ch <- prometheus.MustNewConstMetric(
+					metricProposalParticipation, prometheus.GaugeValue,
+					tokenAmount(participation)/tokenAmount(staked), proposal.ID, title,
+				)
+			}
+			if c.party != "" {
+				ch <- prometheus.MustNewConstMetric(
+					metricProposalVoted, prometheus.GaugeValue, voted, proposal.ID, title, c.party,
+				)
+			}
+		}
+		if !page.Connection.PageInfo.HasNextPage {
+			return nil
+		}
+		cursor = page.Connection.PageInfo.EndCursor
+	}
+}
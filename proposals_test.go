@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProposalsParticipation(t *testing.T) {
+	tests := []struct {
+		name   string
+		staked string
+		votes  []string
+		want   float64
+		// Whether the ratio is exported
+		exported bool
+	}{
+		{"no vote", mockStake(1000).String(), nil, 0, true},
+		{"quarter of the stake", mockStake(1000).String(), []string{mockStake(200).String(), mockStake(50).String()}, 0.25, true},
+		{"no stake", "0", []string{mockStake(50).String()}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case dataNodeNodesDataUrl:
+					json.NewEncoder(w).Encode(map[string]interface{}{"nodeData": map[string]string{"stakedTotal": test.staked}})
+				case dataNodeGovernanceUrl:
+					var yes []interface{}
+					for _, weight := range test.votes {
+						yes = append(yes, map[string]string{"partyId": "p", "totalGovernanceTokenWeight": weight})
+					}
+					json.NewEncoder(w).Encode(map[string]interface{}{"connection": map[string]interface{}{
+						"edges": []interface{}{map[string]interface{}{"node": map[string]interface{}{
+							"proposal": map[string]interface{}{
+								"id": "p1", "reference": "ref", "state": proposalStateOpen,
+								"terms": map[string]string{"closingTimestamp": "0"},
+							},
+							"yes": yes,
+						}}},
+					}})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			values, err := collect(t, NewProposalsCollector(NewDataNodeClient(server.URL, nil), ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, exported := values[`vega_proposal_participation_ratio{proposal="ref",proposal_id="p1"}`]
+			if exported != test.exported || math.Abs(value-test.want) > 1e-9 {
+				t.Errorf("participation = %v (exported %v), want %v (exported %v)", value, exported, test.want, test.exported)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricAppHashMismatch = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "apphash_mismatch"),
+		"Whether the app hash at the compared height differs from the reference node.",
+		nil, nil,
+	)
+	metricBlockHashMismatch = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "blockhash_mismatch"),
+		"Whether the block hash at the compared height differs from the reference node.",
+		nil, nil,
+	)
+	metricReferenceComparedHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "reference", "compared_height"),
+		"Height at which the node was last compared with the reference node.",
+		nil, nil,
+	)
+)
+
+// ReferenceCollector compares the block and app hashes of the node with a
+// reference node at the highest height both of them know.
+type ReferenceCollector struct {
+	rpc       *RPCClient
+	reference *RPCClient
+}
+
+func NewReferenceCollector(rpc, reference *RPCClient) *ReferenceCollector {
+	return &ReferenceCollector{
+		rpc:       rpc,
+		reference: reference,
+	}
+}
+
+func (c *ReferenceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricAppHashMismatch
+	ch <- metricBlockHashMismatch
+	ch <- metricReferenceComparedHeight
+}
+
+func (c *ReferenceCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	height, err := latestHeight(ctx, c.rpc)
+	if err != nil {
+		return err
+	}
+	referenceHeight, err := latestHeight(ctx, c.reference)
+	if err != nil {
+		return fmt.Errorf("reference: %v", err)
+	}
+	if referenceHeight < height {
+		height = referenceHeight
+	}
+
+	blockHash, appHash, err := blockHashes(ctx, c.rpc, height)
+	if err != nil {
+		return err
+	}
+	referenceBlockHash, referenceAppHash, err := blockHashes(ctx, c.reference, height)
+	if err != nil {
+		return fmt.Errorf("reference: %v", err)
+	}
+
+	var appHashMismatch, blockHashMismatch float64
+	if appHash != referenceAppHash {
+		appHashMismatch = 1
+	}
+	if blockHash != referenceBlockHash {
+		blockHashMismatch = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		metricAppHashMismatch, prometheus.GaugeValue, appHashMismatch,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricBlockHashMismatch, prometheus.GaugeValue, blockHashMismatch,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricReferenceComparedHeight, prometheus.GaugeValue, float64(height),
+	)
+
+	return nil
+}
+
+// latestHeight returns the latest block height reported by /status.
+func latestHeight(ctx context.Context, rpc *RPCClient) (int64, error) {
+	var vegaStatus VegaStatus
+	err := rpc.GetJSON(ctx, vegaStatusUrl, &vegaStatus)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(vegaStatus.Result.SyncInfo.LatestBlockHeight, 10, 64)
+}
+
+// blockHashes returns the block hash and app hash of the block at height.
+func blockHashes(ctx context.Context, rpc *RPCClient, height int64) (string, string, error) {
+	var blockchain VegaBlockchain
+	err := rpc.GetJSON(ctx, fmt.Sprintf("%s?minHeight=%d&maxHeight=%d", vegaBlockchainUrl, height, height), &blockchain)
+	if err != nil {
+		return "", "", err
+	}
+	if len(blockchain.Result.BlockMetas) == 0 {
+		return "", "", fmt.Errorf("no block meta at height %d", height)
+	}
+	meta := blockchain.Result.BlockMetas[0]
+	return meta.BlockID.Hash, meta.Header.AppHash, nil
+}
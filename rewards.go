@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Accounts holding the rewards to pay out at the end of the epochs
+var rewardPoolAccountTypes = []string{
+	"ACCOUNT_TYPE_GLOBAL_REWARD",
+	"ACCOUNT_TYPE_REWARD_MAKER_PAID_FEES",
+	"ACCOUNT_TYPE_REWARD_MAKER_RECEIVED_FEES",
+	"ACCOUNT_TYPE_REWARD_LP_RECEIVED_FEES",
+	"ACCOUNT_TYPE_REWARD_MARKET_PROPOSERS",
+	"ACCOUNT_TYPE_REWARD_AVERAGE_POSITION",
+	"ACCOUNT_TYPE_REWARD_RELATIVE_RETURN",
+	"ACCOUNT_TYPE_REWARD_RETURN_VOLATILITY",
+	"ACCOUNT_TYPE_REWARD_VALIDATOR_RANKING",
+}
+
+var (
+	metricRewardPool = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "reward", "pool"),
+		"Balance of the reward pools of a type, in units of the asset.",
+		[]string{"asset", "asset_id", "type"}, nil,
+	)
+	metricRewardPaid = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "reward", "paid"),
+		"Rewards of a type paid for the last completed epoch, in units of the asset.",
+		[]string{"asset", "asset_id", "type"}, nil,
+	)
+)
+
+// RewardsCollector exports the balances of the reward pools, paid out at the
+// end of the current epoch, and the rewards paid for the last one.
+type RewardsCollector struct {
+	dataNode *DataNodeClient
+}
+
+func NewRewardsCollector(dataNode *DataNodeClient) *RewardsCollector {
+	return &RewardsCollector{dataNode: dataNode}
+}
+
+func (c *RewardsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricRewardPool
+	ch <- metricRewardPaid
+}
+
+func (c *RewardsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	assets, err := listAssets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing assets: %v", err)
+	}
+
+	accounts, err := listAccounts(ctx, c.dataNode, rewardPoolAccountTypes...)
+	if err != nil {
+		return fmt.Errorf("listing reward accounts: %v", err)
+	}
+	// Reward accounts exist per asset and dispatch strategy, pools sum them
+	pools := make(map[string]map[string]*big.Int)
+	for _, account := range accounts {
+		if pools[account.Type] == nil {
+			pools[account.Type] = make(map[string]*big.Int)
+		}
+		err := addAmount(pools[account.Type], account.Asset, account.Balance)
+		if err != nil {
+			return fmt.Errorf("account of %s: balance: %v", account.Owner, err)
+		}
+	}
+	err = c.export(ch, metricRewardPool, pools, assets)
+	if err != nil {
+		return err
+	}
+
+	current, err := getEpoch(ctx, c.dataNode, 0)
+	if err != nil {
+		return fmt.Errorf("reading epoch: %v", err)
+	}
+	seq, err := current.number()
+	if err != nil {
+		return err
+	}
+	if seq < 2 {
+		// No epoch completed yet
+		return nil
+	}
+	summaries, err := listEpochRewards(ctx, c.dataNode, strconv.FormatUint(seq-1, 10))
+	if err != nil {
+		return fmt.Errorf("reading reward summaries: %v", err)
+	}
+	// Markets are summed
+	paid := make(map[string]map[string]*big.Int)
+	for reward, amount := range summaries {
+		if paid[reward.rewardType] == nil {
+			paid[reward.rewardType] = make(map[string]*big.Int)
+		}
+		addTotal(paid[reward.rewardType], reward.asset, amount)
+	}
+	return c.export(ch, metricRewardPaid, paid, assets)
+}
+
+// export sends the amounts by account type and asset of a metric.
+func (c *RewardsCollector) export(ch chan<- prometheus.Metric, desc *prometheus.Desc, amounts map[string]map[string]*big.Int, assets map[string]dataNodeAsset) error {
+	for accountType, byAsset := range amounts {
+		rewardType := strings.ToLower(strings.TrimPrefix(accountType, "ACCOUNT_TYPE_"))
+		for id, amount := range byAsset {
+			asset, ok := assets[id]
+			if !ok {
+				return fmt.Errorf("unknown asset %s", id)
+			}
+			ch <- prometheus.MustNewConstMetric(
+				desc, prometheus.GaugeValue, assetAmount(amount, asset.decimals), labelValue(asset.symbol), id, rewardType,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const unixSocketPrefix = "unix://"
+
+// errBodyTooLarge is returned for responses larger than --rpc.max-body-bytes.
+var errBodyTooLarge = errors.New("response body too large")
+
+var metricRPCErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "errors_total",
+		Help:      "Number of failed RPC requests by kind of failure: dns, timeout, connection_refused, connect, tls, http_4xx, http_5xx, body_too_large, decode or other.",
+	},
+	[]string{"endpoint", "kind"},
+)
+
+var metricRPCResponses = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "responses_total",
+		Help:      "Number of RPC responses by HTTP status code.",
+	},
+	[]string{"endpoint", "code"},
+)
+
+var metricRPCCompressedResponses = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "compressed_responses_total",
+		Help:      "Number of RPC responses received gzip compressed.",
+	},
+	[]string{"endpoint"},
+)
+
+// rpcStatusError is returned for RPC responses other than 200, with the
+// JSON-RPC error when the body has one.
+type rpcStatusError struct {
+	status  string
+	message string
+}
+
+func (e *rpcStatusError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("unexpected status %s", e.status)
+	}
+	return fmt.Sprintf("unexpected status %s: %s", e.status, e.message)
+}
+
+// RPCClient performs requests against a Tendermint RPC endpoint.
+type RPCClient struct {
+	endpoint string
+	client   *http.Client
+	headers  map[string]string
+	// Endpoint in the metrics, without credentials
+	label string
+}
+
+func NewRPCClient(endpoint string, headers map[string]string) *RPCClient {
+	c := &RPCClient{
+		endpoint: endpoint,
+		client:   hostClient(headers),
+		headers:  headers,
+		label:    endpointLabel(endpoint),
+	}
+
+	// Endpoints like unix:///path/to/socket speak HTTP over a unix domain
+	// socket: requests go to a placeholder host and the transport dials the
+	// socket instead.
+	if strings.HasPrefix(endpoint, unixSocketPrefix) {
+		socketPath := strings.TrimPrefix(endpoint, unixSocketPrefix)
+		c.endpoint = "http://unix"
+		socketTransport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				d := net.Dialer{Timeout: *rpcDialTimeout}
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		}
+		tuneTransport(socketTransport)
+		c.client = &http.Client{Transport: socketTransport}
+	}
+
+	return c
+}
+
+// hostClient returns the client for requests sent with headers. A Host
+// override must also be used as TLS server name so that SNI-routed gateways
+// pick the right backend, which takes a transport of its own.
+func hostClient(headers map[string]string) *http.Client {
+	for name, value := range headers {
+		if !strings.EqualFold(name, "Host") {
+			continue
+		}
+		if host, _, err := net.SplitHostPort(value); err == nil {
+			value = host
+		}
+		hostTransport := tr.Clone()
+		hostTransport.TLSClientConfig.ServerName = value
+		return &http.Client{Transport: hostTransport}
+	}
+	return client
+}
+
+// setHeaders sets headers on req, a Host entry replacing the host of its URL.
+func setHeaders(req *http.Request, headers map[string]string) {
+	for name, value := range headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+		} else {
+			req.Header.Set(name, value)
+		}
+	}
+}
+
+// tuneTransport applies the --rpc flags on the connections of a transport.
+func tuneTransport(t *http.Transport) {
+	t.DisableCompression = !*rpcCompression
+	t.DisableKeepAlives = !*rpcKeepAlive
+	t.MaxIdleConnsPerHost = *rpcMaxIdleConnsPerHost
+	t.IdleConnTimeout = *rpcIdleConnTimeout
+}
+
+// normalizeEndpoint prepends a scheme to bare host:port endpoints, https for
+// port 443 and http otherwise.
+func normalizeEndpoint(endpoint string) string {
+	if endpoint == "" || strings.Contains(endpoint, "://") || strings.HasPrefix(endpoint, srvEndpointPrefix) {
+		return endpoint
+	}
+	if _, port, err := net.SplitHostPort(endpoint); err == nil && port == "443" {
+		return "https://" + endpoint
+	}
+	return "http://" + endpoint
+}
+
+// validateEndpoint checks that an RPC endpoint is usable before anything is
+// sent to it, with errors telling how to fix it.
+func validateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return errors.New("no RPC endpoint, set VEGA_ENDPOINT or list targets in --config.file")
+	}
+	if strings.HasPrefix(endpoint, unixSocketPrefix) {
+		if strings.TrimPrefix(endpoint, unixSocketPrefix) == "" {
+			return fmt.Errorf("endpoint %q has no socket path, use unix:///path/to/socket", endpoint)
+		}
+		return nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		return fmt.Errorf("endpoint %q has no scheme, use http://%s", endpoint, endpoint)
+	}
+
+	// The URL parser reads the last group of an IPv6 address without
+	// brackets as a port, or fails with an obscure error
+	host := strings.SplitN(endpoint, "://", 2)[1]
+	host = strings.SplitN(host, "/", 2)[0]
+	host = host[strings.LastIndex(host, "@")+1:]
+	if strings.Count(host, ":") > 1 && !strings.HasPrefix(host, "[") {
+		return fmt.Errorf("endpoint %q has an IPv6 address without brackets, use a form like http://[2001:db8::1]:26657", endpoint)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("endpoint %q is not a valid URL: %v", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("endpoint %q has unsupported scheme %q, use http, https or unix", endpoint, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("endpoint %q has no host", endpoint)
+	}
+	if strings.Contains(u.Hostname(), ":") {
+		address := strings.SplitN(u.Hostname(), "%", 2)[0]
+		if net.ParseIP(address) == nil {
+			return fmt.Errorf("endpoint %q has an invalid IPv6 address %q", endpoint, u.Hostname())
+		}
+	}
+	if strings.HasSuffix(u.Host, ":") {
+		return fmt.Errorf("endpoint %q has an empty port, remove the colon or add the port", endpoint)
+	}
+	if port := u.Port(); port != "" {
+		number, err := strconv.Atoi(port)
+		if err != nil || number < 1 || number > 65535 {
+			return fmt.Errorf("endpoint %q has invalid port %q, expected 1 to 65535", endpoint, port)
+		}
+	}
+	return nil
+}
+
+// resolveEndpoint checks that the host of an endpoint can be reached at the
+// network level: the socket exists or the host name resolves. Hosts behind a
+// proxy are resolved by the proxy and skipped.
+func resolveEndpoint(ctx context.Context, endpoint string) error {
+	if strings.HasPrefix(endpoint, unixSocketPrefix) {
+		socketPath := strings.TrimPrefix(endpoint, unixSocketPrefix)
+		_, err := os.Stat(socketPath)
+		if err != nil {
+			return fmt.Errorf("socket %s: %v", socketPath, err)
+		}
+		return nil
+	}
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	proxyURL, err := tr.Proxy(req)
+	if err != nil {
+		return fmt.Errorf("proxy for %s: %v", endpoint, err)
+	}
+	if isOnion(req.URL.Hostname()) {
+		if torDialer == nil {
+			return fmt.Errorf("%s is an onion service, set --rpc.tor-proxy to reach it", req.URL.Hostname())
+		}
+		return nil
+	}
+	if proxyURL != nil || net.ParseIP(req.URL.Hostname()) != nil {
+		return nil
+	}
+
+	_, err = net.DefaultResolver.LookupHost(ctx, req.URL.Hostname())
+	if err != nil {
+		return fmt.Errorf("resolving %s: %v, check the host name and DNS configuration", req.URL.Hostname(), err)
+	}
+	return nil
+}
+
+// Get performs a GET request against the RPC endpoint and returns the body.
+func (c *RPCClient) Get(ctx context.Context, path string) ([]byte, error) {
+	body, _, err := c.GetWithHeader(ctx, path)
+	return body, err
+}
+
+// GetWithHeader is like Get but also returns the response headers.
+func (c *RPCClient) GetWithHeader(ctx context.Context, path string) (body []byte, header http.Header, err error) {
+	ctx, span := startSpan(ctx, "GET "+strings.SplitN(path, "?", 2)[0], spanKindClient)
+	span.setAttribute("http.url", c.label+path)
+	defer func() { span.finish(err) }()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint+path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	setHeaders(req, c.headers)
+
+	// Make request and show output.
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.countError(rpcErrorKind(err))
+		return nil, nil, err
+	}
+
+	span.setAttribute("http.status_code", strconv.Itoa(resp.StatusCode))
+	body, err = readBody(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		c.countError(rpcErrorKind(err))
+		return nil, nil, err
+	}
+	metricRPCResponses.WithLabelValues(c.label, strconv.Itoa(resp.StatusCode)).Inc()
+	// The transport asks for gzip and decompresses the body itself, the
+	// large consensus dumps shrink several times on the wire
+	if resp.Uncompressed {
+		metricRPCCompressedResponses.WithLabelValues(c.label).Inc()
+	}
+	if resp.StatusCode != http.StatusOK {
+		switch {
+		case resp.StatusCode >= 500:
+			c.countError("http_5xx")
+		case resp.StatusCode >= 400:
+			c.countError("http_4xx")
+		default:
+			c.countError("other")
+		}
+		return nil, nil, &rpcStatusError{
+			status:  resp.Status,
+			message: rpcErrorMessage(body),
+		}
+	}
+
+	return body, resp.Header, nil
+}
+
+// readBody reads a response body, up to --rpc.max-body-bytes so that a
+// misbehaving endpoint can't exhaust the memory of the exporter.
+func readBody(body io.Reader) ([]byte, error) {
+	if *rpcMaxBodyBytes <= 0 {
+		return ioutil.ReadAll(body)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(body, *rpcMaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > *rpcMaxBodyBytes {
+		return nil, fmt.Errorf("%w, more than %d bytes", errBodyTooLarge, *rpcMaxBodyBytes)
+	}
+	return content, nil
+}
+
+// rpcErrorMessage returns the JSON-RPC error of a response body, if any.
+func rpcErrorMessage(body []byte) string {
+	var response struct {
+		Error *struct {
+			Message string `json:"message"`
+			Data    string `json:"data"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &response) != nil || response.Error == nil {
+		return ""
+	}
+	if response.Error.Data == "" {
+		return response.Error.Message
+	}
+	return response.Error.Message + ", " + response.Error.Data
+}
+
+// GetJSON performs a GET request against the RPC endpoint and decodes the
+// JSON response into v.
+func (c *RPCClient) GetJSON(ctx context.Context, path string, v interface{}) error {
+	body, err := c.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	return c.decode(path, body, v)
+}
+
+// decode unmarshals the response body of an RPC path, adapted to the schema
+// probed for the endpoint, counting the failures. Fields the exporter doesn't
+// know are ignored. With --rpc.strict-decoding they are also counted as
+// schema drift, without failing the decoding.
+func (c *RPCClient) decode(path string, body []byte, v interface{}) error {
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	adapted := c.schema().adapt(body)
+	err := json.Unmarshal(adapted, v)
+	if err != nil {
+		c.countError("decode")
+		recordDecodeError(c.label, path, body, err)
+		return err
+	}
+	if *rpcStrictDecoding {
+		for _, field := range unknownFields(adapted, v) {
+			metricRPCUnknownFields.WithLabelValues(c.label, path, field).Inc()
+		}
+	}
+	return nil
+}
+
+func (c *RPCClient) countError(kind string) {
+	metricRPCErrors.WithLabelValues(c.label, kind).Inc()
+}
+
+// rpcErrorKind classifies the error of a request.
+func rpcErrorKind(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr x509.CertificateInvalidError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		return "body_too_large"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthorityErr), errors.As(err, &hostnameErr),
+		errors.As(err, &recordErr), strings.Contains(err.Error(), "tls: "),
+		strings.Contains(err.Error(), "HTTP response to HTTPS client"):
+		return "tls"
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return "connect"
+	}
+	return "other"
+}
+
+// endpointLabel drops the credentials and query of an endpoint.
+func endpointLabel(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || strings.HasPrefix(endpoint, unixSocketPrefix) {
+		return endpoint
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
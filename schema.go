@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricRPCSchema = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "rpc", "schema"),
+	"Schema of the RPC responses probed from /status: Tendermint or CometBFT version and encoding of the 64 bit integers, string or number.",
+	[]string{"version", "integers"}, nil,
+)
+
+// rpcSchema is the flavour of the JSON of an RPC endpoint. Tendermint and
+// CometBFT versions, and the gateways in front of them, don't encode the
+// responses alike: heights and voting powers are strings in the amino
+// encoding, numbers in others.
+type rpcSchema struct {
+	// Major and minor version of the node, like 0.34
+	version string
+	// Whether the 64 bit integers are JSON numbers
+	numericIntegers bool
+}
+
+// Fields holding 64 bit integers, strings in the structs of the exporter
+var integerFields = map[string]bool{
+	"height":                true,
+	"latest_block_height":   true,
+	"earliest_block_height": true,
+	"last_height":           true,
+	"voting_power":          true,
+	"total_voting_power":    true,
+	"proposer_priority":     true,
+	"gas_wanted":            true,
+	"gas_used":              true,
+	"n_peers":               true,
+	"num_txs":               true,
+	"total_txs":             true,
+	"block_size":            true,
+}
+
+// schemaVersion returns the major and minor version of a node version like
+// v0.38.12 or 0.34.24-vega.
+func schemaVersion(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "unknown"
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// probeSchema reads the schema of the endpoint off a /status response.
+func probeSchema(body []byte) (rpcSchema, bool) {
+	var status struct {
+		Result struct {
+			NodeInfo struct {
+				Version string `json:"version"`
+			} `json:"node_info"`
+			SyncInfo struct {
+				LatestBlockHeight json.RawMessage `json:"latest_block_height"`
+			} `json:"sync_info"`
+		} `json:"result"`
+	}
+	if json.Unmarshal(body, &status) != nil || len(status.Result.SyncInfo.LatestBlockHeight) == 0 {
+		return rpcSchema{}, false
+	}
+	return rpcSchema{
+		version:         schemaVersion(status.Result.NodeInfo.Version),
+		numericIntegers: status.Result.SyncInfo.LatestBlockHeight[0] != '"',
+	}, true
+}
+
+// schemas are the schemas probed for each endpoint.
+var schemas = struct {
+	sync.Mutex
+	byEndpoint map[string]rpcSchema
+}{byEndpoint: make(map[string]rpcSchema)}
+
+// detectSchema probes the schema of the endpoint from a /status response,
+// logging when it changes, after a node upgrade for instance.
+func (c *RPCClient) detectSchema(body []byte) (rpcSchema, bool) {
+	schema, ok := probeSchema(body)
+	if !ok {
+		return schema, false
+	}
+	schemas.Lock()
+	previous, known := schemas.byEndpoint[c.label]
+	schemas.byEndpoint[c.label] = schema
+	schemas.Unlock()
+	if !known || previous != schema {
+		logInfof("%s speaks the RPC schema of %s with %s integers", c.label, schema.version, schema.integerEncoding())
+	}
+	return schema, true
+}
+
+func (c *RPCClient) schema() rpcSchema {
+	schemas.Lock()
+	defer schemas.Unlock()
+	return schemas.byEndpoint[c.label]
+}
+
+func (s rpcSchema) integerEncoding() string {
+	if s.numericIntegers {
+		return "number"
+	}
+	return "string"
+}
+
+// adapt rewrites a response of the schema into the encoding of the structs of
+// the exporter: the integer fields that are numbers become strings. Responses
+// of the amino encoding are returned as they are.
+func (s rpcSchema) adapt(body []byte) []byte {
+	if !s.numericIntegers {
+		return body
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if decoder.Decode(&value) != nil {
+		// Left to the decoding to fail
+		return body
+	}
+	adapted, err := json.Marshal(quoteIntegers(value))
+	if err != nil {
+		return body
+	}
+	return adapted
+}
+
+// quoteIntegers turns the numbers of the integerFields into strings.
+func quoteIntegers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if number, ok := field.(json.Number); ok && integerFields[key] {
+				value[key] = number.String()
+				continue
+			}
+			value[key] = quoteIntegers(field)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = quoteIntegers(item)
+		}
+	}
+	return value
+}
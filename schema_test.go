@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestQuoteIntegers(t *testing.T) {
+	tests := []struct {
+		name    string
+		numeric bool
+		body    string
+		want    string
+	}{
+		{"string integers", false, `{"height": 10}`, `{"height": 10}`},
+		{"top level", true, `{"height": 10, "round": 2}`, `{"height": "10", "round": 2}`},
+		{"nested", true, `{"result": {"sync_info": {"latest_block_height": 12345678901234567890, "catching_up": false}}}`,
+			`{"result": {"sync_info": {"latest_block_height": "12345678901234567890", "catching_up": false}}}`},
+		{"in lists", true, `{"validators": [{"voting_power": 5, "proposer_priority": -3}, {"voting_power": "6"}]}`,
+			`{"validators": [{"voting_power": "5", "proposer_priority": "-3"}, {"voting_power": "6"}]}`},
+		{"objects of integer fields are walked", true, `{"height": {"block_size": 1}}`, `{"height": {"block_size": "1"}}`},
+		{"not JSON", true, `{`, `{`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adapted := rpcSchema{numericIntegers: test.numeric}.adapt([]byte(test.body))
+			// Left to the decoding to fail
+			if !json.Valid([]byte(test.body)) {
+				if string(adapted) != test.body {
+					t.Errorf("adapt = %s, want the body unchanged", adapted)
+				}
+				return
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(adapted, &got); err != nil {
+				t.Fatalf("adapted body %s: %v", adapted, err)
+			}
+			if err := json.Unmarshal([]byte(test.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("adapt = %s, want %s", adapted, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+const peersSDPath = "/sd/peers"
+
+// peerTarget is a peer of a node along with the address its RPC should be
+// reachable on.
+type peerTarget struct {
+	ID         string
+	Moniker    string
+	RPCAddress string
+}
+
+// recordPeers keeps the peers of the last /net_info for service discovery.
+func (e *Exporter) recordPeers(netInfo VegaNetInfo) {
+	var peers []peerTarget
+	for _, peer := range netInfo.Result.Peers {
+		address := peerRPCAddress(peer.NodeInfo.Other.RPCAddress, peer.RemoteIP)
+		if address == "" {
+			continue
+		}
+		peers = append(peers, peerTarget{
+			ID:         peer.NodeInfo.ID,
+			Moniker:    peer.NodeInfo.Moniker,
+			RPCAddress: address,
+		})
+	}
+
+	e.peersMutex.Lock()
+	e.peers = peers
+	e.peersMutex.Unlock()
+}
+
+// peerRPCAddress turns the RPC listen address advertised by a peer, like
+// tcp://0.0.0.0:26657, into host:port. Peers listening on every interface or
+// on loopback are expected to be reached on their remote IP.
+func peerRPCAddress(rpcAddress, remoteIP string) string {
+	u, err := url.Parse(rpcAddress)
+	if err != nil || u.Port() == "" {
+		return ""
+	}
+	host := u.Hostname()
+	ip := net.ParseIP(host)
+	if host == "" || ip != nil && (ip.IsUnspecified() || ip.IsLoopback()) {
+		host = remoteIP
+	}
+	if host == "" {
+		return ""
+	}
+	return net.JoinHostPort(host, u.Port())
+}
+
+// httpSDTargetGroup is a target group of the Prometheus http_sd format.
+type httpSDTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// peersSDHandler serves the peers of every node, as of their last scrape, in
+// the Prometheus http_sd format.
+func peersSDHandler(set *targetSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groups := []httpSDTargetGroup{}
+		seen := make(map[string]bool)
+		for _, e := range set.list() {
+			e.peersMutex.Lock()
+			peers := e.peers
+			e.peersMutex.Unlock()
+
+			for _, peer := range peers {
+				// Nodes of the same network share most of their peers
+				if seen[peer.RPCAddress] {
+					continue
+				}
+				seen[peer.RPCAddress] = true
+
+				labels := map[string]string{
+					"__meta_vega_peer_id":      peer.ID,
+					"__meta_vega_peer_moniker": peer.Moniker,
+				}
+				if e.name != "" {
+					labels["__meta_vega_node"] = e.name
+				}
+				groups = append(groups, httpSDTargetGroup{
+					Targets: []string{peer.RPCAddress},
+					Labels:  labels,
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(groups)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const vegaHealthUrl = "/health"
+
+var (
+	metricSeedUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "seed", "up"),
+		"Whether the seed node answered the last probe.",
+		[]string{"seed"}, nil,
+	)
+	metricSeedProbeDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "seed", "probe_duration_seconds"),
+		"Time the last probe of the seed node took.",
+		[]string{"seed"}, nil,
+	)
+)
+
+// seedResult is the outcome of the last probe of a seed.
+type seedResult struct {
+	up       bool
+	duration time.Duration
+}
+
+// seedProber probes the seed nodes of --probe.seeds in the background. P2P
+// addresses like id@host:26656 are dialed over TCP, RPC endpoints like
+// https://host get a request on /health.
+type seedProber struct {
+	seeds []string
+
+	mutex   sync.Mutex
+	results map[string]seedResult
+}
+
+func newSeedProber(seeds []string) *seedProber {
+	return &seedProber{
+		seeds:   seeds,
+		results: make(map[string]seedResult),
+	}
+}
+
+func (p *seedProber) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricSeedUp
+	ch <- metricSeedProbeDuration
+}
+
+func (p *seedProber) Collect(ch chan<- prometheus.Metric) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for seed, result := range p.results {
+		var up float64
+		if result.up {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricSeedUp, prometheus.GaugeValue, up, seed,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricSeedProbeDuration, prometheus.GaugeValue, result.duration.Seconds(), seed,
+		)
+	}
+}
+
+// run probes every seed each interval, until the process stops.
+func (p *seedProber) run(interval time.Duration) {
+	for {
+		var wg sync.WaitGroup
+		for _, seed := range p.seeds {
+			wg.Add(1)
+			go func(seed string) {
+				defer wg.Done()
+				start := time.Now()
+				err := probeSeed(seed)
+				result := seedResult{up: err == nil, duration: time.Since(start)}
+				if err != nil {
+					logWarnf("Seed %s unreachable: %v", seed, err)
+				}
+				p.mutex.Lock()
+				p.results[seed] = result
+				p.mutex.Unlock()
+			}(seed)
+		}
+		wg.Wait()
+		time.Sleep(interval)
+	}
+}
+
+// probeSeed connects to a P2P address or queries /health of an RPC endpoint.
+func probeSeed(seed string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *rpcTimeout)
+	defer cancel()
+
+	if strings.Contains(seed, "://") {
+		req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(seed, "/")+vegaHealthUrl, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s returned %s", vegaHealthUrl, resp.Status)
+		}
+		return nil
+	}
+
+	// Node IDs are not checked, reaching the port is enough
+	address := seed
+	if i := strings.Index(seed, "@"); i >= 0 {
+		address = seed[i+1:]
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// parseSeeds splits --probe.seeds, which may be copied from the seeds setting
+// of the Tendermint config.
+func parseSeeds(value string) ([]string, error) {
+	var seeds []string
+	for _, seed := range strings.Split(value, ",") {
+		seed = strings.TrimSpace(seed)
+		if seed == "" {
+			continue
+		}
+		if strings.Contains(seed, "://") {
+			err := validateEndpoint(seed)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			address := seed[strings.Index(seed, "@")+1:]
+			_, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, fmt.Errorf("seed %q: %v, use id@host:port or an RPC URL", seed, err)
+			}
+		}
+		seeds = append(seeds, seed)
+	}
+	return seeds, nil
+}
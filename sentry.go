@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Most events waiting to be sent, later ones are dropped
+const sentryQueueSize = 100
+
+// sentryClient reports panics and repeated collector failures to a Sentry
+// DSN, or any service implementing its store API like GlitchTip. Events of a
+// collector are grouped across hosts, and each collector of a target sends at
+// most one event per --sentry.min-interval.
+type sentryClient struct {
+	storeURL string
+	auth     string
+	hostname string
+
+	mutex sync.Mutex
+	// Consecutive failures and time of the latest event, by target and
+	// collector
+	failures map[string]int
+	reported map[string]time.Time
+
+	events chan sentryEvent
+}
+
+// sentry is nil unless --sentry.dsn is set.
+var sentry *sentryClient
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name"`
+	Release     string            `json:"release"`
+	Message     sentryMessage     `json:"message"`
+	Tags        map[string]string `json:"tags"`
+	Fingerprint []string          `json:"fingerprint"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+type sentryMessage struct {
+	Formatted string `json:"formatted"`
+}
+
+// newSentryClient parses a DSN like https://key@sentry.example.com/42.
+func newSentryClient(dsn string) (*sentryClient, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("DSN %q has no public key", dsn)
+	}
+	i := strings.LastIndex(u.Path, "/")
+	project := u.Path[i+1:]
+	if project == "" {
+		return nil, fmt.Errorf("DSN %q has no project ID", dsn)
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=vega-prometheus-exporter/%s, sentry_key=%s", version, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	hostname, _ := os.Hostname()
+	return &sentryClient{
+		storeURL: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, u.Path[:i], project),
+		auth:     auth,
+		hostname: hostname,
+		failures: make(map[string]int),
+		reported: make(map[string]time.Time),
+		events:   make(chan sentryEvent, sentryQueueSize),
+	}, nil
+}
+
+// collectorFailed counts a failure of a collector and reports it once it
+// failed --sentry.failure-threshold times in a row.
+func (c *sentryClient) collectorFailed(node, collector string, err error) {
+	if c == nil {
+		return
+	}
+	key := node + "/" + collector
+	c.mutex.Lock()
+	c.failures[key]++
+	failures := c.failures[key]
+	report := failures >= *sentryFailureThreshold && time.Since(c.reported[key]) >= *sentryMinInterval
+	if report {
+		c.reported[key] = time.Now()
+	}
+	c.mutex.Unlock()
+	if !report {
+		return
+	}
+
+	event := c.event("error", fmt.Sprintf("Collector %s of %s failed %d times in a row: %v", collector, node, failures, err))
+	event.Tags["node"] = node
+	event.Tags["collector"] = collector
+	event.Fingerprint = []string{"collector-failure", collector}
+	event.Extra = map[string]string{"error": err.Error()}
+	c.queue(event)
+}
+
+// collectorSucceeded ends the failure streak of a collector.
+func (c *sentryClient) collectorSucceeded(node, collector string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	delete(c.failures, node+"/"+collector)
+	c.mutex.Unlock()
+}
+
+// panicked reports a panic of a collector, at most once per
+// --sentry.min-interval like failures.
+func (c *sentryClient) panicked(node, collector string, value interface{}, stack []byte) {
+	if c == nil {
+		return
+	}
+	key := node + "/" + collector + "/panic"
+	c.mutex.Lock()
+	report := time.Since(c.reported[key]) >= *sentryMinInterval
+	if report {
+		c.reported[key] = time.Now()
+	}
+	c.mutex.Unlock()
+	if !report {
+		return
+	}
+
+	event := c.event("fatal", fmt.Sprintf("Collector %s of %s panicked: %v", collector, node, value))
+	event.Tags["node"] = node
+	event.Tags["collector"] = collector
+	event.Fingerprint = []string{"collector-panic", collector, fmt.Sprint(value)}
+	event.Extra = map[string]string{"stacktrace": string(stack)}
+	c.queue(event)
+}
+
+// queue queues an event for run, dropping it when the queue is full.
+func (c *sentryClient) queue(event sentryEvent) {
+	select {
+	case c.events <- event:
+	default:
+		logDebugf("Sentry queue full, dropping event %s", event.Message.Formatted)
+	}
+}
+
+func (c *sentryClient) event(level, message string) sentryEvent {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return sentryEvent{
+		EventID:    hex.EncodeToString(id),
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		Platform:   "go",
+		Level:      level,
+		Logger:     "vega-prometheus-exporter",
+		ServerName: c.hostname,
+		Release:    version,
+		Message:    sentryMessage{Formatted: message},
+		Tags:       make(map[string]string),
+	}
+}
+
+// run sends the queued events until the process exits.
+func (c *sentryClient) run() {
+	for event := range c.events {
+		err := c.send(event)
+		if err != nil {
+			logWarnf("Error reporting to Sentry: %v", err)
+		}
+	}
+}
+
+func (c *sentryClient) send(event sentryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", c.storeURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", c.auth)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", c.storeURL, resp.Status)
+	}
+	return nil
+}
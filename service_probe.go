@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricServiceUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "service", "up"),
+		"Whether the health endpoint of the service answered the last probe.",
+		[]string{"service"}, nil,
+	)
+	metricServiceProbeDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "service", "probe_duration_seconds"),
+		"Time the last probe of the health endpoint of the service took.",
+		[]string{"service"}, nil,
+	)
+	metricServiceInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "service", "info"),
+		"Version reported by the service, always 1.",
+		[]string{"service", "version"}, nil,
+	)
+)
+
+// ServiceVersion is the response of the version endpoint of a service.
+type ServiceVersion struct {
+	Version string `json:"version"`
+}
+
+// ServiceProbeCollector checks the health endpoint of a service run next to
+// the node and reads its version.
+type ServiceProbeCollector struct {
+	service     string
+	client      *DataNodeClient
+	healthPath  string
+	versionPath string
+}
+
+// NewServiceProbeCollector probes a service on the health path of its config,
+// or defaultHealthPath.
+func NewServiceProbeCollector(service string, config ServiceConfig, defaultHealthPath string) *ServiceProbeCollector {
+	healthPath := config.HealthPath
+	if healthPath == "" {
+		healthPath = defaultHealthPath
+	}
+	return &ServiceProbeCollector{
+		service:     service,
+		client:      NewDataNodeClient(config.Endpoint, config.Headers),
+		healthPath:  healthPath,
+		versionPath: config.VersionPath,
+	}
+}
+
+func (c *ServiceProbeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricServiceUp
+	ch <- metricServiceProbeDuration
+	ch <- metricServiceInfo
+}
+
+func (c *ServiceProbeCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	start := time.Now()
+	err := c.client.Get(ctx, c.healthPath, nil)
+	ch <- prometheus.MustNewConstMetric(
+		metricServiceProbeDuration, prometheus.GaugeValue, time.Since(start).Seconds(), c.service,
+	)
+	var up float64
+	if err == nil {
+		up = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricServiceUp, prometheus.GaugeValue, up, c.service,
+	)
+	if err != nil {
+		return err
+	}
+
+	if c.versionPath == "" {
+		return nil
+	}
+	var version ServiceVersion
+	err = c.client.Get(ctx, c.versionPath, &version)
+	if err != nil {
+		return err
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricServiceInfo, prometheus.GaugeValue, 1, c.service, labelValue(version.Version),
+	)
+	return nil
+}
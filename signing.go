@@ -0,0 +1,567 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const vegaCommitUrl = "/commit"
+const vegaValidatorsUrl = "/validators"
+
+// Most validators /validators returns per page
+const validatorsPageSize = 100
+
+// How long the startup backfill may take before metrics are served anyway
+const signingBackfillTimeout = 5 * time.Minute
+
+// Tendermint BlockIDFlag of a commit signature
+const blockIDFlagAbsent = 1
+
+type VegaCommit struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		SignedHeader struct {
+			Header struct {
+				Height         string    `json:"height"`
+				Time           time.Time `json:"time"`
+				ValidatorsHash string    `json:"validators_hash"`
+			} `json:"header"`
+			Commit struct {
+				Height     string `json:"height"`
+				Round      int    `json:"round"`
+				Signatures []struct {
+					BlockIDFlag      int       `json:"block_id_flag"`
+					ValidatorAddress string    `json:"validator_address"`
+					Timestamp        time.Time `json:"timestamp"`
+				} `json:"signatures"`
+			} `json:"commit"`
+		} `json:"signed_header"`
+		Canonical bool `json:"canonical"`
+	} `json:"result"`
+}
+
+type VegaValidators struct {
+	Jsonrpc string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Result  struct {
+		BlockHeight string `json:"block_height"`
+		Validators  []struct {
+			Address string `json:"address"`
+			PubKey  struct {
+				Value string `json:"value"`
+			} `json:"pub_key"`
+			VotingPower string `json:"voting_power"`
+		} `json:"validators"`
+		Total string `json:"total"`
+	} `json:"result"`
+}
+
+var (
+	metricValidatorSignedBlocks = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "validator_signed_blocks"),
+		"Number of blocks of the signing window signed by the validator.",
+		[]string{"address"}, nil,
+	)
+	metricValidatorMissedBlocks = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "validator_missed_blocks"),
+		"Number of blocks of the signing window missed by the validator.",
+		[]string{"address"}, nil,
+	)
+	metricValidatorUptimeRatio = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "validator_uptime_ratio"),
+		"Ratio of the blocks of the signing window signed by the validator.",
+		[]string{"address"}, nil,
+	)
+	metricValidatorCommitSkew = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "validator_commit_timestamp_skew_seconds"),
+		"Mean difference between the precommit timestamps of the validator and the block time over the signing window.",
+		[]string{"address"}, nil,
+	)
+	metricConsensusRoundsPerHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "consensus", "rounds_per_height"),
+		"Number of rounds the heights followed by the exporter took to commit.",
+		nil, nil,
+	)
+	metricConsensusRounds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "consensus", "rounds_total"),
+		"Number of rounds, failed ones included, of the heights followed by the exporter.",
+		nil, nil,
+	)
+	metricConsensusBlockInterval = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "consensus", "block_interval_seconds"),
+		"Time from the block time of the heights followed by the exporter to the median of their precommits weighted by voting power, the block time of the next height.",
+		nil, nil,
+	)
+	metricSigningWindowBlocks = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "signing_window_blocks"),
+		"Number of blocks currently covered by the signing window.",
+		nil, nil,
+	)
+	metricHistoryTruncated = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "exporter", "history_truncated"),
+		"Whether heights of the window of a block following collector were pruned by the node before they could be read.",
+		[]string{"collector"}, nil,
+	)
+)
+
+// signedBlock tells which validators signed the commit of a height, and how
+// long after the block time they did.
+type signedBlock struct {
+	height int64
+	time   time.Time
+	rounds int
+	signed map[string]bool
+	skew   map[string]float64
+	// Voting power of the validators of the height
+	power map[string]int64
+}
+
+// blockInterval returns the time between the block time and the median of
+// the precommits weighted by voting power, the way Tendermint computes the
+// time of the next block. The block time of a height is when the previous
+// one was committed, not when the height started: that is timeout_commit
+// later, which the RPC doesn't tell.
+func (b signedBlock) blockInterval() (float64, bool) {
+	var addresses []string
+	var total int64
+	for address := range b.skew {
+		addresses = append(addresses, address)
+		total += b.power[address]
+	}
+	if total == 0 {
+		return 0, false
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return b.skew[addresses[i]] < b.skew[addresses[j]]
+	})
+	median := total / 2
+	for _, address := range addresses {
+		if median <= b.power[address] {
+			return b.skew[address], true
+		}
+		median -= b.power[address]
+	}
+	return b.skew[addresses[len(addresses)-1]], true
+}
+
+var roundsPerHeightBuckets = []float64{1, 2, 3, 4, 5, 10}
+
+var blockIntervalBuckets = []float64{0.5, 1, 1.5, 2, 3, 5, 10, 30}
+
+// emptyBuckets returns the counts of a histogram without observations, so
+// that every bucket is exported from the start.
+func emptyBuckets(bounds []float64) map[float64]uint64 {
+	buckets := make(map[float64]uint64)
+	for _, bound := range bounds {
+		buckets[bound] = 0
+	}
+	return buckets
+}
+
+// SigningCollector keeps which validators signed each of the most recent
+// commits, read from /commit.
+type SigningCollector struct {
+	rpc        *RPCClient
+	windowSize int
+	backfill   bool
+	catchUp    *catchUp
+
+	// Update and Backfill may run at the same time at startup and when the
+	// replica becomes leader
+	mutex sync.Mutex
+	// Set while Backfill runs, scrapes serve the cached metrics meanwhile
+	backfilling int32
+	lastHeight  int64
+	window      []signedBlock
+	// Highest height skipped because the node had pruned it
+	prunedHeight int64
+
+	// Histogram of the rounds of every height followed
+	rounds      map[float64]uint64
+	roundsCount uint64
+	roundsSum   float64
+
+	// Histogram of the block intervals of every height followed
+	blockIntervals     map[float64]uint64
+	blockIntervalCount uint64
+	blockIntervalSum   float64
+
+	// Voting power of the validator set of the last height read, by the
+	// validators hash of its header
+	powersHash string
+	addresses  []string
+	powers     map[string]int64
+}
+
+func NewSigningCollector(rpc *RPCClient, windowSize int, backfill bool) *SigningCollector {
+	return &SigningCollector{
+		rpc:        rpc,
+		windowSize: windowSize,
+		backfill:   backfill,
+		catchUp:    newCatchUp("signing"),
+		rounds:     emptyBuckets(roundsPerHeightBuckets),
+
+		blockIntervals: emptyBuckets(blockIntervalBuckets),
+	}
+}
+
+func (c *SigningCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricValidatorSignedBlocks
+	ch <- metricValidatorMissedBlocks
+	ch <- metricValidatorUptimeRatio
+	ch <- metricValidatorCommitSkew
+	ch <- metricConsensusRoundsPerHeight
+	ch <- metricConsensusRounds
+	ch <- metricConsensusBlockInterval
+	ch <- metricSigningWindowBlocks
+	ch <- metricHistoryTruncated
+	ch <- metricBlocksBehind
+}
+
+func (c *SigningCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.follow(ctx, *catchUpBatchSize)
+	if err != nil {
+		return err
+	}
+
+	// Time of the latest block of the window, for --metrics.block-timestamps
+	var blockTime time.Time
+	signed := make(map[string]float64)
+	seen := make(map[string]float64)
+	skew := make(map[string]float64)
+	for _, block := range c.window {
+		blockTime = block.time
+		for address, ok := range block.signed {
+			seen[address]++
+			if ok {
+				signed[address]++
+				skew[address] += block.skew[address]
+			}
+		}
+	}
+	for address, blocks := range seen {
+		ch <- blockMetric(prometheus.MustNewConstMetric(
+			metricValidatorSignedBlocks, prometheus.GaugeValue, signed[address], address,
+		), blockTime)
+		ch <- blockMetric(prometheus.MustNewConstMetric(
+			metricValidatorMissedBlocks, prometheus.GaugeValue, blocks-signed[address], address,
+		), blockTime)
+		ch <- blockMetric(prometheus.MustNewConstMetric(
+			metricValidatorUptimeRatio, prometheus.GaugeValue, signed[address]/blocks, address,
+		), blockTime)
+		if signed[address] > 0 {
+			ch <- blockMetric(prometheus.MustNewConstMetric(
+				metricValidatorCommitSkew, prometheus.GaugeValue, skew[address]/signed[address], address,
+			), blockTime)
+		}
+	}
+	ch <- blockMetric(prometheus.MustNewConstMetric(
+		metricSigningWindowBlocks, prometheus.GaugeValue, float64(len(c.window)),
+	), blockTime)
+	var truncated float64
+	if c.prunedHeight > 0 && c.prunedHeight >= c.windowStart() {
+		truncated = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricHistoryTruncated, prometheus.GaugeValue, truncated, "signing",
+	)
+	ch <- prometheus.MustNewConstHistogram(
+		metricConsensusRoundsPerHeight, c.roundsCount, c.roundsSum, c.rounds,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricConsensusRounds, prometheus.CounterValue, c.roundsSum,
+	)
+	ch <- prometheus.MustNewConstHistogram(
+		metricConsensusBlockInterval, c.blockIntervalCount, c.blockIntervalSum, c.blockIntervals,
+	)
+	c.catchUp.collect(ch)
+
+	return nil
+}
+
+// Backfill walks back the whole window so that the uptime ratios are
+// accurate from the first scrape. It returns the number of blocks in the
+// window.
+func (c *SigningCollector) Backfill(ctx context.Context) (int, error) {
+	atomic.StoreInt32(&c.backfilling, 1)
+	defer atomic.StoreInt32(&c.backfilling, 0)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err := c.follow(ctx, c.windowSize)
+	return len(c.window), err
+}
+
+// follow reads the commits of the heights since the previous call, limited to
+// the window size and to batch heights. Without backfill the first call
+// starts from the latest commit. The commits read are kept even when a later
+// one fails, so that a long gap is filled over several calls. Heights the
+// node already pruned are skipped: the window then holds fewer blocks, and
+// the uptime ratios only cover the heights that could be read.
+func (c *SigningCollector) follow(ctx context.Context, batch int) error {
+	lastHeight, err := c.lastCommittedHeight(ctx)
+	if err != nil {
+		return err
+	}
+
+	from := c.lastHeight + 1
+	if c.lastHeight == 0 && !c.backfill {
+		from = lastHeight
+	}
+	if lastHeight-int64(c.windowSize)+1 > from {
+		from = lastHeight - int64(c.windowSize) + 1
+	}
+	if from < 1 {
+		from = 1
+	}
+
+	// Only a backfill or a gap of a whole window reaches back far enough for
+	// pruning to matter. Otherwise a height that can't be read is checked
+	// below
+	if lastHeight-from+1 >= int64(c.windowSize) {
+		earliest, err := earliestHeight(ctx, c.rpc)
+		if err != nil {
+			return err
+		}
+		from = c.skipPruned(from, earliest)
+	}
+
+	to := c.catchUp.batch(from, lastHeight, batch)
+	for height := from; height <= to; height++ {
+		err := c.catchUp.wait(ctx)
+		if err != nil {
+			if c.catchUp.interrupted(ctx, err, c.lastHeight, lastHeight) {
+				break
+			}
+			return err
+		}
+		block, err := c.fetchSignedBlock(ctx, height)
+		if err != nil {
+			if c.catchUp.interrupted(ctx, err, c.lastHeight, lastHeight) {
+				break
+			}
+			earliest, earliestErr := earliestHeight(ctx, c.rpc)
+			if earliestErr != nil || height >= earliest {
+				return fmt.Errorf("reading commit at height %d: %v", height, err)
+			}
+			// Pruned since, the loop resumes at the earliest height
+			height = c.skipPruned(height, earliest) - 1
+			c.lastHeight = height
+			continue
+		}
+		c.window = append(c.window, block)
+		c.observeRounds(block.rounds)
+		c.observeBlockInterval(block)
+		c.lastHeight = height
+
+		// The window spans heights rather than blocks, so that blocks from
+		// before a gap don't linger
+		start := c.windowStart()
+		i := 0
+		for i < len(c.window) && c.window[i].height < start {
+			i++
+		}
+		c.window = c.window[i:]
+	}
+	return nil
+}
+
+// skipPruned returns the height to read from instead of from, past the
+// heights the node pruned below earliest.
+func (c *SigningCollector) skipPruned(from, earliest int64) int64 {
+	if from >= earliest {
+		return from
+	}
+	logWarnf("Heights %d to %d of the signing window were pruned by the node, the uptime ratios cover the later heights only", from, earliest-1)
+	c.prunedHeight = earliest - 1
+	return earliest
+}
+
+// windowStart returns the first height of the window ending at the last
+// height read.
+func (c *SigningCollector) windowStart() int64 {
+	return c.lastHeight - int64(c.windowSize) + 1
+}
+
+func (c *SigningCollector) observeRounds(rounds int) {
+	c.roundsCount++
+	c.roundsSum += float64(rounds)
+	for _, bound := range roundsPerHeightBuckets {
+		if float64(rounds) <= bound {
+			c.rounds[bound]++
+		}
+	}
+}
+
+func (c *SigningCollector) observeBlockInterval(block signedBlock) {
+	interval, ok := block.blockInterval()
+	if !ok {
+		return
+	}
+	c.blockIntervalCount++
+	c.blockIntervalSum += interval
+	for _, bound := range blockIntervalBuckets {
+		if interval <= bound {
+			c.blockIntervals[bound]++
+		}
+	}
+}
+
+// lastCommittedHeight returns the highest height with a canonical commit.
+// The commit of the latest block is only final once the next block includes
+// it.
+func (c *SigningCollector) lastCommittedHeight(ctx context.Context) (int64, error) {
+	var blockchain VegaBlockchain
+	err := c.rpc.GetJSON(ctx, vegaBlockchainUrl, &blockchain)
+	if err != nil {
+		return 0, err
+	}
+	lastHeight, err := strconv.ParseInt(blockchain.Result.LastHeight, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing last height: %v", err)
+	}
+	return lastHeight - 1, nil
+}
+
+// earliestHeight returns the earliest height the node still stores.
+func earliestHeight(ctx context.Context, rpc *RPCClient) (int64, error) {
+	var vegaStatus VegaStatus
+	err := rpc.GetJSON(ctx, vegaStatusUrl, &vegaStatus)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(vegaStatus.Result.SyncInfo.EarliestBlockHeight, 10, 64)
+}
+
+// fetchSignedBlock reads the signatures of the commit of a height. Absent
+// signatures carry no address, the validator set of the height tells whose
+// they are.
+func (c *SigningCollector) fetchSignedBlock(ctx context.Context, height int64) (signedBlock, error) {
+	block := signedBlock{
+		height: height,
+		signed: make(map[string]bool),
+		skew:   make(map[string]float64),
+	}
+
+	var commit VegaCommit
+	err := c.rpc.GetJSON(ctx, fmt.Sprintf("%s?height=%d", vegaCommitUrl, height), &commit)
+	if err != nil {
+		return block, err
+	}
+	block.rounds = commit.Result.SignedHeader.Commit.Round + 1
+	block.time = commit.Result.SignedHeader.Header.Time
+
+	// The set rarely changes, it is only read again when its hash does
+	hash := commit.Result.SignedHeader.Header.ValidatorsHash
+	if hash == "" || hash != c.powersHash {
+		addresses, powers, err := validatorSet(ctx, c.rpc, height)
+		if err != nil {
+			return block, fmt.Errorf("reading the validators at height %d: %v", height, err)
+		}
+		c.powersHash, c.addresses, c.powers = hash, addresses, powers
+	}
+	block.power = c.powers
+
+	for i, signature := range commit.Result.SignedHeader.Commit.Signatures {
+		address := signature.ValidatorAddress
+		if address == "" {
+			if i >= len(c.addresses) {
+				return block, fmt.Errorf("no validator for signature %d", i)
+			}
+			address = c.addresses[i]
+		}
+		block.signed[address] = signature.BlockIDFlag != blockIDFlagAbsent
+		if block.signed[address] {
+			block.skew[address] = signature.Timestamp.Sub(commit.Result.SignedHeader.Header.Time).Seconds()
+		}
+	}
+	return block, nil
+}
+
+// validatorAddresses returns the addresses of the validator set at a height,
+// in the order of the commit signatures.
+func validatorAddresses(ctx context.Context, rpc *RPCClient, height int64) ([]string, error) {
+	addresses, _, err := validatorSet(ctx, rpc, height)
+	return addresses, err
+}
+
+// validatorSet returns the addresses of the validator set at a height, in the
+// order of the commit signatures, and their voting power.
+func validatorSet(ctx context.Context, rpc *RPCClient, height int64) ([]string, map[string]int64, error) {
+	addresses := []string{}
+	powers := make(map[string]int64)
+	for page := 1; ; page++ {
+		var validators VegaValidators
+		err := rpc.GetJSON(ctx, fmt.Sprintf("%s?height=%d&page=%d&per_page=%d", vegaValidatorsUrl, height, page, validatorsPageSize), &validators)
+		if err != nil {
+			return nil, nil, err
+		}
+		total, err := strconv.Atoi(validators.Result.Total)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing validator total: %v", err)
+		}
+		for _, validator := range validators.Result.Validators {
+			power, err := strconv.ParseInt(validator.VotingPower, 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing voting power of %s: %v", validator.Address, err)
+			}
+			addresses = append(addresses, validator.Address)
+			powers[validator.Address] = power
+		}
+		if len(addresses) >= total || len(validators.Result.Validators) == 0 {
+			return addresses, powers, nil
+		}
+	}
+}
+
+// Backfilling tells whether Backfill is running.
+func (c *SigningCollector) Backfilling() bool {
+	return atomic.LoadInt32(&c.backfilling) == 1
+}
+
+// backfill walks back the signing window of every target, before metrics are
+// served and whenever the replica becomes leader.
+func (s *targetSet) backfill() {
+	ctx, cancel := context.WithTimeout(context.Background(), signingBackfillTimeout)
+	defer cancel()
+
+	s.mutex.Lock()
+	collectors := make(map[string]*SigningCollector)
+	for key, e := range s.exporters {
+		collector := e.collectors["signing"]
+		if background, ok := collector.(*BackgroundCollector); ok {
+			collector = background.collector
+		}
+		c, ok := collector.(*SigningCollector)
+		if ok && c.backfill {
+			collectors[targetName(s.targets[key])] = c
+		}
+	}
+	s.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for name, c := range collectors {
+		wg.Add(1)
+		go func(name string, c *SigningCollector) {
+			defer wg.Done()
+			start := time.Now()
+			blocks, err := c.Backfill(ctx)
+			if err != nil {
+				logWarnf("%s: backfilling signing history: %v", name, err)
+				return
+			}
+			logInfof("%s: backfilled %d blocks of signing history in %v", name, blocks, time.Since(start).Round(time.Millisecond))
+		}(name, c)
+	}
+	wg.Wait()
+}
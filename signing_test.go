@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// signingFixture is a chain whose heights below earliest were pruned,
+// counting the requests for /status and /validators.
+type signingFixture struct {
+	mutex      sync.Mutex
+	latest     int64
+	earliest   int64
+	statuses   int
+	validators int
+}
+
+func (f *signingFixture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch r.URL.Path {
+	case vegaStatusUrl:
+		f.statuses++
+		fmt.Fprintf(w, `{"result": {"sync_info": {"earliest_block_height": "%d"}}}`, f.earliest)
+	case vegaBlockchainUrl:
+		fmt.Fprintf(w, `{"result": {"last_height": "%d"}}`, f.latest)
+	case vegaCommitUrl:
+		height, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		if height < f.earliest || height > f.latest {
+			http.Error(w, "height not available", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"result": {"signed_header": {"header": {"time": "2023-01-01T00:00:00Z", "validators_hash": "AB"},
+			"commit": {"round": 0, "signatures": [{"block_id_flag": 2, "validator_address": "A0"}]}}}}`)
+	case vegaValidatorsUrl:
+		f.validators++
+		fmt.Fprint(w, `{"result": {"validators": [{"address": "A0", "voting_power": "10"}], "total": "1"}}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSigningFollow(t *testing.T) {
+	tests := []struct {
+		name     string
+		backfill bool
+		// Chain before and after the first call, the latest height
+		// including the block whose commit isn't final yet
+		latest, earliest         int64
+		nextLatest, nextEarliest int64
+		lastHeight, windowBlocks int64
+		statuses                 int
+		pruned                   bool
+	}{
+		{"steady", false, 100, 1, 103, 1, 102, 4, 0, false},
+		{"backfill of a full node", true, 100, 1, 101, 1, 100, 10, 1, false},
+		{"backfill of a pruned node", true, 100, 95, 101, 95, 100, 6, 1, true},
+		{"pruned during a short gap", false, 100, 1, 105, 101, 104, 5, 1, true},
+		{"gap of a whole window", false, 100, 1, 150, 1, 149, 10, 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixture := &signingFixture{latest: test.latest, earliest: test.earliest}
+			server := httptest.NewServer(fixture)
+			defer server.Close()
+			c := NewSigningCollector(NewRPCClient(server.URL, nil), 10, test.backfill)
+
+			if err := c.follow(context.Background(), 0); err != nil {
+				t.Fatal(err)
+			}
+			fixture.mutex.Lock()
+			fixture.latest, fixture.earliest = test.nextLatest, test.nextEarliest
+			fixture.mutex.Unlock()
+			if err := c.follow(context.Background(), 0); err != nil {
+				t.Fatal(err)
+			}
+
+			if c.lastHeight != test.lastHeight || int64(len(c.window)) != test.windowBlocks {
+				t.Errorf("last height %d with %d blocks, want %d with %d", c.lastHeight, len(c.window), test.lastHeight, test.windowBlocks)
+			}
+			if fixture.statuses != test.statuses {
+				t.Errorf("%d /status requests, want %d", fixture.statuses, test.statuses)
+			}
+			// The validator set keeps its hash
+			if fixture.validators != 1 {
+				t.Errorf("%d /validators requests, want 1", fixture.validators)
+			}
+			if pruned := c.prunedHeight > 0; pruned != test.pruned {
+				t.Errorf("pruned = %v, want %v", pruned, test.pruned)
+			}
+		})
+	}
+}
+
+func TestBlockInterval(t *testing.T) {
+	tests := []struct {
+		name  string
+		skew  map[string]float64
+		power map[string]int64
+		want  float64
+		ok    bool
+	}{
+		{"equal power", map[string]float64{"A": 1, "B": 2, "C": 3}, map[string]int64{"A": 10, "B": 10, "C": 10}, 2, true},
+		// The median by count would be 2
+		{"weighted", map[string]float64{"A": 1, "B": 2, "C": 3}, map[string]int64{"A": 60, "B": 20, "C": 20}, 1, true},
+		{"weighted late", map[string]float64{"A": 1, "B": 2, "C": 3}, map[string]int64{"A": 10, "B": 10, "C": 80}, 3, true},
+		{"no precommit", map[string]float64{}, map[string]int64{"A": 10}, 0, false},
+		{"unknown validators", map[string]float64{"X": 1}, map[string]int64{"A": 10}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := signedBlock{skew: test.skew, power: test.power}.blockInterval()
+			if got != test.want || ok != test.ok {
+				t.Errorf("blockInterval = %v, %v, want %v, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeSnapshotsUrl = "/api/v2/snapshots"
+
+type DataNodeCoreSnapshots struct {
+	CoreSnapshots struct {
+		Edges []struct {
+			Node struct {
+				BlockHeight string `json:"blockHeight"`
+				BlockHash   string `json:"blockHash"`
+				CoreVersion string `json:"coreVersion"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"coreSnapshots"`
+}
+
+var (
+	metricSnapshotLatestHeight = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "snapshot", "latest_height"),
+		"Height of the latest core snapshot.",
+		nil, nil,
+	)
+	metricSnapshotCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "snapshot", "count"),
+		"Number of core snapshots listed by the data node.",
+		nil, nil,
+	)
+)
+
+// SnapshotCollector exports the core snapshots known to the data node, so
+// operators can check that snapshots are produced for peers to restore from.
+type SnapshotCollector struct {
+	dataNode *DataNodeClient
+}
+
+func NewSnapshotCollector(dataNode *DataNodeClient) *SnapshotCollector {
+	return &SnapshotCollector{dataNode: dataNode}
+}
+
+func (c *SnapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricSnapshotLatestHeight
+	ch <- metricSnapshotCount
+}
+
+func (c *SnapshotCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var latest, count float64
+	cursor := ""
+	for {
+		var page DataNodeCoreSnapshots
+		err := c.dataNode.Get(ctx, dataNodePage(dataNodeSnapshotsUrl, cursor), &page)
+		if err != nil {
+			return fmt.Errorf("listing snapshots: %v", err)
+		}
+		for _, edge := range page.CoreSnapshots.Edges {
+			height, err := strconv.ParseFloat(edge.Node.BlockHeight, 64)
+			if err != nil {
+				return fmt.Errorf("snapshot %s: invalid block height %q", edge.Node.BlockHash, edge.Node.BlockHeight)
+			}
+			if height > latest {
+				latest = height
+			}
+			count++
+		}
+		if !page.CoreSnapshots.PageInfo.HasNextPage {
+			break
+		}
+		cursor = page.CoreSnapshots.PageInfo.EndCursor
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		metricSnapshotLatestHeight, prometheus.GaugeValue, latest,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricSnapshotCount, prometheus.GaugeValue, count,
+	)
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestSnapshotCollectorPages(t *testing.T) {
+	// Oldest first, two per page: the latest is on the last page
+	heights := []int{100, 200, 300, 400, 500}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("pagination.after"))
+		end := offset + 2
+		if end > len(heights) {
+			end = len(heights)
+		}
+		var edges []interface{}
+		for _, height := range heights[offset:end] {
+			edges = append(edges, map[string]interface{}{"node": map[string]string{"blockHeight": strconv.Itoa(height)}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"coreSnapshots": map[string]interface{}{
+				"edges":    edges,
+				"pageInfo": map[string]interface{}{"hasNextPage": end < len(heights), "endCursor": strconv.Itoa(end)},
+			},
+		})
+	}))
+	defer server.Close()
+
+	values, err := collect(t, NewSnapshotCollector(NewDataNodeClient(server.URL, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["vega_snapshot_count"] != 5 || values["vega_snapshot_latest_height"] != 500 {
+		t.Errorf("count, latest height = %v, %v, want 5, 500", values["vega_snapshot_count"], values["vega_snapshot_latest_height"])
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeNetworkParametersUrl = "/api/v2/network/parameters/"
+const dataNodeAssetUrl = "/api/v2/asset/"
+const dataNodeNodesDataUrl = "/api/v2/nodes/data"
+
+// Network parameter holding the asset of the governance token
+const networkParameterRewardAsset = "reward.asset"
+
+// Selector of totalSupply() of an ERC20 token
+const erc20TotalSupply = "0x18160ddd"
+
+type DataNodeNetworkParameter struct {
+	NetworkParameter struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"networkParameter"`
+}
+
+type DataNodeAsset struct {
+	Asset struct {
+		ID      string `json:"id"`
+		Details struct {
+			Symbol string `json:"symbol"`
+			ERC20  *struct {
+				ContractAddress string `json:"contractAddress"`
+			} `json:"erc20"`
+		} `json:"details"`
+	} `json:"asset"`
+}
+
+type DataNodeNodesData struct {
+	NodeData struct {
+		StakedTotal string `json:"stakedTotal"`
+	} `json:"nodeData"`
+}
+
+var (
+	metricNetworkStakedTokens = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "network", "staked_tokens"),
+		"VEGA tokens staked and delegated to the validators, according to the data node.",
+		nil, nil,
+	)
+	metricNetworkTokenSupply = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "network", "token_supply"),
+		"Total supply of the VEGA token contract on Ethereum.",
+		nil, nil,
+	)
+	metricNetworkStakingRatio = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "network", "staking_ratio"),
+		"Share of the VEGA token supply staked on the network.",
+		nil, nil,
+	)
+)
+
+// StakingCollector compares the stake delegated on the network with the
+// supply of the governance token, read from its contract on Ethereum.
+type StakingCollector struct {
+	dataNode *DataNodeClient
+	ethereum *EthereumClient
+
+	mutex sync.Mutex
+	// Contract of the governance token, resolved on the first scrape
+	token string
+}
+
+func NewStakingCollector(dataNode *DataNodeClient, ethereum *EthereumClient) *StakingCollector {
+	return &StakingCollector{dataNode: dataNode, ethereum: ethereum}
+}
+
+func (c *StakingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricNetworkStakedTokens
+	ch <- metricNetworkTokenSupply
+	ch <- metricNetworkStakingRatio
+}
+
+func (c *StakingCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token == "" {
+		token, err := c.tokenContract(ctx)
+		if err != nil {
+			return fmt.Errorf("resolving the governance token: %v", err)
+		}
+		c.token = token
+	}
+
+	var nodesData DataNodeNodesData
+	err := c.dataNode.Get(ctx, dataNodeNodesDataUrl, &nodesData)
+	if err != nil {
+		return fmt.Errorf("reading nodes data: %v", err)
+	}
+	staked, ok := new(big.Int).SetString(nodesData.NodeData.StakedTotal, 10)
+	if !ok {
+		return fmt.Errorf("invalid total stake %q", nodesData.NodeData.StakedTotal)
+	}
+	supply, err := c.ethereum.CallUint256(ctx, c.token, erc20TotalSupply)
+	if err != nil {
+		return fmt.Errorf("reading token supply: %v", err)
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		metricNetworkStakedTokens, prometheus.GaugeValue, tokenAmount(staked),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricNetworkTokenSupply, prometheus.GaugeValue, tokenAmount(supply),
+	)
+	if supply.Sign() > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			metricNetworkStakingRatio, prometheus.GaugeValue, tokenAmount(staked)/tokenAmount(supply),
+		)
+	}
+	return nil
+}
+
+// tokenContract returns the Ethereum contract of the governance token, the
+// ERC20 asset of the reward.asset network parameter.
+func (c *StakingCollector) tokenContract(ctx context.Context) (string, error) {
+	var parameter DataNodeNetworkParameter
+	err := c.dataNode.Get(ctx, dataNodeNetworkParametersUrl+networkParameterRewardAsset, &parameter)
+	if err != nil {
+		return "", err
+	}
+	var asset DataNodeAsset
+	err = c.dataNode.Get(ctx, dataNodeAssetUrl+url.PathEscape(parameter.NetworkParameter.Value), &asset)
+	if err != nil {
+		return "", err
+	}
+	if asset.Asset.Details.ERC20 == nil || asset.Asset.Details.ERC20.ContractAddress == "" {
+		return "", fmt.Errorf("asset %s isn't an ERC20 token", parameter.NetworkParameter.Value)
+	}
+	return asset.Asset.Details.ERC20.ContractAddress, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Selector of total_staked() of the staking bridge
+const stakingBridgeTotalStaked = "0xaf7568dd"
+
+// Topics of the stake events of the staking bridge, by event label
+var stakingBridgeEvents = map[string]string{
+	// Stake_Deposited(address,uint256,bytes32)
+	"deposited": "0x9e3e33edf5dcded4adabc51b1266225d00fa41516bfcad69513fa4eca69519da",
+	// Stake_Removed(address,uint256,bytes32)
+	"removed": "0xa131d16963736e4c641f27a7f82f2e350b5971e555ae06ae906892bbba0a0939",
+	// Stake_Transferred(address,uint256,address,bytes32)
+	"transferred": "0x296aca09e6f616abedcd9cd45ac378207310452b7a713289374fd1b35e2c2fbe",
+}
+
+// About a day of Ethereum blocks
+const defaultStakeEventBlocks = 7200
+
+// Most blocks requested per eth_getLogs, providers limit the range
+const ethereumLogsMaxRange = 2000
+
+var (
+	metricStakingBridgeTotalStaked = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "staking_bridge", "total_staked_tokens"),
+		"VEGA tokens staked through the staking bridge contract on Ethereum.",
+		nil, nil,
+	)
+	metricStakingBridgeEvents = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "staking_bridge", "events"),
+		"Number of stake events of the staking bridge over the recent Ethereum blocks.",
+		[]string{"event"}, nil,
+	)
+	metricStakingBridgeEventTokens = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "staking_bridge", "event_tokens"),
+		"VEGA tokens moved by the stake events of the staking bridge over the recent Ethereum blocks.",
+		[]string{"event"}, nil,
+	)
+	metricStakingBridgeUndelegated = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "staking_bridge", "undelegated_tokens"),
+		"VEGA tokens staked through the staking bridge minus the stake delegated on Vega according to the data node, negative when Vega counts more stake than the bridge holds.",
+		nil, nil,
+	)
+	metricStakingBridgeLastBlock = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "staking_bridge", "last_block"),
+		"Latest Ethereum block read by the staking bridge collector.",
+		nil, nil,
+	)
+)
+
+// stakeEvent is a stake event seen in an Ethereum block.
+type stakeEvent struct {
+	block  int64
+	event  string
+	tokens float64
+}
+
+// StakingBridgeCollector reads the stake held by the staking bridge contract
+// and follows its stake events over a window of recent Ethereum blocks. With
+// a data node, the stake of the bridge is compared with the stake delegated
+// on Vega: stake nobody delegated yet is expected, but a difference that
+// keeps growing or turns negative means Vega missed bridge events.
+type StakingBridgeCollector struct {
+	ethereum *EthereumClient
+	dataNode *DataNodeClient
+	contract string
+	blocks   int64
+
+	mutex     sync.Mutex
+	lastBlock int64
+	events    []stakeEvent
+}
+
+func NewStakingBridgeCollector(ethereum *EthereumClient, dataNode *DataNodeClient, config EthereumConfig) *StakingBridgeCollector {
+	blocks := config.EventBlocks
+	if blocks <= 0 {
+		blocks = defaultStakeEventBlocks
+	}
+	return &StakingBridgeCollector{
+		ethereum: ethereum,
+		dataNode: dataNode,
+		contract: config.StakingBridge,
+		blocks:   blocks,
+	}
+}
+
+func (c *StakingBridgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricStakingBridgeTotalStaked
+	ch <- metricStakingBridgeEvents
+	ch <- metricStakingBridgeEventTokens
+	ch <- metricStakingBridgeUndelegated
+	ch <- metricStakingBridgeLastBlock
+}
+
+func (c *StakingBridgeCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	staked, err := c.ethereum.CallUint256(ctx, c.contract, stakingBridgeTotalStaked)
+	if err != nil {
+		return fmt.Errorf("reading total staked: %v", err)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricStakingBridgeTotalStaked, prometheus.GaugeValue, tokenAmount(staked),
+	)
+
+	if c.dataNode != nil {
+		var nodesData DataNodeNodesData
+		err = c.dataNode.Get(ctx, dataNodeNodesDataUrl, &nodesData)
+		if err != nil {
+			return fmt.Errorf("reading nodes data: %v", err)
+		}
+		delegated, ok := new(big.Int).SetString(nodesData.NodeData.StakedTotal, 10)
+		if !ok {
+			return fmt.Errorf("invalid total stake %q", nodesData.NodeData.StakedTotal)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricStakingBridgeUndelegated, prometheus.GaugeValue, tokenAmount(new(big.Int).Sub(staked, delegated)),
+		)
+	}
+
+	err = c.follow(ctx)
+	if err != nil {
+		return fmt.Errorf("reading stake events: %v", err)
+	}
+
+	counts := make(map[string]float64)
+	tokens := make(map[string]float64)
+	for event := range stakingBridgeEvents {
+		counts[event] = 0
+		tokens[event] = 0
+	}
+	for _, event := range c.events {
+		counts[event.event]++
+		tokens[event.event] += event.tokens
+	}
+	for event := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			metricStakingBridgeEvents, prometheus.GaugeValue, counts[event], event,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricStakingBridgeEventTokens, prometheus.GaugeValue, tokens[event], event,
+		)
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricStakingBridgeLastBlock, prometheus.GaugeValue, float64(c.lastBlock),
+	)
+	return nil
+}
+
+// follow reads the stake events of the blocks since the previous call and
+// drops the ones that left the window. The events read are kept even when a
+// later range fails.
+func (c *StakingBridgeCollector) follow(ctx context.Context) error {
+	latest, err := c.ethereum.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	first := latest - c.blocks + 1
+
+	kinds := make(map[string]string)
+	var topics []string
+	for event, topic := range stakingBridgeEvents {
+		kinds[topic] = event
+		topics = append(topics, topic)
+	}
+
+	from := c.lastBlock + 1
+	if from < first {
+		from = first
+	}
+	for ; from <= latest; from += ethereumLogsMaxRange {
+		to := from + ethereumLogsMaxRange - 1
+		if to > latest {
+			to = latest
+		}
+		logs, err := c.ethereum.Logs(ctx, c.contract, from, to, topics)
+		if err != nil {
+			return err
+		}
+		for _, log := range logs {
+			if log.Removed || len(log.Topics) == 0 {
+				continue
+			}
+			block, err := parseQuantity(log.BlockNumber)
+			if err != nil {
+				return fmt.Errorf("parsing log block number: %v", err)
+			}
+			// The amount is the only argument that isn't indexed
+			amount, err := parseUint256(log.Data)
+			if err != nil {
+				return fmt.Errorf("parsing stake amount: %v", err)
+			}
+			c.events = append(c.events, stakeEvent{block: block, event: kinds[log.Topics[0]], tokens: tokenAmount(amount)})
+		}
+		c.lastBlock = to
+	}
+
+	kept := c.events[:0]
+	for _, event := range c.events {
+		if event.block >= first {
+			kept = append(kept, event)
+		}
+	}
+	c.events = kept
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStakingBridgeUndelegated(t *testing.T) {
+	tokens := func(amount int64) *big.Int {
+		return new(big.Int).Mul(big.NewInt(amount), big.NewInt(1e18))
+	}
+	// 1000 tokens on the bridge
+	ethereum := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     interface{} `json:"id"`
+			Method string      `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		var result interface{}
+		switch request.Method {
+		case "eth_call":
+			result = fmt.Sprintf("0x%064x", tokens(1000))
+		case "eth_blockNumber":
+			result = "0x10"
+		case "eth_getLogs":
+			result = []interface{}{}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": request.ID, "result": result})
+	}))
+	defer ethereum.Close()
+
+	tests := []struct {
+		name        string
+		delegated   *big.Int
+		undelegated float64
+	}{
+		{"stake not delegated", tokens(800), 200},
+		{"all delegated", tokens(1000), 0},
+		{"more delegated than staked", tokens(1100), -100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataNode := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"nodeData": {"stakedTotal": %q}}`, test.delegated.String())
+			}))
+			defer dataNode.Close()
+			c := NewStakingBridgeCollector(NewEthereumClient(ethereum.URL, nil), NewDataNodeClient(dataNode.URL, nil),
+				EthereumConfig{StakingBridge: "0xbridge"})
+
+			values, err := collect(t, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := values["vega_staking_bridge_undelegated_tokens"]; got != test.undelegated {
+				t.Errorf("undelegated tokens = %v, want %v", got, test.undelegated)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Unix nanoseconds of the last scrape that reached the node, used to decide
+// whether systemd watchdog pings are sent.
+var lastScrapeSuccess int64
+
+func markScrapeSuccess() {
+	atomic.StoreInt64(&lastScrapeSuccess, time.Now().UnixNano())
+}
+
+// sdNotify sends a state update to systemd. It does nothing when the
+// exporter wasn't started by systemd with Type=notify.
+func sdNotify(state string) error {
+	socketPath := os.Getenv("NOTIFY_SOCKET")
+	if socketPath == "" {
+		return nil
+	}
+	// Abstract namespace sockets are announced with a leading @
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// startWatchdog pings the systemd watchdog at half its interval as long as a
+// scrape succeeded within maxScrapeAge, so systemd restarts an exporter that
+// stopped collecting. Until the first scrape the start time counts as success.
+func startWatchdog(maxScrapeAge time.Duration) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	atomic.CompareAndSwapInt64(&lastScrapeSuccess, 0, time.Now().UnixNano())
+	interval := time.Duration(usec) * time.Microsecond / 2
+	logInfof("Sending systemd watchdog pings every %s", interval)
+
+	go func() {
+		for range time.Tick(interval) {
+			last := time.Unix(0, atomic.LoadInt64(&lastScrapeSuccess))
+			if time.Since(last) > maxScrapeAge {
+				logWarnf("No successful scrape since %s, withholding watchdog ping", last.Format(time.RFC3339))
+				continue
+			}
+			err := sdNotify("WATCHDOG=1")
+			if err != nil {
+				logErrorf("Error sending watchdog ping: %v", err)
+			}
+		}
+	}()
+}
+
+// First file descriptor passed by systemd socket activation
+const listenFdsStart = 3
+
+// activationListener returns the listener passed by systemd socket
+// activation, or nil when the exporter wasn't socket activated.
+func activationListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+	if fds > 1 {
+		logWarnf("Received %d sockets from systemd, only the first one is used", fds)
+	}
+
+	// Not meant for child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	syscall.CloseOnExec(listenFdsStart)
+	file := os.NewFile(listenFdsStart, "LISTEN_FD_3")
+	defer file.Close()
+	return net.FileListener(file)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/proxy"
+)
+
+// torDialer connects to .onion hosts through the SOCKS proxy of Tor, nil
+// unless --rpc.tor-proxy is set.
+var torDialer proxy.ContextDialer
+
+// isOnion tells whether a host is a Tor onion service.
+func isOnion(host string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(strings.ToLower(host), "."), ".onion")
+}
+
+// setupTor sends the connections to .onion hosts through the SOCKS5 proxy
+// of Tor, like socks5://127.0.0.1:9050. Credentials in the URL are sent to
+// the proxy, which Tor uses to isolate the circuits. The other hosts keep
+// the proxy of the transport, if any.
+func setupTor(proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return fmt.Errorf("scheme %q isn't supported, expected socks5://host:port", u.Scheme)
+	}
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+	// The host name is sent to the proxy, onion services can't be resolved
+	// locally
+	dialer, err := proxy.SOCKS5("tcp", u.Host, auth, &net.Dialer{Timeout: *rpcDialTimeout})
+	if err != nil {
+		return err
+	}
+	torDialer = dialer.(proxy.ContextDialer)
+
+	transportProxy := tr.Proxy
+	tr.Proxy = func(req *http.Request) (*url.URL, error) {
+		if isOnion(req.URL.Hostname()) || transportProxy == nil {
+			return nil, nil
+		}
+		return transportProxy(req)
+	}
+	return nil
+}
+
+// dialOnion connects to a .onion address through Tor.
+func dialOnion(ctx context.Context, network, address string) (net.Conn, error) {
+	if torDialer == nil {
+		return nil, fmt.Errorf("%s is an onion service, set --rpc.tor-proxy to reach it", address)
+	}
+	return torDialer.DialContext(ctx, network, address)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Most spans waiting to be sent, later ones are dropped
+const tracingQueueSize = 4096
+
+// Time between two batches of spans sent to --tracing.otlp-endpoint
+const tracingBatchInterval = 5 * time.Second
+
+// OTLP span kinds
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// span is a timed operation of a trace, sent to an OTLP/HTTP collector like
+// Tempo or Jaeger once ended. A nil span is a trace that isn't recorded, its
+// methods do nothing.
+type span struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        error
+}
+
+type spanContextKey struct{}
+
+// spans are the ended spans waiting for the next batch.
+var spans = make(chan *span, tracingQueueSize)
+
+// startTrace starts the root span of a trace, for the share of the traces
+// given by --tracing.sample-ratio. Nothing is recorded without
+// --tracing.otlp-endpoint.
+func startTrace(ctx context.Context, name string) (context.Context, *span) {
+	if *tracingEndpoint == "" || mathrand.Float64() >= *tracingSampleRatio {
+		return ctx, nil
+	}
+	s := &span{name: name, kind: spanKindInternal, start: time.Now(), attributes: make(map[string]string)}
+	rand.Read(s.traceID[:])
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// startSpan starts a child of the span of ctx, if it has one.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	parent, _ := ctx.Value(spanContextKey{}).(*span)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := &span{
+		traceID:    parent.traceID,
+		parentID:   parent.spanID,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]string),
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// withSpan returns ctx with s as the parent of the spans started from it.
+func withSpan(ctx context.Context, s *span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+func (s *span) setAttribute(key, value string) {
+	if s != nil {
+		s.attributes[key] = value
+	}
+}
+
+// finish ends the span, failed when err isn't nil, and queues it.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	select {
+	case spans <- s:
+	default:
+		logDebugf("Tracing queue full, dropping span %s", s.name)
+	}
+}
+
+// sendSpans sends the queued spans to --tracing.otlp-endpoint in batches
+// until the process exits.
+func sendSpans() {
+	ticker := time.NewTicker(tracingBatchInterval)
+	defer ticker.Stop()
+	var batch []*span
+	for {
+		select {
+		case s := <-spans:
+			batch = append(batch, s)
+			if len(batch) < tracingQueueSize/4 {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		err := exportSpans(batch)
+		if err != nil {
+			logWarnf("Error sending %d spans: %v", len(batch), err)
+		}
+		batch = nil
+	}
+}
+
+// otlpAttribute is a key value of the OTLP JSON encoding.
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	var encoded []otlpAttribute
+	for key, value := range attributes {
+		attribute := otlpAttribute{Key: key}
+		attribute.Value.StringValue = value
+		encoded = append(encoded, attribute)
+	}
+	return encoded
+}
+
+// exportSpans posts spans to the /v1/traces path of the collector, in the
+// JSON encoding of OTLP/HTTP.
+func exportSpans(batch []*span) error {
+	type otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	type otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+
+	var encoded []otlpSpan
+	for _, s := range batch {
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attributes),
+			// Status codes: unset 0, ok 1, error 2
+			Status: otlpStatus{Code: 1},
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != nil {
+			span.Status = otlpStatus{Code: 2, Message: s.err.Error()}
+		}
+		encoded = append(encoded, span)
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]string{"service.name": *tracingServiceName}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "vega-prometheus-exporter"},
+				"spans": encoded,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	url := strings.TrimSuffix(*tracingEndpoint, "/") + "/v1/traces"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeTradesUrl = "/api/v2/trades"
+
+type DataNodeTrades struct {
+	Trades struct {
+		Edges []struct {
+			Node struct {
+				ID        string `json:"id"`
+				Price     string `json:"price"`
+				Size      string `json:"size"`
+				Timestamp string `json:"timestamp"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"trades"`
+}
+
+var (
+	metricMarketTrades = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "trades_total"),
+		"Number of trades of the market since the exporter started.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketTradedVolume = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "traded_volume_total"),
+		"Number of contracts traded on the market since the exporter started.",
+		[]string{"market_id", "market"}, nil,
+	)
+	metricMarketTradedNotional = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "market", "traded_notional_total"),
+		"Value of the trades of the market since the exporter started, in units of the settlement asset.",
+		[]string{"market_id", "market"}, nil,
+	)
+)
+
+// marketTrades counts the trades of a market. Trades at the timestamp of the
+// latest one seen may still be listed again, their IDs are kept to skip them.
+type marketTrades struct {
+	trades   float64
+	volume   float64
+	notional float64
+
+	lastTimestamp int64
+	lastIDs       map[string]bool
+}
+
+// TradesCollector follows the trades of every market still trading and
+// counts them, so that rate() gives the volume over any range.
+type TradesCollector struct {
+	dataNode *DataNodeClient
+
+	mutex  sync.Mutex
+	start  int64
+	counts map[string]*marketTrades
+}
+
+func NewTradesCollector(dataNode *DataNodeClient) *TradesCollector {
+	return &TradesCollector{
+		dataNode: dataNode,
+		counts:   make(map[string]*marketTrades),
+	}
+}
+
+func (c *TradesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricMarketTrades
+	ch <- metricMarketTradedVolume
+	ch <- metricMarketTradedNotional
+}
+
+func (c *TradesCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Trades before the first scrape aren't counted, counters start at 0
+	if c.start == 0 {
+		c.start = time.Now().UnixNano()
+	}
+
+	markets, err := listMarkets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing markets: %v", err)
+	}
+	for _, market := range markets {
+		if market.closed() {
+			continue
+		}
+		counts, ok := c.counts[market.ID]
+		if !ok {
+			counts = &marketTrades{lastTimestamp: c.start, lastIDs: make(map[string]bool)}
+			c.counts[market.ID] = counts
+		}
+		err := c.follow(ctx, market, counts)
+		if err != nil {
+			return fmt.Errorf("market %s: %v", market.ID, err)
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketTrades, prometheus.CounterValue, counts.trades, market.ID, market.label(),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketTradedVolume, prometheus.CounterValue, counts.volume, market.ID, market.label(),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricMarketTradedNotional, prometheus.CounterValue, counts.notional, market.ID, market.label(),
+		)
+	}
+	return nil
+}
+
+// follow adds the trades of a market since the latest one counted. The pages
+// are read from the same start whatever order the data node lists the trades
+// in, the latest trade only moves once all of them are read.
+func (c *TradesCollector) follow(ctx context.Context, market DataNodeMarket, counts *marketTrades) error {
+	priceDecimals, err := strconv.Atoi(market.DecimalPlaces)
+	if err != nil {
+		return fmt.Errorf("invalid decimal places %q", market.DecimalPlaces)
+	}
+	sizeDecimals, err := strconv.Atoi(market.PositionDecimalPlaces)
+	if err != nil {
+		return fmt.Errorf("invalid position decimal places %q", market.PositionDecimalPlaces)
+	}
+
+	since, sinceIDs := counts.lastTimestamp, counts.lastIDs
+	cursor := ""
+	for {
+		var page DataNodeTrades
+		path := dataNodePage(dataNodeTradesUrl, cursor) +
+			"&pagination.newestFirst=false" +
+			"&marketIds=" + url.QueryEscape(market.ID) +
+			"&dateRange.startTimestamp=" + strconv.FormatInt(since, 10)
+		err := c.dataNode.Get(ctx, path, &page)
+		if err != nil {
+			return err
+		}
+		for _, edge := range page.Trades.Edges {
+			trade := edge.Node
+			timestamp, err := strconv.ParseInt(trade.Timestamp, 10, 64)
+			if err != nil {
+				return fmt.Errorf("trade %s: invalid timestamp %q", trade.ID, trade.Timestamp)
+			}
+			if timestamp < since || timestamp == since && sinceIDs[trade.ID] {
+				continue
+			}
+			price, err := parseAmount(trade.Price, priceDecimals)
+			if err != nil {
+				return fmt.Errorf("trade %s: price: %v", trade.ID, err)
+			}
+			size, err := parseAmount(trade.Size, sizeDecimals)
+			if err != nil {
+				return fmt.Errorf("trade %s: size: %v", trade.ID, err)
+			}
+
+			counts.trades++
+			counts.volume += size
+			counts.notional += price * size
+			if timestamp > counts.lastTimestamp {
+				counts.lastTimestamp = timestamp
+				counts.lastIDs = make(map[string]bool)
+			}
+			if timestamp == counts.lastTimestamp {
+				counts.lastIDs[trade.ID] = true
+			}
+		}
+		if !page.Trades.PageInfo.HasNextPage {
+			return nil
+		}
+		cursor = page.Trades.PageInfo.EndCursor
+	}
+}
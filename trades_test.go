@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// tradesFixture is a data node listing the trades of a market two per page,
+// newest first unless asked otherwise like the real one.
+type tradesFixture struct {
+	mutex  sync.Mutex
+	trades []map[string]string
+	// Ignore pagination.newestFirst, listing newest first anyway
+	newestFirst bool
+}
+
+func (f *tradesFixture) add(id string, timestamp int64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.trades = append(f.trades, map[string]string{
+		"id": id, "price": "10", "size": "2", "timestamp": strconv.FormatInt(timestamp, 10),
+	})
+}
+
+func (f *tradesFixture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	query := r.URL.Query()
+	switch r.URL.Path {
+	case dataNodeMarketsUrl:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"markets": map[string]interface{}{
+				"edges": []interface{}{map[string]interface{}{"node": map[string]interface{}{
+					"id": "m1", "state": "STATE_ACTIVE", "decimalPlaces": "0", "positionDecimalPlaces": "0",
+				}}},
+			},
+		})
+	case dataNodeTradesUrl:
+		start, _ := strconv.ParseInt(query.Get("dateRange.startTimestamp"), 10, 64)
+		var trades []map[string]string
+		for _, trade := range f.trades {
+			timestamp, _ := strconv.ParseInt(trade["timestamp"], 10, 64)
+			if timestamp >= start {
+				trades = append(trades, trade)
+			}
+		}
+		newestFirst := f.newestFirst || query.Get("pagination.newestFirst") != "false"
+		sort.SliceStable(trades, func(i, j int) bool {
+			if newestFirst {
+				return trades[i]["timestamp"] > trades[j]["timestamp"]
+			}
+			return trades[i]["timestamp"] < trades[j]["timestamp"]
+		})
+
+		offset, _ := strconv.Atoi(query.Get("pagination.after"))
+		if offset > len(trades) {
+			offset = len(trades)
+		}
+		end := offset + 2
+		if end > len(trades) {
+			end = len(trades)
+		}
+		var edges []interface{}
+		for _, trade := range trades[offset:end] {
+			edges = append(edges, map[string]interface{}{"node": trade})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"trades": map[string]interface{}{
+				"edges":    edges,
+				"pageInfo": map[string]interface{}{"hasNextPage": end < len(trades), "endCursor": strconv.Itoa(end)},
+			},
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestTradesCollector(t *testing.T) {
+	for _, newestFirst := range []bool{false, true} {
+		t.Run("newest first "+strconv.FormatBool(newestFirst), func(t *testing.T) {
+			fixture := &tradesFixture{newestFirst: newestFirst}
+			server := httptest.NewServer(fixture)
+			defer server.Close()
+			c := NewTradesCollector(NewDataNodeClient(server.URL, nil))
+			c.start = 1000
+
+			// Before the start, not counted
+			fixture.add("old", 999)
+			// At the start of the collector
+			fixture.add("a", 1000)
+			fixture.add("b", 1001)
+			fixture.add("c", 1002)
+			fixture.add("d", 1003)
+
+			steps := []struct {
+				add    []string
+				trades float64
+			}{
+				{nil, 4},
+				// Nothing new, the trades at the latest timestamp are listed again
+				{nil, 4},
+				// A trade at the latest timestamp and a later one
+				{[]string{"e", "f"}, 6},
+			}
+			for i, step := range steps {
+				for _, id := range step.add {
+					timestamp := int64(1003)
+					if id == "f" {
+						timestamp = 1004
+					}
+					fixture.add(id, timestamp)
+				}
+				values, err := collect(t, c)
+				if err != nil {
+					t.Fatal(err)
+				}
+				trades := values[`vega_market_trades_total{market="",market_id="m1"}`]
+				volume := values[`vega_market_traded_volume_total{market="",market_id="m1"}`]
+				notional := values[`vega_market_traded_notional_total{market="",market_id="m1"}`]
+				if trades != step.trades || volume != 2*step.trades || notional != 20*step.trades {
+					t.Errorf("step %d: trades, volume, notional = %v, %v, %v, want %v, %v, %v",
+						i, trades, volume, notional, step.trades, 2*step.trades, 20*step.trades)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricValidatorTendermintPower = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "validator", "tendermint_power"),
+		"Voting power of the validator in the Tendermint validator set.",
+		[]string{"vega_id", "validator"}, nil,
+	)
+	metricValidatorExpectedPower = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "validator", "expected_power"),
+		"Voting power Vega computed for the validator from its stake and performance.",
+		[]string{"vega_id", "validator"}, nil,
+	)
+	metricValidatorPowerMismatch = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "validator", "power_mismatch"),
+		"Whether the Tendermint voting power of the validator differs from the one Vega computed.",
+		[]string{"vega_id", "validator"}, nil,
+	)
+)
+
+// ValidatorPowerCollector checks the voting power of each validator in the
+// Tendermint validator set against the one computed by Vega, which differ
+// when the core and consensus layers disagree.
+type ValidatorPowerCollector struct {
+	dataNode *DataNodeClient
+	rpc      *RPCClient
+}
+
+func NewValidatorPowerCollector(dataNode *DataNodeClient, rpc *RPCClient) *ValidatorPowerCollector {
+	return &ValidatorPowerCollector{dataNode: dataNode, rpc: rpc}
+}
+
+func (c *ValidatorPowerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricValidatorTendermintPower
+	ch <- metricValidatorExpectedPower
+	ch <- metricValidatorPowerMismatch
+}
+
+func (c *ValidatorPowerCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var nodes DataNodeNodes
+	err := c.dataNode.Get(ctx, dataNodeNodesUrl, &nodes)
+	if err != nil {
+		return fmt.Errorf("listing nodes: %v", err)
+	}
+	powers, err := c.tendermintPowers(ctx)
+	if err != nil {
+		return fmt.Errorf("reading validator set: %v", err)
+	}
+
+	for _, edge := range nodes.Nodes.Edges {
+		node := edge.Node
+		name := labelValue(node.Name)
+		// Validators outside of the Tendermint set have no power
+		power := powers[node.TmPubKey]
+		expected := node.RankingScore.VotingPower
+
+		mismatch := 0.0
+		if power != expected {
+			mismatch = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricValidatorTendermintPower, prometheus.GaugeValue, float64(power), node.ID, name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricValidatorExpectedPower, prometheus.GaugeValue, float64(expected), node.ID, name,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricValidatorPowerMismatch, prometheus.GaugeValue, mismatch, node.ID, name,
+		)
+	}
+	return nil
+}
+
+// tendermintPowers returns the voting power of the latest validator set by
+// public key.
+func (c *ValidatorPowerCollector) tendermintPowers(ctx context.Context) (map[string]int64, error) {
+	powers := make(map[string]int64)
+	for page := 1; ; page++ {
+		var validators VegaValidators
+		err := c.rpc.GetJSON(ctx, fmt.Sprintf("%s?page=%d&per_page=%d", vegaValidatorsUrl, page, validatorsPageSize), &validators)
+		if err != nil {
+			return nil, err
+		}
+		total, err := strconv.Atoi(validators.Result.Total)
+		if err != nil {
+			return nil, fmt.Errorf("parsing validator total: %v", err)
+		}
+		for _, validator := range validators.Result.Validators {
+			power, err := strconv.ParseInt(validator.VotingPower, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("validator %s: invalid voting power %q", validator.Address, validator.VotingPower)
+			}
+			powers[validator.PubKey.Value] = power
+		}
+		if len(powers) >= total || len(validators.Result.Validators) == 0 {
+			return powers, nil
+		}
+	}
+}
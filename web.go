@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var metricCachedScrapes = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Subsystem: "exporter",
+	Name:      "cached_scrapes_total",
+	Help:      "Number of scrapes served from the previous collection because of --scrape.min-interval.",
+})
+
+// Buckets of clients not seen for this long are dropped
+const rateLimiterIdleExpiry = 10 * time.Minute
+
+// rateLimiter is a token bucket per client IP.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// allow takes a token from the bucket of the client, if there is one left.
+func (l *rateLimiter) allow(client string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastPrune) > rateLimiterIdleExpiry {
+		for key, bucket := range l.buckets {
+			if now.Sub(bucket.last) > rateLimiterIdleExpiry {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// limit rejects requests of clients exceeding their rate with 429. Peers of
+// a unix socket can't be told apart, they are not limited.
+func (l *rateLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !unixPeer(r) && !l.allow(clientIP(r)) {
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address of the peer. Forwarding headers are ignored
+// as any client could set them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// unixPeer tells whether the request came through a unix socket, such as one
+// passed by systemd. Its peers have no address, "@" or "" at best: access to
+// them is granted by the permissions of the socket.
+func unixPeer(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// parseCIDRs parses a comma separated list of networks. Bare addresses are
+// accepted as single host networks.
+func parseCIDRs(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// allowNetworks rejects requests from peers outside the given networks with
+// 403. Peers of a unix socket are always allowed.
+func allowNetworks(networks []*net.IPNet, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unixPeer(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := net.ParseIP(clientIP(r))
+		for _, network := range networks {
+			if ip != nil && network.Contains(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
+
+// cachingGatherer reuses the last result of a gatherer for scrapes arriving
+// less than interval after it, so that aggressive or duplicate scrape configs
+// don't hit the nodes more often. Concurrent scrapes wait for the same
+// collection.
+type cachingGatherer struct {
+	gatherer prometheus.Gatherer
+	interval time.Duration
+
+	mutex    sync.Mutex
+	last     time.Time
+	families []*dto.MetricFamily
+	err      error
+}
+
+func (g *cachingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if time.Since(g.last) >= g.interval {
+		g.families, g.err = g.gatherer.Gather()
+		g.last = time.Now()
+	} else {
+		metricCachedScrapes.Inc()
+	}
+	return g.families, g.err
+}
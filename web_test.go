@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// webRequest is a request from remoteAddr, received on a listener of the
+// given network.
+func webRequest(network, remoteAddr string) *http.Request {
+	local := net.Addr(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2112})
+	if network == "unix" {
+		local = &net.UnixAddr{Name: "/run/vega-prometheus-exporter.sock", Net: "unix"}
+	}
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.RemoteAddr = remoteAddr
+	return r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, local))
+}
+
+func TestRateLimiter(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name    string
+		network string
+		remotes []string
+		want    []int
+	}{
+		{"burst", "tcp", []string{"10.0.0.1:1000", "10.0.0.1:1001", "10.0.0.1:1002"}, []int{200, 200, 429}},
+		{"per client", "tcp", []string{"10.0.0.1:1000", "10.0.0.1:1001", "10.0.0.2:1000"}, []int{200, 200, 200}},
+		{"ipv6", "tcp", []string{"[2001:db8::1]:1000", "[2001:db8::1]:1001", "[2001:db8::1]:1002"}, []int{200, 200, 429}},
+		{"unix socket", "unix", []string{"@", "@", "", ""}, []int{200, 200, 200, 200}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// No refill during the test
+			handler := newRateLimiter(1e-9, 2).limit(ok)
+			for i, remote := range test.remotes {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, webRequest(test.network, remote))
+				if w.Code != test.want[i] {
+					t.Errorf("request %d from %q: status %d, want %d", i, remote, w.Code, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAllowNetworks(t *testing.T) {
+	networks, err := parseCIDRs("10.0.0.0/8, 192.168.1.10,2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := allowNetworks(networks, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		network string
+		remote  string
+		want    int
+	}{
+		{"tcp", "10.1.2.3:1000", 200},
+		{"tcp", "192.168.1.10:1000", 200},
+		{"tcp", "192.168.1.11:1000", 403},
+		{"tcp", "[2001:db8::1]:1000", 200},
+		{"tcp", "[2001:db9::1]:1000", 403},
+		{"tcp", "@", 403},
+		{"tcp", "", 403},
+		{"unix", "@", 200},
+		{"unix", "", 200},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, webRequest(test.network, test.remote))
+		if w.Code != test.want {
+			t.Errorf("%s peer %q: status %d, want %d", test.network, test.remote, w.Code, test.want)
+		}
+	}
+}
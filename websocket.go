@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/proxy"
+	"golang.org/x/net/websocket"
+)
+
+const vegaWebsocketUrl = "/websocket"
+
+// Delay before reconnecting a dropped WebSocket
+const websocketRetryInterval = 5 * time.Second
+
+// A WebSocket without any event for this long is considered dead, a live
+// chain has new rounds every few seconds.
+const websocketReadTimeout = time.Minute
+
+// Tendermint SignedMsgType of a prevote
+const voteTypePrevote = 1
+
+// Consensus events subscribed to over the WebSocket
+var websocketQueries = []string{
+	"tm.event='NewRound'",
+	"tm.event='Vote'",
+}
+
+// VegaEventMessage is a JSON-RPC message of the WebSocket: a subscription
+// acknowledgment or an event.
+type VegaEventMessage struct {
+	ID     interface{} `json:"id"`
+	Result struct {
+		Query string `json:"query"`
+		Data  struct {
+			Type  string          `json:"type"`
+			Value json.RawMessage `json:"value"`
+		} `json:"data"`
+	} `json:"result"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    string `json:"data"`
+	} `json:"error"`
+}
+
+type VegaNewRoundEvent struct {
+	Height string `json:"height"`
+	Round  int    `json:"round"`
+	Step   string `json:"step"`
+}
+
+type VegaVoteEvent struct {
+	Vote struct {
+		Type             int       `json:"type"`
+		Height           string    `json:"height"`
+		Round            int       `json:"round"`
+		Timestamp        time.Time `json:"timestamp"`
+		ValidatorAddress string    `json:"validator_address"`
+	} `json:"Vote"`
+}
+
+var (
+	metricWebsocketUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "websocket", "up"),
+		"Whether the exporter is subscribed to the consensus events of the node.",
+		nil, nil,
+	)
+	metricWebsocketReconnects = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "websocket", "reconnects_total"),
+		"Number of times the WebSocket subscription was set up again after failing.",
+		nil, nil,
+	)
+)
+
+// roundKey identifies a consensus round.
+type roundKey struct {
+	height int64
+	round  int
+}
+
+// ConsensusEventsCollector follows the consensus of the node through the
+// events of the RPC WebSocket, in the background between scrapes.
+type ConsensusEventsCollector struct {
+	rpc      *RPCClient
+	endpoint string
+	headers  map[string]string
+
+	prevoteLatency prometheus.Histogram
+
+	mutex      sync.Mutex
+	connected  bool
+	reconnects float64
+	// Local time at which each recent round started
+	roundStarts map[roundKey]time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewConsensusEventsCollector(rpc *RPCClient, endpoint string, headers map[string]string) *ConsensusEventsCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &ConsensusEventsCollector{
+		rpc:      rpc,
+		endpoint: endpoint,
+		headers:  headers,
+		prevoteLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "validator",
+			Name:      "prevote_latency_seconds",
+			Help:      "Time between the start of a round and the prevote of the node's validator.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+		}),
+		roundStarts: make(map[roundKey]time.Time),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	go c.run()
+	return c
+}
+
+func (c *ConsensusEventsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricWebsocketUp
+	ch <- metricWebsocketReconnects
+	c.prevoteLatency.Describe(ch)
+}
+
+func (c *ConsensusEventsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var connected float64
+	if c.connected {
+		connected = 1
+	}
+	ch <- prometheus.MustNewConstMetric(
+		metricWebsocketUp, prometheus.GaugeValue, connected,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		metricWebsocketReconnects, prometheus.CounterValue, c.reconnects,
+	)
+	c.prevoteLatency.Collect(ch)
+	return nil
+}
+
+// Close stops following the events.
+func (c *ConsensusEventsCollector) Close() error {
+	c.cancel()
+	return nil
+}
+
+// run keeps a subscription open until the collector is closed.
+func (c *ConsensusEventsCollector) run() {
+	for {
+		err := c.subscribe()
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.mutex.Lock()
+		c.connected = false
+		c.reconnects++
+		c.mutex.Unlock()
+		logWarnf("WebSocket of %s: %v, reconnecting in %v", c.endpoint, err, websocketRetryInterval)
+
+		select {
+		case <-time.After(websocketRetryInterval):
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe reads the consensus events of a new WebSocket until it fails.
+func (c *ConsensusEventsCollector) subscribe() error {
+	ctx, cancel := context.WithTimeout(c.ctx, *rpcTimeout)
+	status, err := c.status(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	// Nodes that aren't validators never prevote, the rounds are still
+	// followed for the other metrics.
+	address := status.Result.ValidatorInfo.Address
+
+	ws, err := dialWebsocket(c.ctx, c.endpoint, vegaWebsocketUrl, c.headers)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	go func() {
+		<-c.ctx.Done()
+		ws.Close()
+	}()
+
+	for i, query := range websocketQueries {
+		err = websocket.JSON.Send(ws, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "subscribe",
+			"id":      i,
+			"params":  map[string]string{"query": query},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mutex.Lock()
+	c.connected = true
+	c.mutex.Unlock()
+
+	for {
+		var message VegaEventMessage
+		ws.SetReadDeadline(time.Now().Add(websocketReadTimeout))
+		err := websocket.JSON.Receive(ws, &message)
+		if err != nil {
+			return err
+		}
+		if message.Error != nil {
+			return fmt.Errorf("subscription failed: %s %s", message.Error.Message, message.Error.Data)
+		}
+		err = c.handle(message, address, time.Now())
+		if err != nil {
+			logWarnf("WebSocket of %s: %v", c.endpoint, err)
+		}
+	}
+}
+
+func (c *ConsensusEventsCollector) status(ctx context.Context) (VegaStatus, error) {
+	var status VegaStatus
+	err := c.rpc.GetJSON(ctx, vegaStatusUrl, &status)
+	return status, err
+}
+
+// handle records an event received at the given time.
+func (c *ConsensusEventsCollector) handle(message VegaEventMessage, address string, received time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch message.Result.Data.Type {
+	case "tendermint/event/NewRound":
+		var event VegaNewRoundEvent
+		err := json.Unmarshal(message.Result.Data.Value, &event)
+		if err != nil {
+			return fmt.Errorf("decoding new round: %v", err)
+		}
+		height, err := strconv.ParseInt(event.Height, 10, 64)
+		if err != nil {
+			return fmt.Errorf("parsing round height: %v", err)
+		}
+		c.roundStarts[roundKey{height, event.Round}] = received
+
+		// Rounds of past heights won't get any vote that matters anymore
+		for key := range c.roundStarts {
+			if key.height < height-1 {
+				delete(c.roundStarts, key)
+			}
+		}
+
+	case "tendermint/event/Vote":
+		var event VegaVoteEvent
+		err := json.Unmarshal(message.Result.Data.Value, &event)
+		if err != nil {
+			return fmt.Errorf("decoding vote: %v", err)
+		}
+		vote := event.Vote
+		if vote.Type != voteTypePrevote || address == "" || !strings.EqualFold(vote.ValidatorAddress, address) {
+			return nil
+		}
+		height, err := strconv.ParseInt(vote.Height, 10, 64)
+		if err != nil {
+			return fmt.Errorf("parsing vote height: %v", err)
+		}
+		key := roundKey{height, vote.Round}
+		start, ok := c.roundStarts[key]
+		if !ok {
+			return nil
+		}
+		c.prevoteLatency.Observe(received.Sub(start).Seconds())
+		delete(c.roundStarts, key)
+	}
+	return nil
+}
+
+// dialWebsocket opens a WebSocket at a path of an endpoint, over the same kind
+// of connection as its HTTP requests.
+func dialWebsocket(ctx context.Context, endpoint string, path string, headers map[string]string) (*websocket.Conn, error) {
+	conn, location, err := dialEndpoint(ctx, endpoint, headers)
+	if err != nil {
+		return nil, err
+	}
+	location.Path = strings.TrimSuffix(location.Path, "/") + path
+
+	config, err := websocket.NewConfig(location.String(), "http://localhost/")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	config.Header = make(http.Header)
+	for name, value := range headers {
+		if !strings.EqualFold(name, "Host") {
+			config.Header.Set(name, value)
+		}
+	}
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Messages are bounded like the responses of HTTP requests
+	if *rpcMaxBodyBytes > 0 {
+		ws.MaxPayloadBytes = int(*rpcMaxBodyBytes)
+	}
+	return ws, nil
+}
+
+// dialEndpoint connects to the host or socket of an endpoint and returns the
+// WebSocket location matching it. A Host header overrides the host of the
+// location and the TLS server name.
+func dialEndpoint(ctx context.Context, endpoint string, headers map[string]string) (net.Conn, *url.URL, error) {
+	if strings.HasPrefix(endpoint, unixSocketPrefix) {
+		conn, err := dialContext(ctx, "unix", strings.TrimPrefix(endpoint, unixSocketPrefix))
+		return conn, &url.URL{Scheme: "ws", Host: "unix"}, err
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	location := &url.URL{Scheme: "ws", Host: u.Host, Path: u.Path}
+	for name, value := range headers {
+		if strings.EqualFold(name, "Host") {
+			location.Host = value
+		}
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	address := net.JoinHostPort(u.Hostname(), port)
+	// The proxy of the HTTP requests, from --rpc.proxy-url or the
+	// environment, applies to the WebSocket as well
+	proxyURL, err := tr.Proxy(&http.Request{URL: u})
+	if err != nil {
+		return nil, nil, fmt.Errorf("proxy for %s: %v", endpointLabel(endpoint), err)
+	}
+	var conn net.Conn
+	if proxyURL != nil {
+		conn, err = dialProxy(ctx, proxyURL, address)
+	} else {
+		conn, err = dialContext(ctx, "tcp", address)
+	}
+	if err != nil || u.Scheme != "https" {
+		return conn, location, err
+	}
+
+	location.Scheme = "wss"
+	config := tr.TLSClientConfig.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config.ServerName = location.Hostname()
+	tlsConn := tls.Client(conn, config)
+	conn.SetDeadline(time.Now().Add(*rpcTimeout))
+	err = tlsConn.Handshake()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tlsConn, location, nil
+}
+
+// dialProxy opens a tunnel to address through a SOCKS5 proxy, or an HTTP(S)
+// proxy with CONNECT.
+func dialProxy(ctx context.Context, proxyURL *url.URL, address string) (net.Conn, error) {
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(proxyURL, &net.Dialer{Timeout: *rpcDialTimeout})
+		if err != nil {
+			return nil, err
+		}
+		return dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", address)
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("proxy scheme %q isn't supported", proxyURL.Scheme)
+	}
+
+	port := proxyURL.Port()
+	if port == "" {
+		port = "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	conn, err := dialContext(ctx, "tcp", net.JoinHostPort(proxyURL.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if proxyURL.Scheme == "https" {
+		config := tr.TLSClientConfig.Clone()
+		if config == nil {
+			config = &tls.Config{}
+		}
+		config.ServerName = proxyURL.Hostname()
+		conn = tls.Client(conn, config)
+	}
+
+	connect := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		connect.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	err = connect.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connecting through proxy %s: %v", proxyURL.Host, err)
+	}
+	// The client speaks first in the tunnel, nothing of it can be buffered
+	// past the response. The body of a successful CONNECT is the tunnel, it
+	// isn't read
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connect)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connecting through proxy %s: %v", proxyURL.Host, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused the tunnel to %s: %s", proxyURL.Host, address, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
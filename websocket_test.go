@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/websocket"
+)
+
+func TestDialWebsocketProxy(t *testing.T) {
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(ws, ws)
+	}))
+	defer server.Close()
+
+	// Tunnels CONNECT requests to their target
+	var tunnels int32
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+		atomic.AddInt32(&tunnels, 1)
+		w.WriteHeader(http.StatusOK)
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go io.Copy(target, buf)
+		io.Copy(conn, target)
+	}))
+	defer proxyServer.Close()
+
+	defer func(proxy func(*http.Request) (*url.URL, error)) { tr.Proxy = proxy }(tr.Proxy)
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	tr.Proxy = http.ProxyURL(proxyURL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ws, err := dialWebsocket(ctx, server.URL, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := websocket.Message.Send(ws, "ping"); err != nil {
+		t.Fatal(err)
+	}
+	var reply string
+	if err := websocket.Message.Receive(ws, &reply); err != nil || reply != "ping" {
+		t.Fatalf("reply = %q, %v, want the echo", reply, err)
+	}
+	if n := atomic.LoadInt32(&tunnels); n != 1 {
+		t.Errorf("%d tunnels through the proxy, want 1", n)
+	}
+}
+
+func TestConsensusEventsHandle(t *testing.T) {
+	c := &ConsensusEventsCollector{
+		prevoteLatency: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_prevote_latency_seconds"}),
+		roundStarts:    make(map[roundKey]time.Time),
+	}
+	event := func(eventType string, value interface{}) VegaEventMessage {
+		var message VegaEventMessage
+		message.Result.Data.Type = eventType
+		message.Result.Data.Value, _ = json.Marshal(value)
+		return message
+	}
+	prevote := func(address string, round int) VegaEventMessage {
+		return event("tendermint/event/Vote", map[string]interface{}{"Vote": map[string]interface{}{
+			"type": voteTypePrevote, "height": "10", "round": round, "validator_address": address,
+		}})
+	}
+
+	start := time.Now()
+	steps := []struct {
+		message VegaEventMessage
+		at      time.Duration
+	}{
+		{event("tendermint/event/NewRound", map[string]interface{}{"height": "10", "round": 0}), 0},
+		// Another validator, then a round that never started
+		{prevote("B1B1", 0), 100 * time.Millisecond},
+		{prevote("a0a0", 1), 200 * time.Millisecond},
+		{prevote("a0a0", 0), 300 * time.Millisecond},
+		// Only the first prevote of the round counts
+		{prevote("a0a0", 0), 400 * time.Millisecond},
+	}
+	for i, step := range steps {
+		if err := c.handle(step.message, "A0A0", start.Add(step.at)); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+
+	var m dto.Metric
+	if err := c.prevoteLatency.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if count, sum := m.Histogram.GetSampleCount(), m.Histogram.GetSampleSum(); count != 1 || sum < 0.299 || sum > 0.301 {
+		t.Errorf("prevote latencies: count %d, sum %v, want a single one of 0.3", count, sum)
+	}
+}
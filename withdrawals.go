@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const dataNodeWithdrawalsUrl = "/api/v2/withdrawals"
+const dataNodeWithdrawalUrl = "/api/v2/withdrawal/"
+const dataNodeAssetsUrl = "/api/v2/assets"
+
+// Withdrawals approved by the network, and not decided yet
+const withdrawalStatusFinalized = "STATUS_FINALIZED"
+const withdrawalStatusOpen = "STATUS_OPEN"
+
+// Items per page of the data-node connections read by the exporter
+const dataNodePageSize = 1000
+
+// dataNodePageInfo is the pagination of a data-node connection.
+type dataNodePageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type dataNodeWithdrawal struct {
+	ID               string `json:"id"`
+	Amount           string `json:"amount"`
+	Asset            string `json:"asset"`
+	Status           string `json:"status"`
+	CreatedTimestamp string `json:"createdTimestamp"`
+	TxHash           string `json:"txHash"`
+}
+
+type DataNodeWithdrawals struct {
+	Withdrawals struct {
+		Edges []struct {
+			Node dataNodeWithdrawal `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"withdrawals"`
+}
+
+type DataNodeWithdrawal struct {
+	Withdrawal dataNodeWithdrawal `json:"withdrawal"`
+}
+
+type DataNodeAssets struct {
+	Assets struct {
+		Edges []struct {
+			Node struct {
+				ID      string `json:"id"`
+				Details struct {
+					Symbol   string `json:"symbol"`
+					Decimals string `json:"decimals"`
+				} `json:"details"`
+			} `json:"node"`
+		} `json:"edges"`
+		PageInfo dataNodePageInfo `json:"pageInfo"`
+	} `json:"assets"`
+}
+
+var (
+	metricWithdrawalsPending = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "withdrawals", "pending"),
+		"Number of ERC20 withdrawals approved by the network but not yet submitted to the bridge.",
+		[]string{"asset", "asset_id"}, nil,
+	)
+	metricWithdrawalsPendingAmount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "withdrawals", "pending_amount"),
+		"Amount of the ERC20 withdrawals approved by the network but not yet submitted to the bridge.",
+		[]string{"asset", "asset_id"}, nil,
+	)
+	metricWithdrawalsPendingOldestAge = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "withdrawals", "pending_oldest_age_seconds"),
+		"Age of the oldest ERC20 withdrawal approved by the network but not yet submitted to the bridge.",
+		[]string{"asset", "asset_id"}, nil,
+	)
+)
+
+// dataNodeAsset is what the exporter needs to know of an asset.
+type dataNodeAsset struct {
+	symbol   string
+	decimals int
+}
+
+// WithdrawalsCollector exports the ERC20 withdrawals that were approved but
+// whose bundle nobody submitted to the bridge yet, a frequent reason for
+// users asking where their funds are.
+//
+// The history is only listed once. Afterwards, the withdrawals created since
+// the latest one seen are listed, and those still undecided or unsubmitted
+// are read again one by one until they are.
+type WithdrawalsCollector struct {
+	dataNode *DataNodeClient
+
+	mutex  sync.Mutex
+	assets map[string]dataNodeAsset
+	// Creation time of the latest withdrawal listed, in nanoseconds
+	since int64
+	// Withdrawals open or pending by ID
+	unsettled map[string]dataNodeWithdrawal
+}
+
+func NewWithdrawalsCollector(dataNode *DataNodeClient) *WithdrawalsCollector {
+	return &WithdrawalsCollector{
+		dataNode:  dataNode,
+		assets:    make(map[string]dataNodeAsset),
+		unsettled: make(map[string]dataNodeWithdrawal),
+	}
+}
+
+func (c *WithdrawalsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- metricWithdrawalsPending
+	ch <- metricWithdrawalsPendingAmount
+	ch <- metricWithdrawalsPendingOldestAge
+}
+
+func (c *WithdrawalsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	err := c.follow(ctx)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]float64)
+	amounts := make(map[string]*big.Int)
+	oldest := make(map[string]time.Time)
+	for _, withdrawal := range c.unsettled {
+		if withdrawal.Status != withdrawalStatusFinalized {
+			continue
+		}
+		amount, ok := new(big.Int).SetString(withdrawal.Amount, 10)
+		if !ok {
+			return fmt.Errorf("withdrawal %s: invalid amount %q", withdrawal.ID, withdrawal.Amount)
+		}
+		created, err := parseUnixNano(withdrawal.CreatedTimestamp)
+		if err != nil {
+			return fmt.Errorf("withdrawal %s: %v", withdrawal.ID, err)
+		}
+
+		counts[withdrawal.Asset]++
+		if amounts[withdrawal.Asset] == nil {
+			amounts[withdrawal.Asset] = new(big.Int)
+		}
+		amounts[withdrawal.Asset].Add(amounts[withdrawal.Asset], amount)
+		if oldest[withdrawal.Asset].IsZero() || created.Before(oldest[withdrawal.Asset]) {
+			oldest[withdrawal.Asset] = created
+		}
+	}
+
+	// Assets without pending withdrawals are exported too, at 0
+	if len(c.assets) == 0 {
+		err := c.loadAssets(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	for id := range counts {
+		if _, ok := c.assets[id]; !ok {
+			err := c.loadAssets(ctx)
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	for id, asset := range c.assets {
+		amount := 0.0
+		if amounts[id] != nil {
+			amount = assetAmount(amounts[id], asset.decimals)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			metricWithdrawalsPending, prometheus.GaugeValue, counts[id], labelValue(asset.symbol), id,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			metricWithdrawalsPendingAmount, prometheus.GaugeValue, amount, labelValue(asset.symbol), id,
+		)
+		if counts[id] > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				metricWithdrawalsPendingOldestAge, prometheus.GaugeValue, time.Since(oldest[id]).Seconds(), labelValue(asset.symbol), id,
+			)
+		}
+	}
+	return nil
+}
+
+// follow lists the withdrawals created since the previous update, from the
+// creation time of the latest one seen as several can share it, then reads
+// again the unsettled withdrawals created before.
+func (c *WithdrawalsCollector) follow(ctx context.Context) error {
+	listed := make(map[string]bool)
+	since := c.since
+	cursor := ""
+	for {
+		path := dataNodePage(dataNodeWithdrawalsUrl, cursor) + "&pagination.newestFirst=false"
+		if since > 0 {
+			path += "&dateRange.startTimestamp=" + strconv.FormatInt(since, 10)
+		}
+		var withdrawals DataNodeWithdrawals
+		err := c.dataNode.Get(ctx, path, &withdrawals)
+		if err != nil {
+			return err
+		}
+		for _, edge := range withdrawals.Withdrawals.Edges {
+			withdrawal := edge.Node
+			created, err := strconv.ParseInt(withdrawal.CreatedTimestamp, 10, 64)
+			if err != nil {
+				return fmt.Errorf("withdrawal %s: invalid timestamp %q", withdrawal.ID, withdrawal.CreatedTimestamp)
+			}
+			if created > c.since {
+				c.since = created
+			}
+			listed[withdrawal.ID] = true
+			c.track(withdrawal)
+		}
+		if !withdrawals.Withdrawals.PageInfo.HasNextPage {
+			break
+		}
+		cursor = withdrawals.Withdrawals.PageInfo.EndCursor
+	}
+
+	for id := range c.unsettled {
+		if listed[id] {
+			continue
+		}
+		var withdrawal DataNodeWithdrawal
+		err := c.dataNode.Get(ctx, dataNodeWithdrawalUrl+url.PathEscape(id), &withdrawal)
+		if err != nil {
+			return fmt.Errorf("reading withdrawal %s: %v", id, err)
+		}
+		c.track(withdrawal.Withdrawal)
+	}
+	return nil
+}
+
+// track keeps the withdrawals still open, and the approved ones nobody
+// submitted to the bridge yet.
+func (c *WithdrawalsCollector) track(withdrawal dataNodeWithdrawal) {
+	if withdrawal.Status == withdrawalStatusOpen || withdrawal.Status == withdrawalStatusFinalized && withdrawal.TxHash == "" {
+		c.unsettled[withdrawal.ID] = withdrawal
+	} else {
+		delete(c.unsettled, withdrawal.ID)
+	}
+}
+
+// loadAssets lists the assets of the data node again, when an asset isn't
+// known yet.
+func (c *WithdrawalsCollector) loadAssets(ctx context.Context) error {
+	assets, err := listAssets(ctx, c.dataNode)
+	if err != nil {
+		return fmt.Errorf("listing assets: %v", err)
+	}
+	c.assets = assets
+	return nil
+}
+
+// listAssets returns the assets of the data node by ID.
+func listAssets(ctx context.Context, dataNode *DataNodeClient) (map[string]dataNodeAsset, error) {
+	assets := make(map[string]dataNodeAsset)
+	cursor := ""
+	for {
+		var page DataNodeAssets
+		err := dataNode.Get(ctx, dataNodePage(dataNodeAssetsUrl, cursor), &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range page.Assets.Edges {
+			decimals, err := strconv.Atoi(edge.Node.Details.Decimals)
+			if err != nil {
+				return nil, fmt.Errorf("asset %s: invalid decimals %q", edge.Node.ID, edge.Node.Details.Decimals)
+			}
+			assets[edge.Node.ID] = dataNodeAsset{symbol: edge.Node.Details.Symbol, decimals: decimals}
+		}
+		if !page.Assets.PageInfo.HasNextPage {
+			return assets, nil
+		}
+		cursor = page.Assets.PageInfo.EndCursor
+	}
+}
+
+// dataNodePage returns the path of a page of a data-node connection.
+func dataNodePage(path string, cursor string) string {
+	query := url.Values{}
+	query.Set("pagination.first", strconv.Itoa(dataNodePageSize))
+	if cursor != "" {
+		query.Set("pagination.after", cursor)
+	}
+	return path + "?" + query.Encode()
+}
+
+// parseUnixNano parses the nanosecond timestamps of the data node.
+func parseUnixNano(value string) (time.Time, error) {
+	nanos, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+	}
+	return time.Unix(0, nanos), nil
+}
+
+// assetAmount converts an amount in the smallest unit of an asset to units
+// of the asset.
+func assetAmount(amount *big.Int, decimals int) float64 {
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	value, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), scale).Float64()
+	return value
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// withdrawalsFixture is a data node with withdrawals of a single asset,
+// counting the requests listing them from the start of the history.
+type withdrawalsFixture struct {
+	mutex       sync.Mutex
+	withdrawals map[string]map[string]string
+	fullListing int
+}
+
+func (f *withdrawalsFixture) set(id, status, txHash string, created int64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.withdrawals[id] = map[string]string{
+		"id": id, "asset": "a1", "amount": "5", "status": status, "txHash": txHash,
+		"createdTimestamp": strconv.FormatInt(created, 10),
+	}
+}
+
+func (f *withdrawalsFixture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch {
+	case r.URL.Path == dataNodeAssetsUrl:
+		json.NewEncoder(w).Encode(map[string]interface{}{"assets": map[string]interface{}{
+			"edges": []interface{}{map[string]interface{}{"node": map[string]interface{}{
+				"id": "a1", "details": map[string]string{"symbol": "A", "decimals": "0"},
+			}}},
+		}})
+	case r.URL.Path == dataNodeWithdrawalsUrl:
+		start := r.URL.Query().Get("dateRange.startTimestamp")
+		if start == "" {
+			f.fullListing++
+		}
+		since, _ := strconv.ParseInt(start, 10, 64)
+		edges := []interface{}{}
+		for _, withdrawal := range f.withdrawals {
+			created, _ := strconv.ParseInt(withdrawal["createdTimestamp"], 10, 64)
+			if created >= since {
+				edges = append(edges, map[string]interface{}{"node": withdrawal})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"withdrawals": map[string]interface{}{"edges": edges}})
+	case strings.HasPrefix(r.URL.Path, dataNodeWithdrawalUrl):
+		withdrawal, ok := f.withdrawals[strings.TrimPrefix(r.URL.Path, dataNodeWithdrawalUrl)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"withdrawal": withdrawal})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestWithdrawalsCollector(t *testing.T) {
+	fixture := &withdrawalsFixture{withdrawals: make(map[string]map[string]string)}
+	server := httptest.NewServer(fixture)
+	defer server.Close()
+	c := NewWithdrawalsCollector(NewDataNodeClient(server.URL, nil))
+
+	fixture.set("submitted", withdrawalStatusFinalized, "0x1", 1)
+	fixture.set("pending", withdrawalStatusFinalized, "", 2)
+	fixture.set("open", withdrawalStatusOpen, "", 3)
+
+	steps := []struct {
+		name    string
+		update  func()
+		pending float64
+	}{
+		{"history", func() {}, 1},
+		{"open withdrawal approved", func() { fixture.set("open", withdrawalStatusFinalized, "", 3) }, 2},
+		{"pending withdrawal submitted", func() { fixture.set("pending", withdrawalStatusFinalized, "0x2", 2) }, 1},
+		{"new withdrawals", func() {
+			fixture.set("new", withdrawalStatusFinalized, "", 3)
+			fixture.set("rejected", "STATUS_REJECTED", "", 4)
+		}, 2},
+	}
+	for _, step := range steps {
+		step.update()
+		values, err := collect(t, c)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if pending := values[`vega_withdrawals_pending{asset="A",asset_id="a1"}`]; pending != step.pending {
+			t.Errorf("%s: pending = %v, want %v", step.name, pending, step.pending)
+		}
+		if amount := values[`vega_withdrawals_pending_amount{asset="A",asset_id="a1"}`]; amount != 5*step.pending {
+			t.Errorf("%s: pending amount = %v, want %v", step.name, amount, 5*step.pending)
+		}
+	}
+	if fixture.fullListing != 1 {
+		t.Errorf("history listed %d times, want once", fixture.fullListing)
+	}
+}